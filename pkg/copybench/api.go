@@ -0,0 +1,73 @@
+package copybench
+
+import "io"
+
+// DefaultConfig returns the scenario the command line runs when no scenario
+// file is given. Fields can be changed, or loaded from a file with Load,
+// before the scenario is passed to Seed or Bench.
+func DefaultConfig() *Config {
+	return defaultConfig()
+}
+
+// SetOutput sets the writer receiving the human-readable results, which is
+// standard output by default. Progress is logged with the log package.
+func SetOutput(w io.Writer) {
+	stdout = w
+}
+
+// Seed creates a database at path, which must not exist, and populates it
+// with the scenario's dataset, like the seed command.
+func Seed(path string, cfg *Config) error {
+	if err := cfg.prepare(); err != nil {
+		return err
+	}
+	eng, err := openEngine(path, true, cfg)
+	if err != nil {
+		return err
+	}
+	if err := eng.Seed(); err != nil {
+		eng.Close()
+		return err
+	}
+	return eng.Close()
+}
+
+// Bench runs the scenario's phases against the database at path, seeded with
+// the same scenario, like the bench command, and returns the results it would
+// write with -o.
+func Bench(path string, cfg *Config) (*Result, error) {
+	if err := cfg.prepare(); err != nil {
+		return nil, err
+	}
+	eng, err := openEngine(path, false, cfg)
+	if err != nil {
+		return nil, err
+	}
+	b := newBench(eng, cfg)
+	b.path = path
+	defer b.close()
+	if cfg.SeparateReader && !cfg.ReaderProcess {
+		if err := b.openReader(); err != nil {
+			return nil, err
+		}
+	}
+	if b.db != nil {
+		if err := cfg.checkBuckets(b.db); err != nil {
+			return nil, err
+		}
+	}
+
+	res := newResult("bench", path, cfg)
+	if res.Size, err = stat(eng); err != nil {
+		return nil, err
+	}
+	if err := b.run(res); err != nil {
+		return nil, err
+	}
+	if b.db != nil {
+		if res.Buckets, err = bucketStats(b.db); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
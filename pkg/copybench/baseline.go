@@ -0,0 +1,82 @@
+package copybench
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"text/tabwriter"
+	"time"
+)
+
+// errRegression is returned when a run is slower than its baseline.
+var errRegression = errors.New("regression against baseline")
+
+// readResult loads a result previously written with -o or -save-baseline.
+func readResult(path string) (*Result, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Result
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return &r, nil
+}
+
+// lowerIsBetter returns true for metrics where an increase is a regression.
+// Other metrics are reported but never flagged.
+func lowerIsBetter(metric string) bool {
+	switch metric {
+	case "iterate_avg", "iterate_p99", "get_p99", "mix_write_p99", "copy_duration", "writeto_duration", "restore_duration", "compact_duration":
+		return true
+	}
+	return false
+}
+
+// compareBaseline prints the percentage change of every metric in r against
+// the baseline at path. It returns errRegression if any metric got worse by
+// more than threshold percent.
+func (r *Result) compareBaseline(path string, threshold float64) error {
+	base, err := readResult(path)
+	if err != nil {
+		return err
+	}
+	baseline := make(map[[2]string]*summary)
+	for _, s := range base.summarize() {
+		baseline[[2]string{s.Phase, s.Metric}] = s
+	}
+
+	var regressed bool
+	fmt.Fprintf(stdout, "baseline: %s (%s)\n", path, base.Time.Format(time.RFC3339))
+	w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "phase\tmetric\tbaseline\tcurrent\tdelta\t")
+	for _, s := range r.summarize() {
+		b, ok := baseline[[2]string{s.Phase, s.Metric}]
+		if !ok || b.Mean == 0 {
+			continue
+		}
+
+		delta := (s.Mean - b.Mean) / b.Mean * 100
+		var flag string
+		if lowerIsBetter(s.Metric) && delta > threshold {
+			flag, regressed = "REGRESSION", true
+		}
+
+		f := func(v float64) string {
+			if lowerIsBetter(s.Metric) {
+				return time.Duration(v).String()
+			}
+			return fmt.Sprintf("%.1f", v)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%+.1f%%\t%s\n", s.Phase, s.Metric, f(b.Mean), f(s.Mean), delta, flag)
+	}
+	w.Flush()
+	fmt.Fprintln(stdout, "")
+
+	if regressed {
+		return errRegression
+	}
+	return nil
+}
@@ -0,0 +1,894 @@
+package copybench
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/boltdb/bolt"
+)
+
+// benchMain measures iteration performance with and without a concurrent copy.
+func benchMain(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	cfg := defaultConfig()
+	out := fs.String("o", "", "write results as JSON to `FILE`")
+	benchstatPath := fs.String("benchstat", "", "write results in benchstat format to `FILE`")
+	csvPath := fs.String("csv", "", "write every iteration pass as CSV to `FILE`")
+	memoryCSV := fs.String("memory-csv", "", "write memory usage every second as CSV to `FILE`")
+	throughputCSV := fs.String("throughput-csv", "", "write read and copy throughput every second as CSV to `FILE`")
+	htmlPath := fs.String("html", "", "write an HTML report with charts to `FILE`")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on `ADDR`")
+	controlAddr := fs.String("control-addr", "", "serve the status and control API on `ADDR`")
+	webAddr := fs.String("web-addr", "", "serve a live web dashboard on `ADDR`")
+	influxURL := fs.String("influx-url", "", "push samples in Influx line protocol to the write endpoint `URL`")
+	influxInterval := fs.Duration("influx-interval", 10*time.Second, "push a sample to -influx-url every `D`")
+	otlpEndpoint := fs.String("otlp-endpoint", "", "export phases as spans, and metrics, to the OTLP gRPC endpoint `URL`")
+	statsdAddr := fs.String("statsd-addr", "", "send counters and timings to the StatsD server at `ADDR`")
+	statsdPlain := fs.Bool("statsd-plain", false, "send plain StatsD metrics, without DogStatsD tags")
+	tui := fs.Bool("tui", false, "show a live dashboard when attached to a terminal")
+	keyLatency := fs.Bool("key-latency", false, "record the latency of every key read")
+	iostat := fs.Bool("iostat", false, "sample the utilization of the database's block device (Linux)")
+	fs.StringVar(&cfg.Workload, "workload", cfg.Workload, "read workload `NAME` ("+workloadNames()+")")
+	fs.StringVar(&cfg.WorkloadScript, "workload-script", cfg.WorkloadScript, "run the Starlark script `FILE` with the script workload")
+	fs.StringVar(&cfg.KeyDistribution, "key-dist", cfg.KeyDistribution, "distribution `NAME` of random key accesses (uniform or zipfian)")
+	fs.Float64Var(&cfg.DeleteRate, "delete-rate", cfg.DeleteRate, "delete `N` keys per second during the delete_phases")
+	fs.Float64Var(&cfg.UpdateRate, "update-rate", cfg.UpdateRate, "rewrite `N` keys per second in place during the update_phases")
+	fs.StringVar(&cfg.Mix, "mix", cfg.Mix, "run a mixed load of reads and writes at `READ:WRITE` during every phase")
+	fs.IntVar(&cfg.Readers, "readers", cfg.Readers, "run `N` concurrent readers")
+	fs.Float64Var(&cfg.ChurnPct, "churn", cfg.ChurnPct, "delete and reinsert `FRACTION` of the keys in the churn phase")
+	fs.BoolVar(&cfg.DropCaches, "drop-caches", cfg.DropCaches, "evict the database from the page cache before every phase (Linux)")
+	fs.BoolVar(&cfg.SeparateReader, "separate-reader", cfg.SeparateReader, "run the readers against a second read-only open of the database")
+	fs.BoolVar(&cfg.ReaderProcess, "reader-process", cfg.ReaderProcess, "run the separate reader in a child process")
+	fs.IntVar(&cfg.Reps, "reps", cfg.Reps, "repeat the iterate and copy phases `N` times")
+	fs.Var(&cfg.Warmup, "warmup", "warm up with `N` passes per reader, or for a duration such as 10s")
+	fs.BoolVar(&cfg.VerifySnapshot, "verify-snapshot", cfg.VerifySnapshot, "rewrite known keys during copies and check each copy holds a single version of them")
+	fs.IntVar(&cfg.CopyCount, "copy-count", cfg.CopyCount, "make `N` copies in the copy phase, one every -copy-interval")
+	fs.DurationVar(&cfg.CopyInterval.Duration, "copy-interval", cfg.CopyInterval.Duration, "start a copy every `D` with -copy-count")
+	fs.DurationVar(&cfg.PhaseDuration.Duration, "duration", cfg.PhaseDuration.Duration, "run the iterate and copy phases for `D` each, copying repeatedly")
+	saveBaseline := fs.String("save-baseline", "", "save the results as a baseline to `FILE`")
+	compareBaseline := fs.String("compare-baseline", "", "compare the results against the baseline in `FILE`")
+	threshold := fs.Float64("threshold", 10, "percentage slowdown against the baseline reported as a regression")
+	registerCopyFlags(fs, cfg)
+	prof := registerProfileFlags(fs)
+	path, err := parseFlags(fs, args, cfg)
+	if err != nil {
+		return err
+	}
+	if *influxURL != "" && *influxInterval <= 0 {
+		return fmt.Errorf("-influx-interval must be positive")
+	}
+	handleSignals()
+
+	t := time.Now()
+	eng, err := openEngine(path, false, cfg)
+	if err != nil {
+		return err
+	}
+	b := newBench(eng, cfg)
+	b.path = path
+	b.prof = prof
+	defer b.close()
+	if db := boltDB(eng); db != nil {
+		if err := cfg.checkBuckets(db); err != nil {
+			return err
+		}
+	}
+
+	if err := serveMetrics(*metricsAddr); err != nil {
+		return err
+	}
+	if err := serveControl(*controlAddr); err != nil {
+		return err
+	}
+
+	// Print stats of the db.
+	res := newResult("bench", path, cfg)
+	res.Open = time.Since(t)
+	fmt.Fprintf(stdout, "open: %v\n", res.Open)
+	if lw, ok := eng.(lockWaiter); ok {
+		res.LockWait = lw.LockWait()
+		fmt.Fprintf(stdout, "lock wait: %v\n", res.LockWait)
+	}
+	if res.Size, err = stat(eng); err != nil {
+		return err
+	}
+
+	b.keyLatency = *keyLatency
+	if *iostat {
+		if b.disk, err = newDiskSampler(path); err != nil {
+			return err
+		}
+	}
+	if cfg.ReaderProcess {
+		fmt.Fprintln(stdout, "reader process: readers run in a child process with its own read-only handle")
+	} else if cfg.SeparateReader {
+		if err := b.openReader(); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, "separate reader: readers and copier use their own read-only handles")
+	}
+	if *tui {
+		b.dash = startDashboard("bench "+path, res.Size)
+		defer b.dash.Close()
+	}
+	if b.web, err = startWebDashboard(*webAddr, "bench "+path, res.Size); err != nil {
+		return err
+	}
+	defer b.web.Close()
+	b.influx = startInfluxExporter(*influxURL, *influxInterval, "bench", cfg)
+	defer b.influx.Close()
+	if b.otel, err = startOtelExporter(*otlpEndpoint, "bench", path, cfg); err != nil {
+		return err
+	}
+	defer b.otel.Close()
+	if b.statsd, err = startStatsdSink(*statsdAddr, *statsdPlain, "bench", cfg); err != nil {
+		return err
+	}
+	defer b.statsd.Close()
+	if *csvPath != "" {
+		if b.samples, err = createSampleWriter(*csvPath); err != nil {
+			return err
+		}
+		defer b.samples.Close()
+	}
+	if *memoryCSV != "" {
+		if b.memory, err = startMemorySampler(*memoryCSV); err != nil {
+			return err
+		}
+		defer b.memory.Close()
+	}
+
+	if !prof.phases {
+		if err := prof.start(""); err != nil {
+			return err
+		}
+	}
+	err = b.run(res)
+	if err := prof.stop(); err != nil {
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if b.db != nil {
+		if res.Buckets, err = bucketStats(b.db); err != nil {
+			return err
+		}
+	}
+
+	if err := b.samples.Close(); err != nil {
+		return err
+	}
+	if err := b.memory.Close(); err != nil {
+		return err
+	}
+	if err := writeThroughputCSV(*throughputCSV, res.Throughput); err != nil {
+		return err
+	}
+	if err := res.writeHTML(*htmlPath); err != nil {
+		return err
+	}
+	if err := res.writeBenchstat(*benchstatPath); err != nil {
+		return err
+	}
+	if err := res.write(*saveBaseline); err != nil {
+		return err
+	}
+	if err := res.save(*out); err != nil {
+		return err
+	}
+
+	// Compare last so that results are written even if there's a regression.
+	if *compareBaseline != "" {
+		return res.compareBaseline(*compareBaseline, *threshold)
+	}
+	return nil
+}
+
+// bench holds the state shared by the phases of a benchmark run.
+type bench struct {
+	eng engine
+	cfg *Config
+
+	// db is the database of the bolt engine, or nil for other engines.
+	db *bolt.DB
+
+	// reader and readerDB are the handles the readers run against: eng and
+	// db, or a second read-only handle on the same database.
+	reader   engine
+	readerDB *bolt.DB
+
+	// path is the path of the database, used to reopen it.
+	path string
+
+	// samples records every iteration pass, and memory the memory usage
+	// over time, if set.
+	samples *sampleWriter
+	memory  *memorySampler
+
+	// throughput buckets the read and copy throughput of the run.
+	throughput *throughputSampler
+
+	// dash is the live terminal dashboard, and web the web dashboard, if
+	// running.
+	dash *dashboard
+	web  *webDashboard
+
+	// influx pushes samples to an Influx endpoint, otel spans and metrics to
+	// an OTLP endpoint, and statsd metrics to a StatsD server, if set.
+	influx *influxExporter
+	otel   *otelExporter
+	statsd *statsdSink
+
+	// keyLatency enables recording the latency of every key read.
+	keyLatency bool
+
+	// disk samples the utilization of the database's block device, if set.
+	disk *diskSampler
+
+	// prof profiles the run, or each of its phases.
+	prof *profiler
+
+	// copies holds the copies made by the last copy phase, which the restore
+	// phase restores.
+	copies []*copyStats
+
+	// keys picks the keys accessed by the random workloads.
+	keys keyChooser
+
+	// ycsb holds the runners of the YCSB presets used by the reader.
+	ycsb map[string]*ycsb
+
+	// deleted counts the keys deleted in sequential order so far.
+	deleted int
+}
+
+// newBench returns a bench running the scenario against eng.
+func newBench(eng engine, cfg *Config) *bench {
+	b := &bench{eng: eng, cfg: cfg, db: boltDB(eng), keys: newKeyChooser(cfg), ycsb: make(map[string]*ycsb), prof: &profiler{}}
+	b.reader, b.readerDB = eng, b.db
+	for _, phase := range cfg.Phases {
+		if w := cfg.workload(phase); isYCSB(w) && b.ycsb[w] == nil {
+			b.ycsb[w] = newYCSB(w, cfg)
+		}
+	}
+	return b
+}
+
+// openReader opens the second handle on the database used by the readers with
+// a separate reader. Both handles are opened read-only so that they can share
+// the file lock.
+func (b *bench) openReader() error {
+	reader, err := openEngine(b.path, false, b.cfg)
+	if err != nil {
+		return fmt.Errorf("open reader: %s", err)
+	}
+	b.reader, b.readerDB = reader, boltDB(reader)
+	return nil
+}
+
+// close closes the bench's handles on the database.
+func (b *bench) close() error {
+	if b.reader != b.eng {
+		b.reader.Close()
+	}
+	return b.eng.Close()
+}
+
+// run executes the scenario's phases for every repetition and appends their
+// measurements to res.
+func (b *bench) run(res *Result) error {
+	fl, _ := b.eng.(freelister)
+	b.throughput = startThroughputSampler(fl)
+reps:
+	for rep := 0; rep < b.cfg.Reps; rep++ {
+		for _, phase := range b.cfg.Phases {
+			// Pages only need to be pushed into memory once.
+			if phase == phaseWarmup && rep > 0 {
+				continue
+			}
+			if isInterrupted() {
+				break reps
+			}
+			if b.cfg.DropCaches {
+				if err := b.dropCaches(); err != nil {
+					return fmt.Errorf("drop caches: %s", err)
+				}
+			}
+
+			endSpan := b.otel.startPhase(phase, rep)
+			pr, err := b.profilePhase(phase, rep)
+			if pr != nil {
+				pr.Rep = rep
+				pr.Interrupted = isInterrupted()
+			}
+			endSpan(pr, err)
+			if err == errInterrupted {
+				break reps
+			} else if err != nil {
+				return err
+			}
+			res.Phases = append(res.Phases, pr)
+			addControlPhase(pr)
+			b.statsd.phase(pr)
+		}
+	}
+	setPhase("")
+	res.Throughput = b.throughput.stop()
+
+	// Report whatever was measured before a signal.
+	if res.Interrupted = isInterrupted(); res.Interrupted {
+		fmt.Fprintf(stdout, "interrupted: results cover the %d phases completed\n\n", len(res.Phases))
+	}
+
+	if res.ColdStart = res.coldStart(); res.ColdStart != nil {
+		res.ColdStart.print()
+	}
+	if res.Impact = res.copyImpact(); res.Impact != nil {
+		res.Impact.print()
+	}
+	if res.CompactImpact = res.phaseImpact(phaseCompact); res.CompactImpact != nil {
+		res.CompactImpact.print()
+	}
+	if res.CompactCopy = res.compactCopy(); res.CompactCopy != nil {
+		res.CompactCopy.print()
+	}
+	if b.cfg.Reps > 1 {
+		res.Summary = res.summarize()
+		printSummary(res.Summary)
+	}
+	return nil
+}
+
+// profilePhase runs a single bench phase, profiling it on its own if the
+// phases are profiled separately.
+// Contention is only profiled and traced during the copy phase.
+func (b *bench) profilePhase(phase string, rep int) (*phaseResult, error) {
+	var label string
+	if b.prof.phases {
+		label = (&phaseResult{Name: phase, Rep: rep}).Label()
+		if err := b.prof.start(label); err != nil {
+			return nil, err
+		}
+	}
+	if phase == phaseCopy {
+		if err := b.prof.startCopy(label); err != nil {
+			return nil, err
+		}
+	}
+	pr, err := b.runPhase(phase)
+	if phase == phaseCopy {
+		if err := b.prof.stopCopy(label); err != nil {
+			return nil, err
+		}
+	}
+	if b.prof.phases {
+		if err := b.prof.stop(); err != nil {
+			return nil, err
+		}
+	}
+	return pr, err
+}
+
+// runPhase runs a single bench phase and returns its measurements.
+func (b *bench) runPhase(phase string) (*phaseResult, error) {
+	return b.measure(phase, func(pr *phaseResult) error {
+		switch phase {
+		case phaseWarmup:
+			// Iterate to push pages into memory. The passes are left out of
+			// every summary.
+			fmt.Fprintf(stdout, "warmup: %s (ignore)\n", b.cfg.Warmup)
+			stop, err := b.startIterateN(phase, b.cfg.Warmup.Passes)
+			if err != nil {
+				return err
+			}
+			if d := b.cfg.Warmup.Duration; d > 0 {
+				select {
+				case <-time.After(d):
+				case <-interrupted:
+				}
+			}
+			if pr.Iterate, err = stop(); err != nil {
+				return err
+			}
+
+		case phaseIterate:
+			// Time iteration without copy.
+			fmt.Fprintln(stdout, "iterate only")
+			stop, err := b.startIterate(phase)
+			if err != nil {
+				return err
+			}
+			d := b.cfg.IterateDuration.Duration
+			if b.cfg.PhaseDuration.Duration > 0 {
+				d = b.cfg.PhaseDuration.Duration
+			}
+			select {
+			case <-time.After(d):
+			case <-interrupted:
+			}
+			if pr.Iterate, err = stop(); err != nil {
+				return err
+			}
+
+		case phaseCopy:
+			// Start iterator thread.
+			fmt.Fprintln(stdout, "iterate during copy")
+			stop, err := b.startIterate(phase)
+			if err != nil {
+				return err
+			}
+
+			// Copy the database, again and again until the phase duration
+			// has elapsed if there is one, or copy_count times, starting a
+			// copy every copy_interval.
+			copyFn := func() ([]*copyStats, error) { return dbcopy(b.eng, b.cfg) }
+			var sw *snapshotWriter
+			if b.cfg.VerifySnapshot {
+				var err error
+				if sw, err = b.startSnapshotWriter(); err != nil {
+					stop()
+					return err
+				}
+				copyFn = sw.copy
+			}
+			t := time.Now()
+			deadline := t.Add(b.cfg.PhaseDuration.Duration)
+			for n := 1; ; n++ {
+				start := time.Now()
+				copies, err := copyFn()
+				if err != nil {
+					if sw != nil {
+						sw.stop()
+					}
+					stop()
+					return err
+				}
+				if b.cfg.PhaseDuration.Duration > 0 || b.cfg.CopyCount > 1 {
+					for _, cs := range copies {
+						cs.Start = start.Sub(t)
+					}
+				}
+				pr.Copies = append(pr.Copies, copies...)
+				if isInterrupted() {
+					break
+				} else if b.cfg.CopyCount > 1 {
+					if n == b.cfg.CopyCount {
+						break
+					}
+					select {
+					case <-time.After(time.Until(start.Add(b.cfg.CopyInterval.Duration))):
+					case <-interrupted:
+					}
+				} else if !time.Now().Before(deadline) {
+					break
+				}
+			}
+			if b.cfg.PhaseDuration.Duration > 0 {
+				fmt.Fprintf(stdout, "copies: %d in %v\n", len(pr.Copies), time.Since(t))
+			} else if b.cfg.CopyCount > 1 {
+				printCopySeries(pr.Copies)
+			}
+			if sw != nil {
+				gens, err := sw.stop()
+				if err != nil {
+					stop()
+					return err
+				}
+				fmt.Fprintf(stdout, "snapshot writer: %d generations of %d keys\n", gens, snapshotKeys)
+			}
+
+			// Notify iterator of db copy completion.
+			if pr.Iterate, err = stop(); err != nil {
+				return err
+			}
+			b.copies = pr.Copies
+
+		case phaseChurn:
+			fmt.Fprintf(stdout, "churn: %.0f%% of the keys\n", b.cfg.ChurnPct*100)
+			cs, err := churn(b.db, b.cfg)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "churn: %s\n", cs)
+			pr.Churn = cs
+
+		case phaseCompact:
+			// Iterate while the database is compacted into a fresh file
+			// beside it, which is removed once measured.
+			fmt.Fprintln(stdout, "iterate during compaction")
+			stop, err := b.startIterate(phase)
+			if err != nil {
+				return err
+			}
+			cs, err := compact(b.db, b.path+".compact")
+			defer os.Remove(b.path + ".compact")
+			it, stopErr := stop()
+			if err != nil {
+				return err
+			} else if stopErr != nil {
+				return stopErr
+			}
+			pr.Iterate = it
+			fmt.Fprintf(stdout, "compact: %s\n", cs)
+			pr.Compact = cs
+
+		case phaseCompactCopy:
+			// Compact the database and copy it at once, as when both are
+			// scheduled at the same time, while iterating.
+			fmt.Fprintln(stdout, "iterate during compaction and copy")
+			stop, err := b.startIterate(phase)
+			if err != nil {
+				return err
+			}
+			var cs *compactStats
+			var compactErr error
+			done := make(chan struct{})
+			go func() {
+				cs, compactErr = compact(b.db, b.path+".compact")
+				close(done)
+			}()
+			copies, err := dbcopy(b.eng, b.cfg)
+			<-done
+			defer os.Remove(b.path + ".compact")
+			it, stopErr := stop()
+			if err != nil {
+				return err
+			} else if compactErr != nil {
+				return compactErr
+			} else if stopErr != nil {
+				return stopErr
+			}
+			pr.Iterate = it
+			fmt.Fprintf(stdout, "compact: %s\n", cs)
+			pr.Compact, pr.Copies = cs, copies
+			b.copies = copies
+
+		case phaseRestore:
+			targets := restoreTargets(b.copies)
+			if len(targets) == 0 {
+				return fmt.Errorf("the restore phase needs a copy to a file (see copy_targets)")
+			}
+			fmt.Fprintln(stdout, "restore")
+			for _, path := range targets {
+				rs, err := restore(path, b.cfg)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(stdout, "restore: %s\n", rs)
+				pr.Restores = append(pr.Restores, rs)
+			}
+
+		case phaseIncremental:
+			fmt.Fprintln(stdout, "incremental backup")
+			inc, err := incremental(b.db, b.cfg)
+			if err != nil {
+				return err
+			}
+			pr.Incremental = inc
+		}
+		return nil
+	})
+}
+
+// measure runs fn as the named phase, timing it and recording the change in
+// bolt's stats over its duration. The scenario's mixed workload and the
+// phase's background writers, if any, run for as long as fn does.
+func (b *bench) measure(phase string, fn func(pr *phaseResult) error) (*phaseResult, error) {
+	var before *statsSnapshot
+	var err error
+	if b.db != nil {
+		if before, err = snapshotStats(b.db); err != nil {
+			return nil, err
+		}
+	}
+
+	usage, err := getrusage()
+	if err != nil {
+		return nil, err
+	}
+	mem := readMemStats()
+	ioc := newIOCounter()
+	var stopDisk func() *diskStats
+	if b.disk != nil {
+		stopDisk = b.disk.start()
+	}
+	pr := &phaseResult{Name: phase}
+	corrupt := atomic.LoadInt64(&corruptValues)
+	paused := pausedFor()
+	t := time.Now()
+	setPhase(phase)
+	b.dash.setPhase(phase)
+	b.web.setPhase(phase)
+	b.influx.setPhase(phase)
+	b.memory.setPhase(phase)
+	b.throughput.setPhase(phase)
+
+	var stopMix func() *mixStats
+	if b.cfg.Mix != "" {
+		stopMix = b.startMix()
+	}
+	var stopDeletes, stopUpdates func() *writeStats
+	if b.cfg.DeleteRate > 0 && contains(b.cfg.DeletePhases, phase) {
+		stopDeletes = b.startDeletes()
+	}
+	if b.cfg.UpdateRate > 0 && contains(b.cfg.UpdatePhases, phase) {
+		stopUpdates = b.startUpdates()
+	}
+	err = fn(pr)
+	if stopDisk != nil {
+		pr.Disk = stopDisk()
+	}
+	if stopUpdates != nil {
+		pr.Updates = stopUpdates()
+		fmt.Fprintf(stdout, "updates: %s\n", pr.Updates)
+	}
+	if stopDeletes != nil {
+		pr.Deletes = stopDeletes()
+		fmt.Fprintf(stdout, "deletes: %s\n", pr.Deletes)
+	}
+	if stopMix != nil {
+		pr.Mix = stopMix()
+		fmt.Fprintf(stdout, "mix: %s\n", pr.Mix)
+	}
+	if err != nil {
+		return nil, err
+	}
+	pr.Paused = pausedFor() - paused
+	pr.Duration = time.Since(t) - pr.Paused
+	if pr.Usage, err = usageSince(usage); err != nil {
+		return nil, err
+	}
+	pr.Mem = memSince(mem)
+	pr.IO = ioc.since(pr.Duration)
+
+	if b.db != nil {
+		after, err := snapshotStats(b.db)
+		if err != nil {
+			return nil, err
+		}
+		pr.Stats = after.sub(before)
+		fmt.Fprintf(stdout, "stats: %s\n", pr.Stats)
+	}
+	if f, ok := b.eng.(freelister); ok {
+		pr.Freelist = f.Freelist()
+		fmt.Fprintf(stdout, "freelist: %s\n", pr.Freelist)
+	}
+	if pr.Usage != nil {
+		fmt.Fprintf(stdout, "usage: %s\n", pr.Usage)
+	}
+	fmt.Fprintf(stdout, "memory: %s\n", pr.Mem)
+	if pr.IO != nil {
+		fmt.Fprintf(stdout, "io: %s\n", pr.IO)
+	}
+	if pr.Disk != nil {
+		fmt.Fprintf(stdout, "disk: %s\n", pr.Disk)
+	}
+	if pr.Paused > 0 {
+		fmt.Fprintf(stdout, "paused: %v, left out of the phase's duration\n", pr.Paused)
+	}
+	fmt.Fprintln(stdout, "")
+	if n := atomic.LoadInt64(&corruptValues) - corrupt; n > 0 {
+		return nil, fmt.Errorf("%s: %d values read failed their checksum", phase, n)
+	}
+	return pr, nil
+}
+
+// startIterate runs cfg.Readers copies of iterate, each in its own goroutine.
+// The returned function stops the iteration and returns the readers' combined
+// stats. Only a reader process can fail to start or stop.
+func (b *bench) startIterate(phase string) (func() (*iterateStats, error), error) {
+	return b.startIterateN(phase, 0)
+}
+
+// startIterateN is like startIterate, but when passes is nonzero every reader
+// makes exactly that many passes, and stopping waits for them.
+func (b *bench) startIterateN(phase string, passes int) (func() (*iterateStats, error), error) {
+	if b.cfg.ReaderProcess {
+		return b.startReaderProcess(phase, passes)
+	}
+	c := make(chan bool)
+	done := make(chan *iterateStats, b.cfg.Readers)
+	hists := make([]*iterateHists, b.cfg.Readers)
+	for i := range hists {
+		hists[i] = b.newIterateHists(phase)
+		go func(i int) { done <- b.iterate(phase, i, passes, hists[i], c) }(i)
+	}
+	return func() (*iterateStats, error) {
+		close(c)
+		readers := make([]*iterateStats, b.cfg.Readers)
+		for i := range readers {
+			readers[i] = <-done
+		}
+		sort.Slice(readers, func(i, j int) bool { return readers[i].Reader < readers[j].Reader })
+
+		// Combine the readers' passes and histograms.
+		stats := &iterateStats{}
+		for i, r := range readers {
+			stats.N += r.N
+			stats.Keys += r.Keys
+			stats.Total += r.Total
+			stats.Samples = append(stats.Samples, r.Samples...)
+			if i > 0 {
+				hists[0].merge(hists[i])
+			}
+		}
+		sort.Slice(stats.Samples, func(i, j int) bool { return stats.Samples[i].Time.Before(stats.Samples[j].Time) })
+		if stats.N > 0 {
+			stats.Avg = stats.Total / time.Duration(stats.N)
+		}
+		hists[0].summarize(stats)
+		if len(readers) > 1 {
+			stats.Readers = readers
+		}
+		stats.print()
+		return stats, nil
+	}, nil
+}
+
+// iterateHists holds the latency histograms of a reader.
+type iterateHists struct {
+	pass, key, get, seek *hdrhistogram.Histogram
+	ops                  map[string]*hdrhistogram.Histogram
+}
+
+// newIterateHists returns the histograms recorded by the phase's workload.
+func (b *bench) newIterateHists(phase string) *iterateHists {
+	h := &iterateHists{pass: newLatencyHistogram()}
+	if b.keyLatency {
+		h.key = newLatencyHistogram()
+	}
+	switch w := b.cfg.workload(phase); w {
+	case workloadGet:
+		h.get = newLatencyHistogram()
+	case workloadPrefix, workloadRange:
+		h.seek = newLatencyHistogram()
+	default:
+		if y := b.ycsb[w]; y != nil {
+			h.ops = y.newHistograms()
+		}
+	}
+	return h
+}
+
+// merge adds the values recorded in o to h.
+func (h *iterateHists) merge(o *iterateHists) {
+	h.pass.Merge(o.pass)
+	for _, p := range [][2]*hdrhistogram.Histogram{{h.key, o.key}, {h.get, o.get}, {h.seek, o.seek}} {
+		if p[0] != nil {
+			p[0].Merge(p[1])
+		}
+	}
+	for op, hist := range h.ops {
+		hist.Merge(o.ops[op])
+	}
+}
+
+// summarize sets the latency percentiles of stats from h.
+func (h *iterateHists) summarize(stats *iterateStats) {
+	stats.Latency = summarizeHistogram(h.pass)
+	stats.KeyLatency = summarizeHistogram(h.key)
+	stats.GetLatency = summarizeHistogram(h.get)
+	stats.SeekLatency = summarizeHistogram(h.seek)
+	stats.OpLatency = summarizeOps(h.ops)
+}
+
+// iterateBound returns the key at which a scan of the workload stops: forward
+// scans stop at the first key past iterate_pct of the dataset and reverse
+// scans at the first key before the last iterate_pct.
+func (c *Config) iterateBound(workload string) []byte {
+	n := int(float64(c.ItemCount) * c.IteratePct)
+	if workload == workloadReverse {
+		n = c.ItemCount - n
+	}
+	bound := make([]byte, c.KeySize)
+	c.encodeKey(bound, n)
+	return bound
+}
+
+// iterate continually makes passes of the workload selected for the phase,
+// such as the iterate workload's scan over a subsection of the database, until
+// c is closed, or for the given number of passes if it is nonzero, even once c
+// is closed. Latencies are recorded in hists. If the workload can't be set up,
+// the reader makes no passes.
+func (b *bench) iterate(phase string, reader, passes int, hists *iterateHists, c chan bool) *iterateStats {
+	name := b.cfg.workload(phase)
+	stats := iterateStats{Reader: reader}
+	w := workloads[name]()
+	env := &WorkloadEnv{
+		Config: b.cfg,
+		DB:     b.readerDB,
+		Reader: reader,
+		Rand:   newRand(b.cfg, streamReader+int64(reader)),
+		eng:    b.reader,
+		keys:   b.keys,
+		hists:  hists,
+		ycsb:   b.ycsb,
+	}
+	if err := w.Setup(env); err != nil {
+		log.Printf("  %s: setup: %s", name, err)
+		return &stats
+	}
+	defer func() {
+		if err := w.Teardown(); err != nil {
+			log.Printf("  %s: teardown: %s", name, err)
+		}
+	}()
+
+loop:
+	for {
+		waitIfPaused()
+		t := time.Now()
+		count, err := w.Step()
+		if err != nil {
+			log.Printf("  %s: %s", name, err)
+		}
+		d := time.Since(t)
+		if b.dash == nil {
+			log.Printf("  iterate: %v (n=%d)", d, count)
+		}
+		if err := b.samples.record(t, phase, d, count); err != nil {
+			log.Printf("  csv: %s", err)
+		}
+		b.dash.observe(d, count)
+		b.web.observe(d)
+		b.influx.observe(d)
+		b.otel.observe(phase, d, count)
+		b.statsd.observe(phase, d, count)
+		iterationsTotal.WithLabelValues(phase).Inc()
+		iterateKeysTotal.WithLabelValues(phase).Add(float64(count))
+		atomic.AddInt64(&keysRead, int64(count))
+		iterateDuration.WithLabelValues(phase).Observe(d.Seconds())
+		recordLatency(hists.pass, d)
+		stats.Samples = append(stats.Samples, sample{Time: t, Duration: d, Keys: count})
+		stats.Total += d
+		stats.Keys += count
+		stats.N++
+
+		// Check for completion.
+		if passes > 0 {
+			if stats.N >= passes || isInterrupted() {
+				break loop
+			}
+			continue
+		}
+		select {
+		case <-c:
+			break loop
+		default:
+		}
+	}
+
+	stats.Avg = stats.Total / time.Duration(stats.N)
+	stats.Latency = summarizeHistogram(hists.pass)
+	return &stats
+}
+
+// print writes the readers' combined stats, and a line per reader if there
+// were several, to stdout.
+func (stats *iterateStats) print() {
+	fmt.Fprintf(stdout, "iterate: avg: %v (n=%d)\n", stats.Avg, stats.N)
+	fmt.Fprintf(stdout, "iterate: %s\n", stats.Latency)
+	for _, r := range stats.Readers {
+		fmt.Fprintf(stdout, "reader %d: avg: %v (n=%d), p99: %v\n", r.Reader, r.Avg, r.N, r.Latency.P99)
+	}
+	if stats.KeyLatency != nil {
+		fmt.Fprintf(stdout, "key read: %s\n", stats.KeyLatency)
+	}
+	if stats.GetLatency != nil {
+		fmt.Fprintf(stdout, "get: %s\n", stats.GetLatency)
+	}
+	if stats.SeekLatency != nil {
+		fmt.Fprintf(stdout, "seek: %s\n", stats.SeekLatency)
+		fmt.Fprintf(stdout, "scan: %.0f keys/s\n", float64(stats.Keys)/stats.Total.Seconds())
+	}
+	for _, op := range sortedOps(stats.OpLatency) {
+		fmt.Fprintf(stdout, "%s: %s\n", op, stats.OpLatency[op])
+	}
+}
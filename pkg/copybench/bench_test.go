@@ -0,0 +1,179 @@
+package copybench
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// The benchmarks run the scenario in $COPYBENCH_CONFIG, or the default
+// scenario, under go test -bench, so results can be compared with benchstat
+// and the rest of the standard performance tooling. The database is the one
+// at $COPYBENCH_DB, seeded with the same scenario, or one seeded once per
+// process in a temporary directory which closeBenchmarks removes.
+var gobench struct {
+	once sync.Once
+	eng  engine
+	cfg  *Config
+	dir  string
+	err  error
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if err := closeBenchmarks(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if code == 0 {
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// benchEngine returns the engine shared by the benchmarks, opening it on
+// first use.
+func benchEngine(b *testing.B) (engine, *Config) {
+	gobench.once.Do(func() {
+		gobench.eng, gobench.cfg, gobench.err = openBenchEngine()
+	})
+	if gobench.err != nil {
+		b.Fatal(gobench.err)
+	}
+	return gobench.eng, gobench.cfg
+}
+
+func openBenchEngine() (engine, *Config, error) {
+	cfg := defaultConfig()
+	if path := os.Getenv("COPYBENCH_CONFIG"); path != "" {
+		if err := cfg.Load(path); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := cfg.prepare(); err != nil {
+		return nil, nil, err
+	}
+	SetOutput(ioutil.Discard)
+
+	path := os.Getenv("COPYBENCH_DB")
+	if path == "" {
+		dir, err := ioutil.TempDir("", "copybench-")
+		if err != nil {
+			return nil, nil, err
+		}
+		gobench.dir = dir
+		path = filepath.Join(dir, "bench.db")
+		if err := Seed(path, cfg); err != nil {
+			return nil, nil, err
+		}
+	}
+	eng, err := openEngine(path, false, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return eng, cfg, nil
+}
+
+// closeBenchmarks closes the database used by the benchmarks and removes it
+// if it was seeded for the process.
+func closeBenchmarks() error {
+	var err error
+	if gobench.eng != nil {
+		err = gobench.eng.Close()
+		gobench.eng = nil
+	}
+	if gobench.dir != "" {
+		if e := os.RemoveAll(gobench.dir); err == nil {
+			err = e
+		}
+		gobench.dir = ""
+	}
+	return err
+}
+
+// BenchmarkIterate times one pass of the iterate workload per op.
+func BenchmarkIterate(b *testing.B) {
+	eng, cfg := benchEngine(b)
+	bound := cfg.iterateBound(workloadIterate)
+	var keys int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n, err := eng.Scan(bound, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		keys += n
+	}
+	b.ReportMetric(float64(keys)/float64(b.N), "keys/op")
+}
+
+// BenchmarkCopy times one copy of the database per op, to the scenario's copy
+// targets.
+func BenchmarkCopy(b *testing.B) {
+	eng, cfg := benchEngine(b)
+	size, err := eng.Size()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := dbcopy(eng, cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkIterateDuringCopy times one pass of the iterate workload per op
+// while the database is copied back to back in the background.
+func BenchmarkIterateDuringCopy(b *testing.B) {
+	eng, cfg := benchEngine(b)
+	bound := cfg.iterateBound(workloadIterate)
+
+	var copies int64
+	done := make(chan struct{})
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-done:
+				errc <- nil
+				return
+			default:
+			}
+			if _, err := dbcopy(eng, cfg); err != nil {
+				errc <- err
+				return
+			}
+			atomic.AddInt64(&copies, 1)
+		}
+	}()
+
+	// stopCopier stops the background copies and waits for the one in
+	// progress, so that none outlives the benchmark.
+	stopCopier := func() error {
+		close(done)
+		return <-errc
+	}
+
+	var keys int
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n, err := eng.Scan(bound, nil)
+		if err != nil {
+			b.StopTimer()
+			stopCopier()
+			b.Fatal(err)
+		}
+		keys += n
+	}
+	b.StopTimer()
+	if err := stopCopier(); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(keys)/float64(b.N), "keys/op")
+	b.ReportMetric(float64(atomic.LoadInt64(&copies))/float64(b.N), "copies/op")
+}
@@ -0,0 +1,74 @@
+package copybench
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"runtime"
+)
+
+// writeBenchstat writes the result to path in the Go benchmark format read by
+// benchstat. It is a no-op if path is empty. Warm-up passes are not reported.
+func (r *Result) writeBenchstat(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "goos: %s\n", runtime.GOOS)
+	fmt.Fprintf(&buf, "goarch: %s\n", runtime.GOARCH)
+	fmt.Fprintf(&buf, "pkg: github.com/boltdb/copy-bench\n")
+	fmt.Fprintf(&buf, "items: %d\n", r.Config.ItemCount)
+	fmt.Fprintf(&buf, "value-size: %d\n", r.Config.ValueSize)
+	if r.Config.ValueDistribution != valueFixed {
+		fmt.Fprintf(&buf, "value-distribution: %s\n", r.Config.ValueDistribution)
+	}
+
+	procs := runtime.GOMAXPROCS(0)
+	for _, p := range r.Phases {
+		if p.Name == phaseWarmup {
+			continue
+		}
+
+		// The compact-copy phase's benchmarks are kept apart from those of
+		// the copy and compact phases.
+		var during, duringCopy string
+		if p.Name == phaseCompactCopy {
+			during, duringCopy = "DuringCompact", "DuringCopy"
+		}
+
+		if p.Iterate != nil && p.Iterate.N > 0 {
+			name := "Iterate"
+			if len(p.Copies) > 0 {
+				name = "IterateDuringCopy"
+			}
+			if p.Name == phaseCompactCopy {
+				name = "IterateDuringCompactCopy"
+			}
+			fmt.Fprintf(&buf, "Benchmark%s-%d\t%d\t%d ns/op\t%d keys/op\n",
+				name, procs, p.Iterate.N, int64(p.Iterate.Avg), p.Iterate.Keys/p.Iterate.N)
+		}
+
+		for _, c := range p.Copies {
+			var mbps float64
+			if c.Duration > 0 {
+				mbps = float64(c.Bytes) / 1e6 / c.Duration.Seconds()
+			}
+			name := "Copy"
+			if c.Method == copyMethodWriteTo {
+				name = "WriteTo"
+			}
+			fmt.Fprintf(&buf, "Benchmark%s%s-%d\t1\t%d ns/op\t%.2f MB/s\n", name, during, procs, int64(c.Duration), mbps)
+		}
+
+		if c := p.Compact; c != nil {
+			fmt.Fprintf(&buf, "BenchmarkCompact%s-%d\t1\t%d ns/op\t%d B\n", duringCopy, procs, int64(c.Duration), c.CompactedSize)
+		}
+
+		for _, rs := range p.Restores {
+			fmt.Fprintf(&buf, "BenchmarkRestore-%d\t1\t%d ns/op\t%d keys/op\n", procs, int64(rs.Duration), rs.Keys)
+		}
+	}
+
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
@@ -0,0 +1,64 @@
+package copybench
+
+import (
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// statsSnapshot holds the database and bucket stats at a point in time.
+type statsSnapshot struct {
+	db     bolt.Stats
+	bucket bolt.BucketStats
+}
+
+// statsDelta is the change in bolt's internal counters over a phase. Freelist
+// and open transaction counts in DB are the values at the end of the phase.
+type statsDelta struct {
+	DB     bolt.Stats       `json:"db"`
+	Bucket bolt.BucketStats `json:"bucket"`
+}
+
+// snapshotStats captures the current stats. Bucket stats are summed over every
+// top-level bucket, and are zero if there are none yet.
+func snapshotStats(db *bolt.DB) (*statsSnapshot, error) {
+	s := &statsSnapshot{db: db.Stats()}
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(_ []byte, b *bolt.Bucket) error {
+			s.bucket.Add(b.Stats())
+			return nil
+		})
+	})
+	return s, err
+}
+
+// sub returns the change from prev to s.
+func (s *statsSnapshot) sub(prev *statsSnapshot) *statsDelta {
+	a, b := s.bucket, prev.bucket
+	return &statsDelta{
+		DB: s.db.Sub(&prev.db),
+		Bucket: bolt.BucketStats{
+			BranchPageN:       a.BranchPageN - b.BranchPageN,
+			BranchOverflowN:   a.BranchOverflowN - b.BranchOverflowN,
+			LeafPageN:         a.LeafPageN - b.LeafPageN,
+			LeafOverflowN:     a.LeafOverflowN - b.LeafOverflowN,
+			KeyN:              a.KeyN - b.KeyN,
+			Depth:             a.Depth - b.Depth,
+			BranchAlloc:       a.BranchAlloc - b.BranchAlloc,
+			BranchInuse:       a.BranchInuse - b.BranchInuse,
+			LeafAlloc:         a.LeafAlloc - b.LeafAlloc,
+			LeafInuse:         a.LeafInuse - b.LeafInuse,
+			BucketN:           a.BucketN - b.BucketN,
+			InlineBucketN:     a.InlineBucketN - b.InlineBucketN,
+			InlineBucketInuse: a.InlineBucketInuse - b.InlineBucketInuse,
+		},
+	}
+}
+
+// String summarizes the most relevant counters on a single line.
+func (d *statsDelta) String() string {
+	tx := d.DB.TxStats
+	return fmt.Sprintf("read tx: %d, page alloc: %d (%d bytes), nodes: %d, rebalance: %d, split: %d, spill: %d, write: %d, leaf pages: %+d, branch pages: %+d",
+		d.DB.TxN, tx.PageCount, tx.PageAlloc, tx.NodeCount, tx.Rebalance, tx.Split, tx.Spill, tx.Write,
+		d.Bucket.LeafPageN, d.Bucket.BranchPageN)
+}
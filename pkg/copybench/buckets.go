@@ -0,0 +1,128 @@
+package copybench
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+)
+
+// bucketKey returns the name of the top-level bucket holding the key with
+// index i. A single-bucket dataset is stored in bucketName; otherwise keys are
+// spread round-robin across buckets named root-0, root-1 and so on.
+func (c *Config) bucketKey(i int) []byte {
+	if c.Buckets == 1 {
+		return bucketName
+	}
+	return []byte(fmt.Sprintf("%s-%d", bucketName, i%c.Buckets))
+}
+
+// leaves returns the number of leaf buckets under each top-level bucket.
+func (c *Config) leaves() int {
+	n := 1
+	for d := 0; d < c.NestDepth; d++ {
+		n *= c.NestFanout
+	}
+	return n
+}
+
+// leafPath returns the names of the nested buckets leading from a top-level
+// bucket to its leaf with index l. Each level's buckets are named after their
+// position among their siblings.
+func (c *Config) leafPath(l int) [][]byte {
+	path := make([][]byte, c.NestDepth)
+	for d := c.NestDepth - 1; d >= 0; d-- {
+		path[d] = []byte(strconv.Itoa(l % c.NestFanout))
+		l /= c.NestFanout
+	}
+	return path
+}
+
+// leaf returns the leaf with index l under the top-level bucket b, or nil if
+// it doesn't exist.
+func (c *Config) leaf(b *bolt.Bucket, l int) *bolt.Bucket {
+	for _, name := range c.leafPath(l) {
+		if b == nil {
+			return nil
+		}
+		b = b.Bucket(name)
+	}
+	return b
+}
+
+// bucket returns the bucket holding the key with index i. Without nesting
+// this is its top-level bucket; otherwise keys are spread round-robin across
+// the leaves of the top-level bucket's tree.
+func (c *Config) bucket(tx *bolt.Tx, i int) *bolt.Bucket {
+	b := tx.Bucket(c.bucketKey(i))
+	if c.NestDepth == 0 || b == nil {
+		return b
+	}
+	return c.leaf(b, (i/c.Buckets)%c.leaves())
+}
+
+// seedBucket is like bucket, but sets the bucket's fill percent for seeding.
+func (c *Config) seedBucket(tx *bolt.Tx, i int) *bolt.Bucket {
+	b := c.bucket(tx, i)
+	if c.FillPercent != 0 {
+		b.FillPercent = c.FillPercent
+	}
+	return b
+}
+
+// buckets returns every top-level bucket of the dataset, so that key i is
+// held by the bucket at index i%len or one of its nested buckets.
+func (c *Config) buckets(tx *bolt.Tx) ([]*bolt.Bucket, error) {
+	a := make([]*bolt.Bucket, c.Buckets)
+	for i := range a {
+		if a[i] = tx.Bucket(c.bucketKey(i)); a[i] == nil {
+			return nil, fmt.Errorf("bucket not found: %s", c.bucketKey(i))
+		}
+		if c.NestDepth > 0 && c.leaf(a[i], 0) == nil {
+			return nil, fmt.Errorf("nested bucket not found in %s", c.bucketKey(i))
+		}
+	}
+	return a, nil
+}
+
+// checkBuckets returns an error if db is missing any of the dataset's buckets.
+func (c *Config) checkBuckets(db *bolt.DB) error {
+	return db.View(func(tx *bolt.Tx) error {
+		_, err := c.buckets(tx)
+		return err
+	})
+}
+
+// createBuckets is like buckets but creates any buckets that don't exist,
+// including the nested bucket tree under each top-level bucket.
+func (c *Config) createBuckets(tx *bolt.Tx) ([]*bolt.Bucket, error) {
+	a := make([]*bolt.Bucket, c.Buckets)
+	for i := range a {
+		b, err := tx.CreateBucketIfNotExists(c.bucketKey(i))
+		if err != nil {
+			return nil, fmt.Errorf("create bucket: %s", err)
+		}
+		if err := c.createTree(b, c.NestDepth); err != nil {
+			return nil, err
+		}
+		a[i] = b
+	}
+	return a, nil
+}
+
+// createTree creates depth levels of nested buckets under b.
+func (c *Config) createTree(b *bolt.Bucket, depth int) error {
+	if depth == 0 {
+		return nil
+	}
+	for j := 0; j < c.NestFanout; j++ {
+		child, err := b.CreateBucketIfNotExists([]byte(strconv.Itoa(j)))
+		if err != nil {
+			return fmt.Errorf("create bucket: %s", err)
+		}
+		if err := c.createTree(child, depth-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package copybench
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// statsMain prints the shape of every top-level bucket of the database, from
+// Bucket.Stats.
+func statsMain(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	cfg := defaultConfig()
+	out := fs.String("o", "", "write results as JSON to `FILE`")
+	path, err := parseFlags(fs, args, cfg)
+	if err != nil {
+		return err
+	}
+	if err := requireBolt(cfg, "stats"); err != nil {
+		return err
+	}
+
+	db, err := open(path, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	res := newResult("stats", path, cfg)
+	if res.Size, err = size(db); err != nil {
+		return err
+	}
+	if res.Buckets, err = bucketStats(db); err != nil {
+		return err
+	}
+	for _, s := range res.Buckets.Buckets {
+		fmt.Fprintf(stdout, "%s: %s\n", s.Name, s)
+	}
+	fmt.Fprintf(stdout, "total: %s\n", res.Buckets.Total)
+	return res.save(*out)
+}
+
+// datasetStats describes the shape of the dataset: the stats of every
+// top-level bucket, including the buckets nested in it, and their sum.
+type datasetStats struct {
+	Buckets []*bucketShape `json:"buckets"`
+	Total   *bucketShape   `json:"total"`
+}
+
+// bucketShape summarizes the stats of a bucket and the buckets nested in it.
+// Depth is the number of levels of its B+tree, and BranchFill and LeafFill
+// are the fractions of the allocated branch and leaf pages in use.
+type bucketShape struct {
+	Name          string  `json:"name,omitempty"`
+	Keys          int     `json:"keys"`
+	Depth         int     `json:"depth"`
+	BranchPages   int     `json:"branch_pages"`
+	LeafPages     int     `json:"leaf_pages"`
+	OverflowPages int     `json:"overflow_pages"`
+	Buckets       int     `json:"buckets"`
+	InlineBuckets int     `json:"inline_buckets"`
+	BranchFill    float64 `json:"branch_fill"`
+	LeafFill      float64 `json:"leaf_fill"`
+}
+
+// newBucketShape returns the shape described by s.
+func newBucketShape(name string, s bolt.BucketStats) *bucketShape {
+	return &bucketShape{
+		Name:          name,
+		Keys:          s.KeyN,
+		Depth:         s.Depth,
+		BranchPages:   s.BranchPageN,
+		LeafPages:     s.LeafPageN,
+		OverflowPages: s.BranchOverflowN + s.LeafOverflowN,
+		Buckets:       s.BucketN,
+		InlineBuckets: s.InlineBucketN,
+		BranchFill:    fill(s.BranchInuse, s.BranchAlloc),
+		LeafFill:      fill(s.LeafInuse, s.LeafAlloc),
+	}
+}
+
+// fill returns the fraction of alloc bytes in use, or zero if none are
+// allocated.
+func fill(inuse, alloc int) float64 {
+	if alloc == 0 {
+		return 0
+	}
+	return float64(inuse) / float64(alloc)
+}
+
+// String summarizes the shape on a single line.
+func (s *bucketShape) String() string {
+	return fmt.Sprintf("%d keys, depth %d, %d branch pages (%.1f%% full), %d leaf pages (%.1f%% full), %d overflow pages, %d buckets (%d inline)",
+		s.Keys, s.Depth, s.BranchPages, s.BranchFill*100, s.LeafPages, s.LeafFill*100, s.OverflowPages, s.Buckets, s.InlineBuckets)
+}
+
+// bucketStats returns the shape of the dataset in db.
+func bucketStats(db *bolt.DB) (*datasetStats, error) {
+	ds := &datasetStats{}
+	var total bolt.BucketStats
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			s := b.Stats()
+			ds.Buckets = append(ds.Buckets, newBucketShape(string(name), s))
+			total.Add(s)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	ds.Total = newBucketShape("", total)
+	return ds, nil
+}
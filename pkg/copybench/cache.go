@@ -0,0 +1,37 @@
+package copybench
+
+import (
+	"fmt"
+	"time"
+)
+
+// dropCaches closes the database, evicts its files from the OS page cache and
+// opens it again, so that the next phase starts with a cold cache. The kernel
+// doesn't evict pages that are still memory mapped, so the database can't
+// stay open.
+func (b *bench) dropCaches() error {
+	t := time.Now()
+	if err := b.close(); err != nil {
+		return err
+	}
+	method, err := evictCache(b.path)
+	if err != nil {
+		return err
+	}
+
+	eng, err := openEngine(b.path, false, b.cfg)
+	if err != nil {
+		return err
+	}
+	b.eng, b.db = eng, boltDB(eng)
+	fl, _ := eng.(freelister)
+	b.throughput.watch(fl)
+	b.reader, b.readerDB = b.eng, b.db
+	if b.cfg.SeparateReader && !b.cfg.ReaderProcess {
+		if err := b.openReader(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(stdout, "dropped page cache (%s) in %v\n", method, time.Since(t))
+	return nil
+}
@@ -0,0 +1,54 @@
+package copybench
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// canDropCaches reports whether evictCache is supported.
+const canDropCaches = true
+
+// oDirect opens files so that their writes bypass the page cache.
+const oDirect = syscall.O_DIRECT
+
+// canFadvise reports whether dropRange is supported.
+const canFadvise = true
+
+// dropRange writes back the n bytes of f at off and then drops them from the
+// page cache with fadvise(FADV_DONTNEED), which skips dirty pages.
+func dropRange(f *os.File, off, n int64) error {
+	const flags = unix.SYNC_FILE_RANGE_WAIT_BEFORE | unix.SYNC_FILE_RANGE_WRITE | unix.SYNC_FILE_RANGE_WAIT_AFTER
+	if err := unix.SyncFileRange(int(f.Fd()), off, n, flags); err != nil {
+		return err
+	}
+	return unix.Fadvise(int(f.Fd()), off, n, unix.FADV_DONTNEED)
+}
+
+// evictCache evicts the files under path from the page cache and returns the
+// method used. With sufficient privileges it drops the whole page cache
+// through /proc/sys/vm/drop_caches; otherwise it asks the kernel to drop each
+// file's pages with fadvise(FADV_DONTNEED). Dirty pages are written back
+// first, as neither evicts them.
+func evictCache(path string) (string, error) {
+	syscall.Sync()
+	if err := ioutil.WriteFile("/proc/sys/vm/drop_caches", []byte("1"), 0); err == nil {
+		return "drop_caches", nil
+	}
+
+	err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+	})
+	return "fadvise", err
+}
@@ -0,0 +1,28 @@
+//go:build !linux
+// +build !linux
+
+package copybench
+
+import (
+	"fmt"
+	"os"
+)
+
+// canDropCaches reports whether evictCache is supported.
+const canDropCaches = false
+
+// oDirect is zero where O_DIRECT is not supported.
+const oDirect = 0
+
+// canFadvise reports whether dropRange is supported.
+const canFadvise = false
+
+// dropRange is only supported on Linux.
+func dropRange(f *os.File, off, n int64) error {
+	return fmt.Errorf("only supported on Linux")
+}
+
+// evictCache is only supported on Linux.
+func evictCache(path string) (string, error) {
+	return "", fmt.Errorf("only supported on Linux")
+}
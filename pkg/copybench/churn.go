@@ -0,0 +1,88 @@
+package copybench
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// churnStats describes the deletions and reinsertions of the churn phase.
+type churnStats struct {
+	Keys     int           `json:"keys"`
+	Txs      int           `json:"txs"`
+	Deletes  time.Duration `json:"deletes"`
+	Inserts  time.Duration `json:"inserts"`
+	Duration time.Duration `json:"duration"`
+}
+
+// String summarizes the churn on a single line.
+func (s *churnStats) String() string {
+	return fmt.Sprintf("%d keys deleted in %v and reinserted in %v (%d txs)", s.Keys, s.Deletes, s.Inserts, s.Txs)
+}
+
+// churn fragments the database by deleting churn_pct of the keys, picked at
+// random, in batches of BatchSize, and then reinserting them in another random
+// order. The reinserted values are new values of the scenario's distribution,
+// so that the database still holds the whole dataset.
+func churn(db *bolt.DB, cfg *Config) (*churnStats, error) {
+	r := newRand(cfg, streamChurn)
+	keys := r.Perm(cfg.ItemCount)[:int(float64(cfg.ItemCount)*cfg.ChurnPct)]
+	s := &churnStats{Keys: len(keys)}
+
+	t := time.Now()
+	err := churnBatches(db, cfg, keys, s, func(b *bolt.Bucket, k []byte) error {
+		return b.Delete(k)
+	})
+	if err == errInterrupted {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("churn: delete: %s", err)
+	}
+	s.Deletes = time.Since(t)
+
+	r.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	t = time.Now()
+	err = churnBatches(db, cfg, keys, s, func(b *bolt.Bucket, k []byte) error {
+		v := make([]byte, cfg.valueSize(r))
+		cfg.fillValue(k, v)
+		return b.Put(k, v)
+	})
+	if err == errInterrupted {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("churn: put: %s", err)
+	}
+	s.Inserts = time.Since(t)
+	s.Duration = s.Deletes + s.Inserts
+	return s, nil
+}
+
+// churnBatches calls fn with the bucket and key of each of keys, in
+// transactions of up to BatchSize keys.
+func churnBatches(db *bolt.DB, cfg *Config, keys []int, s *churnStats, fn func(b *bolt.Bucket, k []byte) error) error {
+	for i := 0; i < len(keys); i += cfg.BatchSize {
+		if isInterrupted() {
+			return errInterrupted
+		}
+		batch := keys[i:]
+		if len(batch) > cfg.BatchSize {
+			batch = batch[:cfg.BatchSize]
+		}
+		err := db.Update(func(tx *bolt.Tx) error {
+			for _, n := range batch {
+				k := make([]byte, cfg.KeySize)
+				cfg.encodeKey(k, n)
+				if err := fn(cfg.bucket(tx, n), k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		s.Txs++
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package copybench
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// bucketName is the name of the bucket that holds the benchmark dataset, or the
+// prefix of the bucket names if it is spread across several.
+var bucketName = []byte("root")
+
+// stdout receives the human-readable results. It is replaced while the
+// terminal dashboard is running.
+var stdout io.Writer = os.Stdout
+
+// errUsage is returned by a command when it is invoked with invalid arguments.
+var errUsage = errors.New("usage")
+
+// command is a single copy-bench subcommand.
+type command struct {
+	name  string
+	usage string
+	short string
+	run   func(args []string) error
+}
+
+var commands = []*command{
+	{"seed", "seed [-config FILE] [-nosync] [-resume] [-memory-csv FILE] [-o FILE] PATH", "populate a new database with the benchmark dataset", seedMain},
+	{"bench", "bench [-config FILE] [-copy-dest PATH] [-copy-buffer BYTES] [-copy-rate MB/s] [-compress NAME] [-o FILE] [-benchstat FILE] [-csv FILE] [-memory-csv FILE] [-throughput-csv FILE] [-html FILE] [-metrics-addr ADDR] [-control-addr ADDR] [-web-addr ADDR] [-influx-url URL [-influx-interval D]] [-otlp-endpoint URL] [-statsd-addr ADDR [-statsd-plain]] [-tui] [-key-latency] [-iostat] [-workload NAME] [-key-dist NAME] [-mix READ:WRITE] [-reps N] [-warmup N|D] [-duration D] [-cpuprofile FILE] [-memprofile FILE] [-blockprofile FILE] [-mutexprofile FILE] [-trace FILE] [-profile-phases] [-save-baseline FILE] [-compare-baseline FILE [-threshold PCT]] PATH", "run the iterate and iterate-during-copy benchmark", benchMain},
+	{"copy", "copy [-config FILE] [-o FILE] [-benchstat FILE] [-cpuprofile FILE] [-memprofile FILE] [-blockprofile FILE] [-mutexprofile FILE] [-trace FILE] [-copy-dest PATH] [-copy-buffer BYTES] [-copy-rate MB/s] [-compress NAME] PATH", "time a single copy of the database", copyMain},
+	{"verify", "verify [-config FILE] PATH", "check that the database holds the expected dataset", verifyMain},
+	{"report", "report [-config FILE] [-runs [-command NAME] [-engine NAME] [-host NAME] [-module VERSION] [-limit N]] PATH", "print stats about the database, or list the runs of a results database", reportMain},
+	{"stats", "stats [-config FILE] [-o FILE] PATH", "print the shape of every bucket", statsMain},
+	{"serve", "serve [-config FILE] [-addr ADDR] [-count N] [-o FILE] PATH", "serve copies over HTTP while iterating", serveMain},
+	{"fetch", "fetch [-rate MB/s] [-dest PATH] URL", "download a copy from a serve command", fetchMain},
+	{"soak", "soak [-config FILE] [-mix READ:WRITE] [-interval D] [-duration D] [-csv FILE] [-o FILE] [-copy-dest PATH] PATH", "copy periodically under mixed load and track drift", soakMain},
+	{"reader", "reader [-phase NAME] [-passes N] [-key-latency] PATH", "run a bench phase's readers for a parent with reader_process", readerMain},
+	{"worker", "worker [-addr ADDR] PATH", "serve the worker API for a coordinator", workerMain},
+	{"coordinate", "coordinate [-config FILE] [-duration D] [-copy-count N] [-interval D] [-o FILE] ROLE=ADDR,...", "run the benchmark across worker processes", coordinateMain},
+	{"sweep", "sweep [-config FILE] [-o FILE] [-keep] -sweep NAME=V1,V2,... DIR", "seed and bench every combination of parameters", sweepMain},
+}
+
+// Main runs the copy-bench command line with args, the arguments following
+// the program name, exiting the process if the command fails.
+func Main(args []string) {
+	log.SetFlags(0)
+	flag.Usage = usage
+	flag.CommandLine.Parse(args)
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
+	runtime.GOMAXPROCS(2)
+
+	name, args := flag.Arg(0), flag.Args()[1:]
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		if err := cmd.run(args); err == errUsage {
+			log.SetFlags(0)
+			log.Fatalf("usage: copy-bench %s", cmd.usage)
+		} else if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	log.SetFlags(0)
+	log.Fatalf("copy-bench: unknown command %q (run 'copy-bench -h' for usage)", name)
+}
+
+// usage prints the list of available commands.
+func usage() {
+	var lines []string
+	for _, cmd := range commands {
+		lines = append(lines, fmt.Sprintf("    %-8s %s", cmd.name, cmd.short))
+	}
+	fmt.Fprintf(os.Stderr, "usage: copy-bench COMMAND [arguments] PATH\n\ncommands:\n%s\n", strings.Join(lines, "\n"))
+}
+
+// parseFlags registers the flags shared by all commands, parses a command's
+// arguments into cfg, validates it and returns the database path. Flags bound
+// to cfg take precedence over the values of a scenario file given with
+// -config.
+func parseFlags(fs *flag.FlagSet, args []string, cfg *Config) (string, error) {
+	path, err := parseArgs(fs, args, cfg)
+	if err != nil {
+		return "", err
+	}
+	if err := cfg.prepare(); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// parseArgs is parseFlags without validating cfg, for commands that don't
+// run the scenario.
+func parseArgs(fs *flag.FlagSet, args []string, cfg *Config) (string, error) {
+	configPath := fs.String("config", "", "scenario `FILE`")
+	fs.StringVar(&cfg.Engine, "engine", cfg.Engine, "run against the storage engine `NAME`")
+	fs.IntVar(&cfg.PageSize, "page-size", cfg.PageSize, "create bbolt databases with `BYTES` pages")
+	fs.DurationVar(&cfg.OpenTimeout.Duration, "open-timeout", cfg.OpenTimeout.Duration, "wait at most `D` for the database's file lock (0 waits indefinitely)")
+	fs.IntVar(&cfg.InitialMmapSize, "initial-mmap-size", cfg.InitialMmapSize, "memory map `BYTES` of bolt databases when they are opened")
+	fs.BoolVar(&cfg.NoGrowSync, "no-grow-sync", cfg.NoGrowSync, "don't truncate and fsync bolt databases as they grow")
+	fs.BoolVar(&cfg.MmapPopulate, "mmap-populate", cfg.MmapPopulate, "prefault bolt databases into memory with MAP_POPULATE when they are opened")
+	fs.BoolVar(&cfg.NoFreelistSync, "no-freelist-sync", cfg.NoFreelistSync, "don't persist bbolt's freelist on commit")
+	fs.StringVar(&cfg.FreelistType, "freelist-type", cfg.FreelistType, "use bbolt's `TYPE` freelist (array or hashmap)")
+	fs.IntVar(&cfg.KeyPrefixes, "key-prefixes", cfg.KeyPrefixes, "seed composite keys with `N` distinct prefixes")
+	fs.IntVar(&cfg.Buckets, "buckets", cfg.Buckets, "spread the keys across `N` top-level buckets")
+	fs.IntVar(&cfg.NestDepth, "nest-depth", cfg.NestDepth, "nest the keys `N` levels of buckets deep")
+	fs.IntVar(&cfg.NestFanout, "nest-fanout", cfg.NestFanout, "create `N` child buckets per nested bucket")
+	fs.Float64Var(&cfg.FillPercent, "fill-percent", cfg.FillPercent, "fill pages to `FRACTION` before splitting them while seeding (0 for bolt's default)")
+	fs.StringVar(&cfg.InsertOrder, "insert-order", cfg.InsertOrder, "seed the keys in `ORDER` (sequential, random or reverse)")
+	fs.BoolVar(&cfg.ChecksumValues, "checksum-values", cfg.ChecksumValues, "fill values with a checksum of their key and check it on every read")
+	fs.Int64Var(&cfg.Seed, "seed", cfg.Seed, "seed random workloads with `N` (0 picks one)")
+	fs.StringVar(&cfg.ResultsDB, "results-db", cfg.ResultsDB, "append the results of the run to the SQLite `FILE`")
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 1 {
+		return "", errUsage
+	}
+
+	if *configPath != "" {
+		if err := cfg.Load(*configPath); err != nil {
+			return "", err
+		}
+
+		// Parse again so that explicit flags override the file.
+		if err := fs.Parse(args); err != nil {
+			return "", err
+		}
+	}
+	return fs.Arg(0), nil
+}
+
+// prepare validates the scenario and picks its seed if it has none.
+func (c *Config) prepare() error {
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("config: %s", err)
+	}
+	if c.Seed == 0 {
+		c.Seed = time.Now().UnixNano()
+		log.Printf("seed: %d", c.Seed)
+	}
+	return nil
+}
+
+// open opens the database at path. An existing database is required unless
+// create is set, in which case the database must not exist yet.
+func open(path string, create bool) (*bolt.DB, error) {
+	if err := checkPath(path, create); err != nil {
+		return nil, err
+	}
+	return bolt.Open(path, 0600, nil)
+}
+
+// checkPath returns an error if the database at path is missing, or if it
+// exists and create is set.
+func checkPath(path string, create bool) error {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) && !create {
+		return fmt.Errorf("database not found: %s (run 'copy-bench seed' first)", path)
+	} else if err == nil && create {
+		return fmt.Errorf("database already exists: %s", path)
+	}
+	return nil
+}
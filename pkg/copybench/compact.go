@@ -0,0 +1,214 @@
+package copybench
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// compactTxSize is the number of bytes of keys and values written to the
+// compacted database per transaction, as with bolt's compact command.
+const compactTxSize = 64 << 10
+
+// compactStats describes a compaction of the database into a fresh one.
+type compactStats struct {
+	Target   string        `json:"target"`
+	Duration time.Duration `json:"duration"`
+	Txs      int           `json:"txs"`
+
+	// Size and CompactedSize are the sizes of the database and of its
+	// compacted copy.
+	Size          int64 `json:"size"`
+	CompactedSize int64 `json:"compacted_size"`
+}
+
+// Reduction returns the percentage by which compaction shrank the database.
+func (s *compactStats) Reduction() float64 {
+	if s.Size == 0 {
+		return 0
+	}
+	return (1 - float64(s.CompactedSize)/float64(s.Size)) * 100
+}
+
+// String summarizes the compaction on a single line.
+func (s *compactStats) String() string {
+	return fmt.Sprintf("%v (%s, %d -> %d bytes, %.1f%% smaller, %d txs)",
+		s.Duration, s.Target, s.Size, s.CompactedSize, s.Reduction(), s.Txs)
+}
+
+// compactCopyStats compares the mean durations of compactions and copies run
+// at the same time by the compact-copy phase with those of the compact and
+// copy phases, which are zero if the scenario doesn't include them.
+type compactCopyStats struct {
+	Copy         time.Duration `json:"copy"`
+	CopyAlone    time.Duration `json:"copy_alone,omitempty"`
+	Compact      time.Duration `json:"compact"`
+	CompactAlone time.Duration `json:"compact_alone,omitempty"`
+}
+
+// compactCopy returns the durations of the compact-copy phases against those
+// of the compact and copy phases, pooling every repetition, or nil if r has
+// no compact-copy phase.
+func (r *Result) compactCopy() *compactCopyStats {
+	var copies, copiesAlone, compacts, compactsAlone []time.Duration
+	for _, p := range r.Phases {
+		switch p.Name {
+		case phaseCopy:
+			for _, c := range p.Copies {
+				copiesAlone = append(copiesAlone, c.Duration)
+			}
+		case phaseCompact:
+			compactsAlone = append(compactsAlone, p.Compact.Duration)
+		case phaseCompactCopy:
+			for _, c := range p.Copies {
+				copies = append(copies, c.Duration)
+			}
+			compacts = append(compacts, p.Compact.Duration)
+		}
+	}
+	if len(compacts) == 0 {
+		return nil
+	}
+	return &compactCopyStats{
+		Copy:         meanDuration(copies),
+		CopyAlone:    meanDuration(copiesAlone),
+		Compact:      meanDuration(compacts),
+		CompactAlone: meanDuration(compactsAlone),
+	}
+}
+
+// print reports how much compaction and copies slow each other down.
+func (s *compactCopyStats) print() {
+	line := func(name string, d, alone time.Duration) {
+		if alone == 0 {
+			fmt.Fprintf(stdout, "  %s: %v\n", name, d)
+			return
+		}
+		fmt.Fprintf(stdout, "  %s: %v (alone: %v, %+.1f%%)\n", name, d, alone, (float64(d)/float64(alone)-1)*100)
+	}
+	fmt.Fprintln(stdout, "compaction and copy at once")
+	line("copy", s.Copy, s.CopyAlone)
+	line("compact", s.Compact, s.CompactAlone)
+	fmt.Fprintln(stdout, "")
+}
+
+// compact rewrites every bucket, key and value of db into a fresh database
+// at path, read in a single transaction and written in transactions of up to
+// compactTxSize bytes, like bolt's compact command.
+func compact(db *bolt.DB, path string) (*compactStats, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	t := time.Now()
+	dst, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("compact: %s", err)
+	}
+	defer dst.Close()
+
+	s := &compactStats{Target: path}
+	c := &compactor{dst: dst, stats: s}
+	err = db.View(func(tx *bolt.Tx) error {
+		s.Size = tx.Size()
+		if err := c.begin(); err != nil {
+			return err
+		}
+		err := tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			return c.walk(b, [][]byte{name})
+		})
+		if err != nil {
+			c.tx.Rollback()
+			return err
+		}
+		return c.commit()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("compact: %s", err)
+	}
+	if err := dst.Close(); err != nil {
+		return nil, fmt.Errorf("compact: %s", err)
+	}
+	s.Duration = time.Since(t)
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	s.CompactedSize = fi.Size()
+	return s, nil
+}
+
+// compactor writes the compacted database, committing its write transaction
+// every compactTxSize bytes.
+type compactor struct {
+	dst   *bolt.DB
+	tx    *bolt.Tx
+	size  int
+	stats *compactStats
+}
+
+// begin starts the next write transaction.
+func (c *compactor) begin() error {
+	tx, err := c.dst.Begin(true)
+	if err != nil {
+		return err
+	}
+	c.tx, c.size = tx, 0
+	return nil
+}
+
+// commit commits the current write transaction.
+func (c *compactor) commit() error {
+	c.stats.Txs++
+	return c.tx.Commit()
+}
+
+// walk copies the bucket b, found at path in the source database, and every
+// bucket nested in it.
+func (c *compactor) walk(b *bolt.Bucket, path [][]byte) error {
+	if _, err := c.bucket(path[:len(path)-1], path[len(path)-1]); err != nil {
+		return err
+	}
+	cur := b.Cursor()
+	for k, v := cur.First(); k != nil; k, v = cur.Next() {
+		if v == nil {
+			if err := c.walk(b.Bucket(k), append(path[:len(path):len(path)], k)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if c.size += len(k) + len(v); c.size > compactTxSize {
+			if err := c.commit(); err != nil {
+				return err
+			}
+			if err := c.begin(); err != nil {
+				return err
+			}
+			c.size = len(k) + len(v)
+		}
+		dst, err := c.bucket(path[:len(path)-1], path[len(path)-1])
+		if err != nil {
+			return err
+		}
+		if err := dst.Put(k, v); err != nil {
+			return fmt.Errorf("put: %s", err)
+		}
+	}
+	return nil
+}
+
+// bucket returns the bucket name nested in the buckets at parents in the
+// current transaction, creating it if it doesn't exist.
+func (c *compactor) bucket(parents [][]byte, name []byte) (*bolt.Bucket, error) {
+	if len(parents) == 0 {
+		return c.tx.CreateBucketIfNotExists(name)
+	}
+	b := c.tx.Bucket(parents[0])
+	for _, p := range parents[1:] {
+		b = b.Bucket(p)
+	}
+	return b.CreateBucketIfNotExists(name)
+}
@@ -0,0 +1,31 @@
+package copybench
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// compressors maps the names accepted by -compress to their constructors.
+var compressors = map[string]func(w io.Writer) (io.WriteCloser, error){
+	"gzip": func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+	"zstd": func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) },
+	"lz4":  func(w io.Writer) (io.WriteCloser, error) { return lz4.NewWriter(w), nil },
+	"snappy": func(w io.Writer) (io.WriteCloser, error) {
+		return snappy.NewBufferedWriter(w), nil
+	},
+}
+
+// newCompressor returns a writer that compresses to w with the named
+// algorithm. The writer must be closed to flush the compressed stream.
+func newCompressor(name string, w io.Writer) (io.WriteCloser, error) {
+	fn, ok := compressors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown compressor: %s", name)
+	}
+	return fn(w)
+}
@@ -0,0 +1,671 @@
+package copybench
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// Phase names accepted in a scenario's phase list.
+const (
+	phaseWarmup  = "warmup"  // untimed passes to push pages into memory
+	phaseIterate = "iterate" // iterate with no concurrent copy
+	phaseCopy    = "copy"    // iterate while the database is being copied
+
+	// phaseIncremental compares a page-level delta backup taken after
+	// incremental_writes random overwrites with a full copy.
+	phaseIncremental = "incremental"
+
+	// phaseRestore opens the files written by the last copy phase and reads
+	// every key, timing how long a restored backup takes to be usable.
+	phaseRestore = "restore"
+
+	// phaseCompact compacts the database into a fresh file while iterating.
+	phaseCompact = "compact"
+
+	// phaseCompactCopy compacts and copies the database at the same time
+	// while iterating.
+	phaseCompactCopy = "compact-copy"
+
+	// phaseChurn fragments the database by deleting and reinserting
+	// churn_pct of the keys.
+	phaseChurn = "churn"
+)
+
+// validPhase reports whether name is a bench phase.
+func validPhase(name string) bool {
+	switch name {
+	case phaseWarmup, phaseIterate, phaseCopy, phaseIncremental, phaseRestore, phaseCompact, phaseCompactCopy, phaseChurn:
+		return true
+	}
+	return false
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Workloads run by the reader during the bench phases. More are registered
+// with RegisterWorkload.
+const (
+	workloadIterate = "iterate" // scan the first iterate_pct of the keys
+	workloadReverse = "reverse" // scan the last iterate_pct of the keys backwards
+	workloadGet     = "get"     // look up get_count random keys
+	workloadPrefix  = "prefix"  // scan the keys of get_count random prefixes
+	workloadRange   = "range"   // scan range_length keys from get_count random keys
+)
+
+// validWorkload reports whether name is a registered reader workload.
+func validWorkload(name string) bool {
+	_, ok := workloads[name]
+	return ok
+}
+
+// usesWorkload reports whether any of the scenario's phases runs the named
+// reader workload.
+func (c *Config) usesWorkload(name string) bool {
+	for _, p := range c.Phases {
+		if c.workload(p) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// workload returns the reader workload of the named phase.
+func (c *Config) workload(phase string) string {
+	if w, ok := c.PhaseWorkloads[phase]; ok {
+		return w
+	}
+	return c.Workload
+}
+
+// copiesToFile reports whether any of the copy targets is a file rather than
+// an object store.
+func (c *Config) copiesToFile() bool {
+	for _, t := range c.CopyTargets {
+		if t != "" && !strings.Contains(t, "://") {
+			return true
+		}
+	}
+	return false
+}
+
+// Config describes a benchmark scenario. A scenario can be loaded from a TOML
+// file with the -config flag; any field left out keeps its default value.
+type Config struct {
+	// Engine names the storage engine the scenario runs against.
+	Engine string `toml:"engine" json:"engine"`
+
+	// NoSync seeds without fsyncing every commit, syncing the database once
+	// at the end instead. Only the bolt engines support it.
+	NoSync bool `toml:"nosync" json:"nosync"`
+
+	// NoFreelistSync skips writing the freelist to disk on commit, so that it
+	// is rebuilt by scanning the database when it is opened. FreelistType
+	// names bbolt's freelist implementation, array or hashmap, or is empty for
+	// its default. Only the bbolt engine supports them.
+	NoFreelistSync bool   `toml:"no_freelist_sync" json:"no_freelist_sync,omitempty"`
+	FreelistType   string `toml:"freelist_type" json:"freelist_type,omitempty"`
+
+	// InitialMmapSize is the size in bytes of the memory map the bolt engines
+	// open the database with, so that it doesn't need to grow as the database
+	// does. Zero maps only the current file.
+	InitialMmapSize int `toml:"initial_mmap_size" json:"initial_mmap_size,omitempty"`
+
+	// MmapPopulate memory maps the database with MAP_POPULATE, so that it is
+	// read into the page cache when opened rather than on first access. It is
+	// only supported by the bolt engines on Linux.
+	MmapPopulate bool `toml:"mmap_populate" json:"mmap_populate,omitempty"`
+
+	// NoGrowSync skips the truncate and fsync with which the bolt engines
+	// grow the database file, as Options.NoGrowSync. Preallocate extends a new
+	// database file to that many bytes before it is seeded. Zero lets it grow
+	// as it is written.
+	NoGrowSync  bool `toml:"no_grow_sync" json:"no_grow_sync,omitempty"`
+	Preallocate int  `toml:"preallocate" json:"preallocate,omitempty"`
+
+	// PageSize is the page size in bytes of new bbolt databases. Zero uses the
+	// OS page size, which bolt always does.
+	PageSize int `toml:"page_size" json:"page_size,omitempty"`
+
+	ItemCount  int     `toml:"item_count" json:"item_count"`
+	BatchSize  int     `toml:"batch_size" json:"batch_size"`
+	KeySize    int     `toml:"key_size" json:"key_size"`
+	ValueSize  int     `toml:"value_size" json:"value_size"`
+	IteratePct float64 `toml:"iterate_pct" json:"iterate_pct"`
+
+	// KeyPrefixes is the number of distinct prefixes of composite keys. Zero
+	// uses plain sequential keys.
+	KeyPrefixes int `toml:"key_prefixes" json:"key_prefixes"`
+
+	// Buckets is the number of top-level buckets the keys are spread across.
+	Buckets int `toml:"buckets" json:"buckets"`
+
+	// NestDepth is the number of levels of nested buckets under each
+	// top-level bucket, each with NestFanout children. Keys are held by the
+	// innermost buckets. Zero stores keys in the top-level buckets.
+	NestDepth  int `toml:"nest_depth" json:"nest_depth"`
+	NestFanout int `toml:"nest_fanout" json:"nest_fanout"`
+
+	// ValueDistribution names the distribution of the sizes of seeded and
+	// written values. ValueSizeMin and ValueSizeMax bound the uniform and
+	// lognormal distributions, ValueSizeSigma is the standard deviation of
+	// the logarithm of lognormal sizes, and ValueLargePct is the fraction of
+	// bimodal values that are ValueSizeMax rather than ValueSize bytes.
+	ValueDistribution string  `toml:"value_distribution" json:"value_distribution"`
+	ValueSizeMin      int     `toml:"value_size_min" json:"value_size_min,omitempty"`
+	ValueSizeMax      int     `toml:"value_size_max" json:"value_size_max,omitempty"`
+	ValueSizeSigma    float64 `toml:"value_size_sigma" json:"value_size_sigma,omitempty"`
+	ValueLargePct     float64 `toml:"value_large_pct" json:"value_large_pct,omitempty"`
+
+	// SeedMode names the seeding strategy: batched db.Update calls, or
+	// concurrent db.Batch calls.
+	SeedMode string `toml:"seed_mode" json:"seed_mode"`
+
+	// SeedWorkers is the number of goroutines putting keys with db.Batch in
+	// the batch seed mode. Zero starts one per key of a batch.
+	SeedWorkers int `toml:"seed_workers" json:"seed_workers,omitempty"`
+
+	// InsertOrder is the order in which the keys are seeded: sequential,
+	// random or reverse.
+	InsertOrder string `toml:"insert_order" json:"insert_order"`
+
+	// FillPercent is the fraction of each page filled before it is split
+	// while seeding, set as Bucket.FillPercent. Zero keeps bolt's default.
+	FillPercent float64 `toml:"fill_percent" json:"fill_percent,omitempty"`
+
+	// ChecksumValues fills every value with a checksum of its key, so that
+	// reads can detect corrupted or misplaced values.
+	ChecksumValues bool `toml:"checksum_values" json:"checksum_values,omitempty"`
+
+	// Workload names the read pattern used during the bench phases.
+	// PhaseWorkloads overrides it for individual phases.
+	Workload       string            `toml:"workload" json:"workload"`
+	PhaseWorkloads map[string]string `toml:"phase_workloads" json:"phase_workloads,omitempty"`
+
+	// WorkloadScript is the Starlark file run by the script workload.
+	WorkloadScript string `toml:"workload_script" json:"workload_script,omitempty"`
+
+	// GetCount is the number of random lookups per pass of the get workload,
+	// of scans per pass of the prefix and range workloads, or of operations
+	// per pass of a YCSB workload.
+	GetCount int `toml:"get_count" json:"get_count"`
+
+	// RangeLength is the number of keys read by each scan of the range
+	// workload.
+	RangeLength int `toml:"range_length" json:"range_length"`
+
+	// KeyDistribution names the distribution random keys are picked from by
+	// the get and mixed workloads and the incremental phase's overwrites.
+	KeyDistribution string `toml:"key_distribution" json:"key_distribution"`
+
+	// ZipfSkew is the skew of the zipfian key distribution, in (0, 1).
+	// Higher values concentrate more accesses on fewer keys.
+	ZipfSkew float64 `toml:"zipf_skew" json:"zipf_skew"`
+
+	// Seed seeds the random workloads. Zero picks a seed from the current
+	// time, which is recorded in the results so the run can be replayed.
+	Seed int64 `toml:"seed" json:"seed"`
+
+	// Readers is the number of concurrent readers run during the bench
+	// phases, each in its own goroutine.
+	Readers int `toml:"readers" json:"readers"`
+
+	// SeparateReader runs the readers against a second handle on the
+	// database, opened separately from the copier's. Both are opened
+	// read-only so that they can share the file lock, which rules out any
+	// writes. Only the bolt engines support it.
+	SeparateReader bool `toml:"separate_reader" json:"separate_reader,omitempty"`
+
+	// ReaderProcess runs the separate reader's handle and the readers in a
+	// child process, so that the copier and the readers share the database
+	// only through the page cache.
+	ReaderProcess bool `toml:"reader_process" json:"reader_process,omitempty"`
+
+	// DropCaches evicts the database from the OS page cache before every
+	// phase, so that each starts with a cold cache. It is only supported on
+	// Linux.
+	DropCaches bool `toml:"drop_caches" json:"drop_caches,omitempty"`
+
+	// Mix is a READ:WRITE ratio such as "95:5". If set, a mixed load of
+	// random reads and writes runs alongside the reader during every phase.
+	Mix string `toml:"mix" json:"mix,omitempty"`
+
+	// DeleteRate is the number of keys deleted per second during each of
+	// DeletePhases, in DeleteOrder. Zero disables deletion.
+	DeleteRate   float64  `toml:"delete_rate" json:"delete_rate,omitempty"`
+	DeleteOrder  string   `toml:"delete_order" json:"delete_order"`
+	DeletePhases []string `toml:"delete_phases" json:"delete_phases"`
+
+	// UpdateRate is the number of keys rewritten per second with new values
+	// of the same size during each of UpdatePhases. Zero disables updates.
+	UpdateRate   float64  `toml:"update_rate" json:"update_rate,omitempty"`
+	UpdatePhases []string `toml:"update_phases" json:"update_phases"`
+
+	// Phases lists the bench phases to run, in order.
+	Phases []string `toml:"phases" json:"phases"`
+
+	// Warmup is how long the warmup phase runs for, in passes or time.
+	Warmup warmup `toml:"warmup" json:"warmup"`
+
+	// IterateDuration is how long the iterate phase runs for.
+	IterateDuration duration `toml:"iterate_duration" json:"iterate_duration"`
+
+	// OpenTimeout bounds the wait for the file lock when the bolt and bbolt
+	// engines open the database. Zero waits indefinitely.
+	OpenTimeout duration `toml:"open_timeout" json:"open_timeout"`
+
+	// PhaseDuration, if nonzero, is how long both the iterate and copy phases
+	// run for, copying the database again and again during the copy phase.
+	PhaseDuration duration `toml:"phase_duration" json:"phase_duration,omitempty"`
+
+	// CopyCount is the number of copies the copy phase makes, starting one
+	// every CopyInterval, or as soon as the previous one completes if it took
+	// longer.
+	CopyCount    int      `toml:"copy_count" json:"copy_count,omitempty"`
+	CopyInterval duration `toml:"copy_interval" json:"copy_interval,omitempty"`
+
+	// SoakInterval is how often the soak command copies the database, and
+	// SoakDuration how long it runs for. Zero runs until interrupted.
+	SoakInterval duration `toml:"soak_interval" json:"soak_interval,omitempty"`
+	SoakDuration duration `toml:"soak_duration" json:"soak_duration,omitempty"`
+
+	// CopyTargets lists the files the database is copied to. An empty list
+	// copies to ioutil.Discard.
+	CopyTargets []string `toml:"copy_targets" json:"copy_targets"`
+
+	// CopyBufferSize is the size of the write buffer used when copying to a
+	// file. Zero writes straight to the file.
+	CopyBufferSize int `toml:"copy_buffer_size" json:"copy_buffer_size"`
+
+	// CopyRate limits the copy to this many megabytes per second of database
+	// pages read. Zero copies as fast as possible.
+	CopyRate float64 `toml:"copy_rate" json:"copy_rate"`
+
+	// CopyFsync makes copies to files durable by fsyncing them at the end of
+	// the copy, and also every CopyFsyncInterval bytes if that is set.
+	CopyFsync         bool `toml:"copy_fsync" json:"copy_fsync,omitempty"`
+	CopyFsyncInterval int  `toml:"copy_fsync_interval" json:"copy_fsync_interval,omitempty"`
+
+	// CopyFadvise drops the pages of copies to files from the page cache as
+	// they are written, so that the copy doesn't evict the source database.
+	// It is only supported on Linux.
+	CopyFadvise bool `toml:"copy_fadvise" json:"copy_fadvise,omitempty"`
+
+	// CopyDirect opens copies to files with O_DIRECT, so that the copy's
+	// writes bypass the page cache. It is only supported on Linux.
+	CopyDirect bool `toml:"copy_direct" json:"copy_direct,omitempty"`
+
+	// VerifyCopies reopens every copy to a file once it is complete, checks
+	// it and compares its contents with the source's at the time of the
+	// copy.
+	VerifyCopies bool `toml:"verify_copies" json:"verify_copies,omitempty"`
+
+	// VerifySnapshot rewrites a fixed set of keys with a new generation in
+	// every write transaction during the copy phase and checks that every
+	// copy to a file holds a single generation, committed while it ran.
+	VerifySnapshot bool `toml:"verify_snapshot" json:"verify_snapshot,omitempty"`
+
+	// CopyMethod names the bolt API used to copy the database, or "both" to
+	// compare Tx.Copy with Tx.WriteTo.
+	CopyMethod string `toml:"copy_method" json:"copy_method"`
+
+	// Copiers is the number of copies of the database made to each target at
+	// the same time, each in its own read transaction.
+	Copiers int `toml:"copiers" json:"copiers"`
+
+	// Compress names the algorithm the copy is compressed with, if any.
+	Compress string `toml:"compress" json:"compress,omitempty"`
+
+	// IncrementalWrites is the number of random keys overwritten between
+	// the full and delta copies of the incremental phase.
+	IncrementalWrites int `toml:"incremental_writes" json:"incremental_writes"`
+
+	// ChurnPct is the fraction of the keys the churn phase deletes and
+	// reinserts.
+	ChurnPct float64 `toml:"churn_pct" json:"churn_pct"`
+
+	// Reps is the number of times the iterate and copy phases are repeated.
+	Reps int `toml:"reps" json:"reps"`
+
+	// Sweep lists the parameter values benchmarked by the sweep command.
+	Sweep sweepConfig `toml:"sweep" json:"sweep"`
+
+	// ResultsDB is a SQLite file every run's results are appended to, for
+	// tracking them across versions and machines with report -runs.
+	ResultsDB string `toml:"results_db" json:"results_db,omitempty"`
+}
+
+// defaultConfig returns the scenario used when no config file is given.
+func defaultConfig() *Config {
+	return &Config{
+		Engine:            engineBolt,
+		ItemCount:         4000000,
+		BatchSize:         10000,
+		KeySize:           8,
+		ValueSize:         1024,
+		IteratePct:        0.2,
+		Buckets:           1,
+		NestFanout:        4,
+		ValueDistribution: valueFixed,
+		ValueSizeSigma:    1,
+		ValueLargePct:     0.1,
+		Workload:          workloadIterate,
+		GetCount:          1000,
+		RangeLength:       100,
+		Readers:           1,
+		Copiers:           1,
+		CopyMethod:        copyMethodCopy,
+		KeyDistribution:   distUniform,
+		ZipfSkew:          0.99,
+		DeleteOrder:       orderRandom,
+		DeletePhases:      []string{phaseCopy},
+		UpdatePhases:      []string{phaseCopy},
+		Phases:            []string{phaseWarmup, phaseIterate, phaseCopy},
+		Warmup:            warmup{Passes: 1},
+		IterateDuration:   duration{2 * time.Second},
+		OpenTimeout:       duration{openTimeout},
+		SoakInterval:      duration{10 * time.Minute},
+		CopyCount:         1,
+		SoakDuration:      duration{4 * time.Hour},
+		SeedMode:          seedModeUpdate,
+		InsertOrder:       orderSequential,
+		IncrementalWrites: 10000,
+		ChurnPct:          0.2,
+		Reps:              1,
+	}
+}
+
+// Load reads a scenario file into c. Keys missing from the file keep their
+// current value.
+func (c *Config) Load(path string) error {
+	md, err := toml.DecodeFile(path, c)
+	if err != nil {
+		return fmt.Errorf("config: %s", err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return fmt.Errorf("config: unknown key: %s", undecoded[0])
+	}
+	return nil
+}
+
+// Validate returns an error if the scenario cannot be run.
+func (c *Config) Validate() error {
+	switch {
+	case c.ItemCount <= 0:
+		return fmt.Errorf("item_count must be positive")
+	case c.BatchSize <= 0:
+		return fmt.Errorf("batch_size must be positive")
+	case c.KeySize < 8:
+		return fmt.Errorf("key_size must be at least 8 bytes")
+	case c.ValueSize < 0:
+		return fmt.Errorf("value_size must not be negative")
+	case c.KeyPrefixes < 0 || c.KeyPrefixes > c.ItemCount:
+		return fmt.Errorf("key_prefixes must be in [0, item_count]")
+	case c.Buckets < 1:
+		return fmt.Errorf("buckets must be at least 1")
+	case c.NestDepth < 0:
+		return fmt.Errorf("nest_depth must not be negative")
+	case c.NestFanout < 1:
+		return fmt.Errorf("nest_fanout must be at least 1")
+	case c.PageSize != 0 && (c.PageSize < 1024 || c.PageSize&(c.PageSize-1) != 0):
+		return fmt.Errorf("page_size must be a power of two of at least 1024")
+	case c.Preallocate < 0:
+		return fmt.Errorf("preallocate must not be negative")
+	case c.InitialMmapSize < 0:
+		return fmt.Errorf("initial_mmap_size must not be negative")
+	case c.MmapPopulate && mapPopulate == 0:
+		return fmt.Errorf("mmap_populate is only supported on Linux")
+	case c.DropCaches && !canDropCaches:
+		return fmt.Errorf("drop_caches is only supported on Linux")
+	case c.CopyFadvise && !canFadvise:
+		return fmt.Errorf("copy_fadvise is only supported on Linux")
+	case c.CopyDirect && oDirect == 0:
+		return fmt.Errorf("copy_direct is only supported on Linux")
+	case c.CopyDirect && (c.CopyFsync || c.CopyFadvise):
+		return fmt.Errorf("copy_direct can't be combined with copy_fsync or copy_fadvise")
+	case c.VerifyCopies && c.Compress != "":
+		return fmt.Errorf("verify_copies can't be combined with compress")
+	case c.VerifySnapshot && c.Compress != "":
+		return fmt.Errorf("verify_snapshot can't be combined with compress")
+	case c.VerifySnapshot && c.ChecksumValues:
+		// The generations overwrite the checksums.
+		return fmt.Errorf("verify_snapshot can't be combined with checksum_values")
+	case c.VerifySnapshot && (c.Mix != "" || c.DeleteRate > 0 || c.UpdateRate > 0):
+		// Other writers would rewrite or delete the snapshot keys.
+		return fmt.Errorf("verify_snapshot can't be combined with mix or background writers")
+	case c.VerifySnapshot && !c.copiesToFile():
+		return fmt.Errorf("verify_snapshot needs a file in copy_targets")
+	case c.Warmup.Passes < 1 && c.Warmup.Duration <= 0:
+		return fmt.Errorf("warmup must be at least one pass or a positive duration")
+	case c.OpenTimeout.Duration < 0:
+		return fmt.Errorf("open_timeout must not be negative")
+	case c.SoakInterval.Duration <= 0:
+		return fmt.Errorf("soak_interval must be positive")
+	case c.SoakDuration.Duration < 0:
+		return fmt.Errorf("soak_duration must not be negative")
+	case c.CopyCount < 1:
+		return fmt.Errorf("copy_count must be at least 1")
+	case c.CopyInterval.Duration < 0:
+		return fmt.Errorf("copy_interval must not be negative")
+	case c.CopyCount > 1 && c.PhaseDuration.Duration > 0:
+		return fmt.Errorf("copy_count can't be combined with phase_duration")
+	case c.PhaseDuration.Duration < 0:
+		return fmt.Errorf("phase_duration must not be negative")
+	case c.IteratePct <= 0 || c.IteratePct > 1:
+		return fmt.Errorf("iterate_pct must be in (0, 1]")
+	case c.CopyBufferSize < 0:
+		return fmt.Errorf("copy_buffer_size must not be negative")
+	case c.CopyRate < 0:
+		return fmt.Errorf("copy_rate must not be negative")
+	case c.CopyFsyncInterval < 0:
+		return fmt.Errorf("copy_fsync_interval must not be negative")
+	case c.CopyMethod != copyMethodCopy && c.CopyMethod != copyMethodWriteTo && c.CopyMethod != copyMethodBoth:
+		return fmt.Errorf("unknown copy method: %s", c.CopyMethod)
+	case c.FreelistType != "" && c.FreelistType != string(bbolt.FreelistArrayType) && c.FreelistType != string(bbolt.FreelistMapType):
+		return fmt.Errorf("unknown freelist type: %s", c.FreelistType)
+	case c.Copiers < 1:
+		return fmt.Errorf("copiers must be at least 1")
+	case c.Compress != "" && compressors[c.Compress] == nil:
+		return fmt.Errorf("unknown compressor: %s", c.Compress)
+	case c.IncrementalWrites < 0:
+		return fmt.Errorf("incremental_writes must not be negative")
+	case c.ChurnPct < 0 || c.ChurnPct > 1:
+		return fmt.Errorf("churn_pct must be in [0, 1]")
+	case c.SeedMode != seedModeUpdate && c.SeedMode != seedModeBatch:
+		return fmt.Errorf("unknown seed mode: %s", c.SeedMode)
+	case c.InsertOrder != orderSequential && c.InsertOrder != orderRandom && c.InsertOrder != orderReverse:
+		return fmt.Errorf("unknown insert order: %s", c.InsertOrder)
+	case c.SeedWorkers < 0:
+		return fmt.Errorf("seed_workers must not be negative")
+	case c.SeedWorkers > 0 && c.SeedMode != seedModeBatch:
+		return fmt.Errorf("seed_workers requires seed_mode %s", seedModeBatch)
+	case c.FillPercent != 0 && (c.FillPercent < 0.1 || c.FillPercent > 1):
+		// Bolt clamps fill percents to [0.1, 1].
+		return fmt.Errorf("fill_percent must be in [0.1, 1]")
+	case !validWorkload(c.Workload):
+		return fmt.Errorf("unknown workload: %s", c.Workload)
+	case c.GetCount <= 0:
+		return fmt.Errorf("get_count must be positive")
+	case c.RangeLength <= 0:
+		return fmt.Errorf("range_length must be positive")
+	case c.KeyDistribution != distUniform && c.KeyDistribution != distZipfian:
+		return fmt.Errorf("unknown key distribution: %s", c.KeyDistribution)
+	case c.ZipfSkew <= 0 || c.ZipfSkew >= 1:
+		return fmt.Errorf("zipf_skew must be in (0, 1)")
+	case c.DeleteRate < 0:
+		return fmt.Errorf("delete_rate must not be negative")
+	case c.DeleteOrder != orderRandom && c.DeleteOrder != orderSequential:
+		return fmt.Errorf("unknown delete order: %s", c.DeleteOrder)
+	case c.UpdateRate < 0:
+		return fmt.Errorf("update_rate must not be negative")
+	case c.Readers < 1:
+		return fmt.Errorf("readers must be at least 1")
+	case c.Reps < 1:
+		return fmt.Errorf("reps must be at least 1")
+	}
+	if err := c.validateValues(); err != nil {
+		return err
+	}
+	if err := c.validateEngine(); err != nil {
+		return err
+	}
+	if c.Mix != "" {
+		if _, err := parseMix(c.Mix); err != nil {
+			return err
+		}
+	}
+	for i, p := range c.Phases {
+		if !validPhase(p) {
+			return fmt.Errorf("unknown phase: %s", p)
+		} else if p == phaseRestore && !contains(c.Phases[:i], phaseCopy) && !contains(c.Phases[:i], phaseCompactCopy) {
+			return fmt.Errorf("the restore phase must follow a copy phase")
+		} else if p == phaseRestore && c.Compress != "" {
+			return fmt.Errorf("the restore phase can't restore compressed copies")
+		}
+	}
+	for _, p := range c.Phases {
+		if c.workload(p) == workloadPrefix && c.KeyPrefixes == 0 {
+			return fmt.Errorf("the prefix workload needs key_prefixes")
+		}
+	}
+	if c.usesWorkload(workloadScript) {
+		if c.WorkloadScript == "" {
+			return fmt.Errorf("the script workload needs workload_script")
+		} else if err := checkScript(c.WorkloadScript); err != nil {
+			return err
+		}
+	}
+	if y, ok := ycsbWorkloads[c.workload(phaseCopy)]; ok && c.VerifySnapshot && y.update+y.insert+y.rmw > 0 {
+		return fmt.Errorf("verify_snapshot can't be combined with the %s workload, which writes", c.workload(phaseCopy))
+	} else if c.VerifySnapshot && c.workload(phaseCopy) == workloadScript {
+		return fmt.Errorf("verify_snapshot can't be combined with the script workload, which may write")
+	}
+	if c.ResultsDB != "" {
+		if err := checkResultsDB(); err != nil {
+			return err
+		}
+	}
+	if c.ReaderProcess && !c.SeparateReader {
+		return fmt.Errorf("reader_process requires separate_reader")
+	}
+	if c.SeparateReader {
+		if err := c.validateReadOnly(); err != nil {
+			return fmt.Errorf("separate_reader: %s", err)
+		}
+	}
+	for _, p := range c.DeletePhases {
+		if !validPhase(p) {
+			return fmt.Errorf("delete_phases: unknown phase: %s", p)
+		}
+	}
+	for _, p := range c.UpdatePhases {
+		if !validPhase(p) {
+			return fmt.Errorf("update_phases: unknown phase: %s", p)
+		}
+	}
+	for p, w := range c.PhaseWorkloads {
+		if !validPhase(p) {
+			return fmt.Errorf("phase_workloads: unknown phase: %s", p)
+		} else if !validWorkload(w) {
+			return fmt.Errorf("phase_workloads: unknown workload: %s", w)
+		}
+	}
+	return nil
+}
+
+// validateReadOnly returns an error if the scenario writes to the database.
+func (c *Config) validateReadOnly() error {
+	switch {
+	case c.Mix != "":
+		return fmt.Errorf("mix writes to the database")
+	case c.DeleteRate > 0 || c.UpdateRate > 0:
+		return fmt.Errorf("background writers write to the database")
+	case contains(c.Phases, phaseIncremental):
+		return fmt.Errorf("the incremental phase writes to the database")
+	case contains(c.Phases, phaseChurn):
+		return fmt.Errorf("the churn phase writes to the database")
+	case c.VerifySnapshot:
+		return fmt.Errorf("verify_snapshot writes to the database")
+	}
+	for _, p := range c.Phases {
+		w := c.workload(p)
+		if y, ok := ycsbWorkloads[w]; ok && y.update+y.insert+y.rmw > 0 {
+			return fmt.Errorf("the %s workload writes to the database", w)
+		} else if w == workloadScript {
+			return fmt.Errorf("the script workload may write to the database")
+		}
+	}
+	return nil
+}
+
+// warmup is how long the warmup phase runs for: a number of passes per
+// reader, or a duration. It is encoded as a string such as "3" or "10s".
+type warmup struct {
+	Passes   int
+	Duration time.Duration
+}
+
+// UnmarshalText parses a number of passes or a duration.
+func (w *warmup) UnmarshalText(text []byte) error {
+	return w.Set(string(text))
+}
+
+// MarshalText encodes the warmup as a string.
+func (w warmup) MarshalText() ([]byte, error) {
+	return []byte(w.String()), nil
+}
+
+// Set parses a number of passes or a duration, so that warmup can be used as
+// a flag.
+func (w *warmup) Set(s string) error {
+	if n, err := strconv.Atoi(s); err == nil {
+		*w = warmup{Passes: n}
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid warmup %q: want a number of passes or a duration", s)
+	}
+	*w = warmup{Duration: d}
+	return nil
+}
+
+// String returns the number of passes or the duration.
+func (w warmup) String() string {
+	if w.Duration > 0 {
+		return w.Duration.String()
+	}
+	return strconv.Itoa(w.Passes)
+}
+
+// duration is a time.Duration that is encoded as a string such as "2s".
+type duration struct {
+	time.Duration
+}
+
+// UnmarshalText parses a duration string.
+func (d *duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// MarshalText encodes the duration as a string.
+func (d duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
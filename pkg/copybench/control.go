@@ -0,0 +1,167 @@
+package copybench
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// control holds the state of the bench reported and changed by the control
+// API.
+var control struct {
+	mu      sync.Mutex
+	phase   string
+	started time.Time
+	phases  []*phaseResult
+
+	// resume is set while the run is paused, and closed to resume it.
+	// paused is the time spent paused before the current pause, which
+	// started at pausedAt.
+	resume   chan struct{}
+	paused   time.Duration
+	pausedAt time.Time
+}
+
+// controlStatus is the reply of the control API's status endpoint.
+type controlStatus struct {
+	Phase        string         `json:"phase"`
+	Elapsed      time.Duration  `json:"elapsed"`
+	Paused       bool           `json:"paused"`
+	Aborted      bool           `json:"aborted"`
+	KeysRead     int64          `json:"keys_read"`
+	MixWrites    int64          `json:"mix_writes"`
+	BytesCopied  int64          `json:"bytes_copied"`
+	CopyProgress int64          `json:"copy_progress"`
+	Phases       []*phaseResult `json:"phases"`
+}
+
+// setControlPhase records phase as the one currently running.
+func setControlPhase(phase string) {
+	control.mu.Lock()
+	defer control.mu.Unlock()
+	control.phase, control.started = phase, time.Now()
+}
+
+// addControlPhase records a completed phase.
+func addControlPhase(pr *phaseResult) {
+	control.mu.Lock()
+	defer control.mu.Unlock()
+	control.phases = append(control.phases, pr)
+}
+
+// isPaused reports whether the run is paused.
+func isPaused() bool {
+	control.mu.Lock()
+	defer control.mu.Unlock()
+	return control.resume != nil
+}
+
+// pausedFor returns how long the run has been paused in total, including the
+// current pause. Phases and copies leave the time paused while they ran out
+// of their duration.
+func pausedFor() time.Duration {
+	control.mu.Lock()
+	defer control.mu.Unlock()
+	d := control.paused
+	if control.resume != nil {
+		d += time.Since(control.pausedAt)
+	}
+	return d
+}
+
+// waitIfPaused blocks while the run is paused, unless it is interrupted.
+func waitIfPaused() {
+	control.mu.Lock()
+	c := control.resume
+	control.mu.Unlock()
+	if c != nil {
+		select {
+		case <-c:
+		case <-interrupted:
+		}
+	}
+}
+
+// serveControl listens on addr and serves the control API in the background.
+// It is a no-op if addr is empty.
+//
+//	GET  /status  the current phase, live counters and completed phases as JSON
+//	POST /pause   hold readers, writers and copies at their next pass, write or chunk
+//	POST /resume  let them carry on
+//	POST /abort   stop the run as a signal does, reporting what was measured
+func serveControl(addr string) error {
+	if addr == "" {
+		return nil
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("control: %s", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", controlHandler("GET", func() {}))
+	mux.HandleFunc("/pause", controlHandler("POST", func() {
+		if control.resume == nil {
+			control.resume, control.pausedAt = make(chan struct{}), time.Now()
+			log.Printf("control: paused")
+		}
+	}))
+	mux.HandleFunc("/resume", controlHandler("POST", func() {
+		if control.resume != nil {
+			close(control.resume)
+			control.resume = nil
+			control.paused += time.Since(control.pausedAt)
+			log.Printf("control: resumed")
+		}
+	}))
+	mux.HandleFunc("/abort", controlHandler("POST", func() {
+		log.Printf("control: aborting")
+		interrupt()
+	}))
+	log.Printf("control: listening on %s", lis.Addr())
+	go func() {
+		if err := http.Serve(lis, mux); err != nil {
+			log.Printf("control: %s", err)
+		}
+	}()
+	return nil
+}
+
+// controlHandler returns a handler accepting method that calls fn with the
+// control state locked and replies with the resulting status.
+func controlHandler(method string, fn func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		control.mu.Lock()
+		fn()
+		status := &controlStatus{
+			Phase:        control.phase,
+			Paused:       control.resume != nil,
+			Aborted:      isInterrupted(),
+			KeysRead:     atomic.LoadInt64(&keysRead),
+			MixWrites:    atomic.LoadInt64(&mixWrites),
+			BytesCopied:  atomic.LoadInt64(&bytesCopied),
+			CopyProgress: atomic.LoadInt64(&copyProgress),
+			Phases:       append([]*phaseResult(nil), control.phases...),
+		}
+		if control.phase != "" {
+			status.Elapsed = time.Since(control.started)
+		}
+		control.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		b, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(append(b, '\n'))
+	}
+}
@@ -0,0 +1,326 @@
+package copybench
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// coordinateDuration is how long the coordinate command's iterate phase runs
+// unless the scenario sets phase_duration.
+const coordinateDuration = 10 * time.Second
+
+// workerPhase holds the stats every worker reported for a phase of the
+// coordinate command.
+type workerPhase struct {
+	Phase   string         `json:"phase"`
+	Workers []*workerStats `json:"workers"`
+
+	// Throughput holds the combined throughput of the workers over every
+	// interval of the phase.
+	Throughput []*clusterSample `json:"throughput,omitempty"`
+}
+
+// clusterSample is the throughput of every worker combined over one interval
+// of a phase. The workers' samples are matched by their position in each
+// worker's stream rather than by time, so that the hosts' clocks don't need
+// to agree.
+type clusterSample struct {
+	Elapsed      time.Duration `json:"elapsed"`
+	Workers      int           `json:"workers"`
+	KeysPerSec   float64       `json:"keys_per_sec"`
+	WritesPerSec float64       `json:"writes_per_sec"`
+	BytesPerSec  float64       `json:"bytes_per_sec"`
+}
+
+// String summarizes the sample on a single line.
+func (s *clusterSample) String() string {
+	return fmt.Sprintf("%v: %.0f keys/s, %.0f writes/s, %.1f MB/s (%d workers)",
+		s.Elapsed, s.KeysPerSec, s.WritesPerSec, s.BytesPerSec/1e6, s.Workers)
+}
+
+// aggregator combines the metrics streamed by a phase's workers, printing
+// each interval once every worker has reported it.
+type aggregator struct {
+	mu       sync.Mutex
+	interval time.Duration
+	workers  int
+	samples  []*clusterSample
+}
+
+// add adds the throughput of a worker over its i-th interval.
+func (a *aggregator) add(i int, keys, writes, bytes float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for len(a.samples) <= i {
+		a.samples = append(a.samples, &clusterSample{Elapsed: time.Duration(len(a.samples)+1) * a.interval})
+	}
+	s := a.samples[i]
+	s.Workers++
+	s.KeysPerSec += keys
+	s.WritesPerSec += writes
+	s.BytesPerSec += bytes
+	if s.Workers == a.workers {
+		fmt.Fprintf(stdout, "  %s\n", s)
+	}
+}
+
+// remoteWorker is a worker process driven by the coordinator.
+type remoteWorker struct {
+	role string
+	addr string
+	conn *grpc.ClientConn
+	env  *environment
+}
+
+// parseWorkers parses a list of workers such as
+// "reader=host1:7070,writer=host2:7070,backup=host3:7070".
+func parseWorkers(s string) ([]*remoteWorker, error) {
+	var workers []*remoteWorker
+	for _, w := range strings.Split(s, ",") {
+		parts := strings.SplitN(w, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("workers must be ROLE=ADDR,..., e.g. reader=localhost:7070")
+		} else if !validRole(parts[0]) {
+			return nil, fmt.Errorf("unknown role: %s", parts[0])
+		}
+		workers = append(workers, &remoteWorker{role: parts[0], addr: parts[1]})
+	}
+	return workers, nil
+}
+
+// coordinateMain runs the iterate and copy phases across worker processes
+// started with the worker command: readers and writers run during both
+// phases, and backups copy the database from the writer, or the first
+// reader, during the copy phase, which ends once they have made copy_count
+// copies each.
+func coordinateMain(args []string) error {
+	fs := flag.NewFlagSet("coordinate", flag.ExitOnError)
+	cfg := defaultConfig()
+	interval := fs.Duration("interval", time.Second, "report the workers' progress every `D` (0 disables)")
+	out := fs.String("o", "", "write results as JSON to `FILE`")
+	csvPath := fs.String("csv", "", "write the workers' combined throughput as CSV to `FILE`")
+	duration := fs.Duration("duration", 0, "run the iterate phase for `D` (0 for phase_duration, or 10s)")
+	fs.IntVar(&cfg.CopyCount, "copy-count", cfg.CopyCount, "make `N` copies per backup during the copy phase")
+	list, err := parseFlags(fs, args, cfg)
+	if err != nil {
+		return err
+	}
+	workers, err := parseWorkers(list)
+	if err != nil {
+		return err
+	}
+
+	// Backups copy from the writer, which holds the database's file lock, or
+	// from a reader if there is none.
+	var source string
+	for _, w := range workers {
+		if w.role == roleWriter || (w.role == roleReader && source == "") {
+			source = w.addr
+		}
+	}
+	if source == "" {
+		return fmt.Errorf("coordinate needs a reader or writer")
+	}
+
+	for _, w := range workers {
+		if w.conn, err = dialWorker(w.addr); err != nil {
+			return err
+		}
+		defer w.conn.Close()
+	}
+
+	res := newResult("coordinate", "", cfg)
+	for _, w := range workers {
+		req := &loadRequest{Config: cfg, Role: w.role}
+		if w.role == roleBackup {
+			req.Source = source
+		}
+		var reply loadReply
+		if err := w.conn.Invoke(context.Background(), methodLoad, req, &reply); err != nil {
+			return fmt.Errorf("%s %s: load: %s", w.role, w.addr, err)
+		}
+		if reply.Size > res.Size {
+			res.Size = reply.Size
+		}
+		w.env = reply.Env
+		if w.env != nil {
+			fmt.Fprintf(stdout, "%s %s: %s, %d CPUs, %s\n", w.role, w.addr, w.env.Hostname, w.env.CPUs, w.env.Kernel)
+		}
+	}
+	fmt.Fprintf(stdout, "size: %d bytes\n", res.Size)
+	fmt.Fprintln(stdout, "")
+
+	d := *duration
+	if d == 0 {
+		d = cfg.PhaseDuration.Duration
+	}
+	if d == 0 {
+		d = coordinateDuration
+	}
+	for _, phase := range []string{phaseIterate, phaseCopy} {
+		fmt.Fprintf(stdout, "%s\n", phase)
+		wp, err := coordinatePhase(workers, phase, d, *interval)
+		if err != nil {
+			return err
+		}
+		wp.print()
+		fmt.Fprintln(stdout, "")
+		res.Workers = append(res.Workers, wp)
+	}
+	if err := writeClusterCSV(*csvPath, res.Workers); err != nil {
+		return err
+	}
+	return res.save(*out)
+}
+
+// coordinatePhase runs a phase across the workers: readers and writers run
+// for d during the iterate phase, and until the backups are done during the
+// copy phase.
+func coordinatePhase(workers []*remoteWorker, phase string, d, interval time.Duration) (*workerPhase, error) {
+	var running, backups []*remoteWorker
+	for _, w := range workers {
+		if w.role != roleBackup {
+			running = append(running, w)
+		} else if phase == phaseCopy {
+			backups = append(backups, w)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	wp := &workerPhase{Phase: phase}
+	agg := &aggregator{interval: interval, workers: len(running) + len(backups)}
+	started := make([]*remoteWorker, 0, len(workers))
+	stopAll := func() error {
+		var first error
+		for _, w := range started {
+			var stats workerStats
+			if err := w.conn.Invoke(context.Background(), methodStop, &stopRequest{}, &stats); err != nil {
+				if first == nil {
+					first = fmt.Errorf("%s %s: stop: %s", w.role, w.addr, err)
+				}
+				continue
+			}
+			stats.Env = w.env
+			wp.Workers = append(wp.Workers, &stats)
+		}
+		return first
+	}
+
+	for _, w := range append(running, backups...) {
+		if err := w.conn.Invoke(ctx, methodStart, &startRequest{Phase: phase}, &startReply{}); err != nil {
+			stopAll()
+			return nil, fmt.Errorf("%s %s: start: %s", w.role, w.addr, err)
+		}
+		started = append(started, w)
+		if interval > 0 {
+			wg.Add(1)
+			go func(w *remoteWorker) {
+				defer wg.Done()
+				w.watch(ctx, interval, agg)
+			}(w)
+		}
+	}
+
+	if len(backups) == 0 {
+		time.Sleep(d)
+	}
+	// Stopping a backup waits for its copies, so stop them first.
+	started = append(append([]*remoteWorker(nil), backups...), running...)
+	if err := stopAll(); err != nil {
+		return nil, err
+	}
+	cancel()
+	wg.Wait()
+	wp.Throughput = agg.samples
+	return wp, nil
+}
+
+// watch adds the worker's throughput over every interval to agg until ctx is
+// cancelled.
+func (w *remoteWorker) watch(ctx context.Context, interval time.Duration, agg *aggregator) {
+	stream, err := openStream(ctx, w.conn, methodMetrics, &metricsRequest{Interval: interval})
+	if err != nil {
+		return
+	}
+	var last *workerMetric
+	for i := 0; ; {
+		var m workerMetric
+		if err := stream.RecvMsg(&m); err == io.EOF || ctx.Err() != nil {
+			return
+		} else if err != nil {
+			fmt.Fprintf(stdout, "  %s %s: metrics: %s\n", w.role, w.addr, err)
+			return
+		}
+		if last != nil {
+			s := m.Time.Sub(last.Time).Seconds()
+			agg.add(i, float64(m.Keys-last.Keys)/s, float64(m.Writes-last.Writes)/s, float64(m.Bytes-last.Bytes)/s)
+			i++
+		}
+		last = &m
+	}
+}
+
+// writeClusterCSV writes the combined throughput of every phase to path, if
+// set.
+func writeClusterCSV(path string, phases []*workerPhase) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"phase", "elapsed_ns", "workers", "keys_per_sec", "writes_per_sec", "bytes_per_sec"})
+	for _, wp := range phases {
+		for _, s := range wp.Throughput {
+			w.Write([]string{
+				wp.Phase,
+				strconv.FormatInt(int64(s.Elapsed), 10),
+				strconv.Itoa(s.Workers),
+				strconv.FormatFloat(s.KeysPerSec, 'f', 0, 64),
+				strconv.FormatFloat(s.WritesPerSec, 'f', 0, 64),
+				strconv.FormatFloat(s.BytesPerSec, 'f', 0, 64),
+			})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// print writes a line per worker, and per copy made by a backup, to stdout.
+func (wp *workerPhase) print() {
+	for _, w := range wp.Workers {
+		switch {
+		case w.Iterate != nil:
+			p99 := time.Duration(0)
+			if w.Iterate.Latency != nil {
+				p99 = w.Iterate.Latency.P99
+			}
+			fmt.Fprintf(stdout, "%s %s: avg: %v (n=%d), p99: %v\n", w.Role, w.Addr, w.Iterate.Avg, w.Iterate.N, p99)
+		case w.Mix != nil:
+			fmt.Fprintf(stdout, "%s %s: %s\n", w.Role, w.Addr, w.Mix)
+		}
+		for _, cs := range w.Copies {
+			fmt.Fprintf(stdout, "%s %s: copy: %v (%d bytes, %.1f MB/s)\n", w.Role, w.Addr, cs.Duration, cs.Bytes, float64(cs.Bytes)/1e6/cs.Duration.Seconds())
+		}
+	}
+}
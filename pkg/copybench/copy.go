@@ -0,0 +1,391 @@
+package copybench
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// copyMain times a single copy of the database with no concurrent load.
+func copyMain(args []string) error {
+	fs := flag.NewFlagSet("copy", flag.ExitOnError)
+	cfg := defaultConfig()
+	out := fs.String("o", "", "write results as JSON to `FILE`")
+	benchstatPath := fs.String("benchstat", "", "write results in benchstat format to `FILE`")
+	registerCopyFlags(fs, cfg)
+	prof := registerProfileFlags(fs)
+	path, err := parseFlags(fs, args, cfg)
+	if err != nil {
+		return err
+	}
+	handleSignals()
+
+	eng, err := openEngine(path, false, cfg)
+	if err != nil {
+		return err
+	}
+	defer eng.Close()
+
+	res := newResult("copy", path, cfg)
+	if res.Size, err = eng.Size(); err != nil {
+		return err
+	}
+
+	if err := prof.start(""); err != nil {
+		return err
+	}
+	if err := prof.startCopy(""); err != nil {
+		return err
+	}
+	t := time.Now()
+	copies, err := dbcopy(eng, cfg)
+	if err := prof.stopCopy(""); err != nil {
+		return err
+	}
+	if err := prof.stop(); err != nil {
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	res.Phases = append(res.Phases, &phaseResult{Name: "copy", Duration: time.Since(t), Copies: copies})
+
+	if err := res.writeBenchstat(*benchstatPath); err != nil {
+		return err
+	}
+	return res.save(*out)
+}
+
+// copyDestFlag is the -copy-dest PATH flag, which replaces the scenario's
+// copy targets. Being set as the flags are parsed, after the scenario file is
+// loaded, it is validated along with the rest of the scenario.
+type copyDestFlag struct{ cfg *Config }
+
+func (f copyDestFlag) String() string { return "" }
+
+func (f copyDestFlag) Set(s string) error {
+	if s != "" {
+		f.cfg.CopyTargets = []string{s}
+	}
+	return nil
+}
+
+// registerCopyFlags registers the flags that configure the copy destination.
+func registerCopyFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.Var(copyDestFlag{cfg}, "copy-dest", "copy the database to `PATH` instead of the scenario's copy targets")
+	fs.IntVar(&cfg.CopyBufferSize, "copy-buffer", cfg.CopyBufferSize, "buffer copy writes in `BYTES` (0 writes directly)")
+	fs.Float64Var(&cfg.CopyRate, "copy-rate", cfg.CopyRate, "limit the copy to `MB/s` (0 for unlimited)")
+	fs.BoolVar(&cfg.CopyFsync, "copy-fsync", cfg.CopyFsync, "fsync file copy targets before the copy is complete")
+	fs.IntVar(&cfg.CopyFsyncInterval, "copy-fsync-interval", cfg.CopyFsyncInterval, "also fsync durable copies every `BYTES` written")
+	fs.BoolVar(&cfg.CopyDirect, "copy-direct", cfg.CopyDirect, "write file copy targets with O_DIRECT")
+	fs.BoolVar(&cfg.VerifyCopies, "verify-copy", cfg.VerifyCopies, "check every copy to a file against the source once it is complete")
+	fs.BoolVar(&cfg.CopyFadvise, "copy-fadvise", cfg.CopyFadvise, "drop file copy targets from the page cache as they are written")
+	fs.StringVar(&cfg.CopyMethod, "copy-method", cfg.CopyMethod, "copy with `METHOD` (copy for Tx.Copy, writeto for Tx.WriteTo, or both)")
+	fs.IntVar(&cfg.Copiers, "copiers", cfg.Copiers, "run `N` overlapping copies to each target")
+	fs.StringVar(&cfg.Compress, "compress", cfg.Compress, "compress the copy with `NAME` (gzip, zstd, lz4 or snappy)")
+}
+
+// Copy methods accepted by copy_method.
+const (
+	copyMethodCopy    = "copy"    // Tx.Copy
+	copyMethodWriteTo = "writeto" // Tx.WriteTo
+	copyMethodBoth    = "both"    // Tx.Copy, then Tx.WriteTo
+)
+
+// dbcopy performs a copy of the database to each of the scenario's copy
+// targets, or to ioutil.Discard if there are none. With several copiers, each
+// target is copied that many times at once, to distinct destinations. When
+// comparing copy methods, every target is copied with each in turn.
+func dbcopy(eng engine, cfg *Config) ([]*copyStats, error) {
+	targets := cfg.CopyTargets
+	if len(targets) == 0 {
+		targets = []string{""}
+	}
+	methods := []string{cfg.CopyMethod}
+	if cfg.CopyMethod == copyMethodBoth {
+		methods = []string{copyMethodCopy, copyMethodWriteTo}
+	}
+
+	var copies []*copyStats
+	for _, method := range methods {
+		for _, target := range targets {
+			atomic.StoreInt64(&copyProgress, 0)
+			if cfg.Copiers == 1 {
+				cs, err := copyTarget(eng, cfg, target, method)
+				if err != nil {
+					return nil, err
+				}
+				cs.print()
+				copies = append(copies, cs)
+				continue
+			}
+
+			t := time.Now()
+			a, err := copyConcurrently(eng, cfg, target, method)
+			if err != nil {
+				return nil, err
+			}
+			for _, cs := range a {
+				cs.print()
+			}
+			fmt.Fprintf(stdout, "copiers: %d overlapping copies in %v\n", len(a), time.Since(t))
+			copies = append(copies, a...)
+		}
+	}
+	return copies, nil
+}
+
+// printCopySeries prints the copies of a phase that copies copy_count times,
+// comparing each with the first copy to the same target, to show whether
+// later copies get slower.
+func printCopySeries(copies []*copyStats) {
+	first := make(map[string]*copyStats)
+	for i, cs := range copies {
+		key := cs.Target + " " + cs.Method
+		if first[key] == nil {
+			first[key] = cs
+		}
+		change := (float64(cs.Duration)/float64(first[key].Duration) - 1) * 100
+		fmt.Fprintf(stdout, "copy %d/%d at %v: %v, %d bytes (%+.1f%% vs first)\n",
+			i+1, len(copies), cs.Start.Round(time.Millisecond), cs.Duration, cs.Bytes, change)
+	}
+}
+
+// copyConcurrently runs cfg.Copiers copies of the database to target at once.
+// Copier i writes to target with a ".i" suffix, except for the first, which
+// writes to target itself.
+func copyConcurrently(eng engine, cfg *Config, target, method string) ([]*copyStats, error) {
+	copies := make([]*copyStats, cfg.Copiers)
+	errs := make([]error, cfg.Copiers)
+	var wg sync.WaitGroup
+	for i := range copies {
+		path := target
+		if path != "" && i > 0 {
+			path = fmt.Sprintf("%s.%d", target, i)
+		}
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			copies[i], errs[i] = copyTarget(eng, cfg, path, method)
+		}(i, path)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return copies, nil
+}
+
+// copyTarget performs a timed copy of the database to path with the named copy
+// method, which for Tx.Copy is the engine's snapshot. The path is either a
+// file or an object store URL, or empty to copy to ioutil.Discard. Writes go
+// through the scenario's rate limiter, compressor and write buffer; the timing
+// includes flushing them, completing any upload and, for a durable copy to a
+// file, fsyncing it or dropping it from the page cache. A signal aborts the
+// copy with errInterrupted.
+func copyTarget(eng engine, cfg *Config, path, method string) (*copyStats, error) {
+	var dest io.Writer = ioutil.Discard
+	var tw io.WriteCloser
+	cs := &copyStats{Target: "discard", Method: method, Compression: cfg.Compress}
+	if path != "" {
+		var err error
+		if cfg.CopyDirect && !strings.Contains(path, "://") {
+			tw, err = openDirect(path)
+			cs.Direct = true
+		} else {
+			tw, err = openTarget(path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if tw != nil {
+				abortTarget(tw)
+			}
+		}()
+		dest, cs.Target = tw, path
+	}
+
+	paused := pausedFor()
+	t := time.Now()
+
+	var sw *syncWriter
+	if f, ok := tw.(*os.File); ok && cfg.CopyFsync {
+		sw = &syncWriter{f: f, interval: int64(cfg.CopyFsyncInterval)}
+		dest = sw
+	}
+	var fw *fadviseWriter
+	if f, ok := tw.(*os.File); ok && cfg.CopyFadvise {
+		fw = &fadviseWriter{w: dest, f: f}
+		dest = fw
+	}
+
+	var bw *bufio.Writer
+	if cfg.CopyBufferSize > 0 {
+		bw = bufio.NewWriterSize(dest, cfg.CopyBufferSize)
+		dest = bw
+	}
+	cw := &countingWriter{w: dest}
+
+	var w io.Writer = cw
+	var zw io.WriteCloser
+	if cfg.Compress != "" {
+		var err error
+		if zw, err = newCompressor(cfg.Compress, cw); err != nil {
+			return nil, err
+		}
+		w = zw
+	}
+
+	if cfg.CopyRate > 0 {
+		w = newLimitedWriter(w, cfg.CopyRate)
+	}
+
+	// A verified copy's source is digested in the copy's transaction, once
+	// the copy is written and outside its timing.
+	verify := cfg.VerifyCopies && path != "" && !strings.Contains(path, "://")
+	var src *digest
+	var digestDuration time.Duration
+	digestSource := func(tx *bolt.Tx) {
+		if verify {
+			dt := time.Now()
+			src = digestTx(tx, cfg)
+			digestDuration = time.Since(dt)
+		}
+	}
+
+	mw := &meteredWriter{w: w}
+	var err error
+	if method == copyMethodWriteTo {
+		err = boltDB(eng).View(func(tx *bolt.Tx) error {
+			if cs.WriteToBytes, err = tx.WriteTo(mw); err != nil {
+				return err
+			}
+			digestSource(tx)
+			return nil
+		})
+	} else if verify {
+		err = boltDB(eng).View(func(tx *bolt.Tx) error {
+			if err := tx.Copy(mw); err != nil {
+				return err
+			}
+			digestSource(tx)
+			return nil
+		})
+	} else {
+		_, err = eng.Snapshot(mw)
+	}
+	if err != nil && isInterrupted() {
+		return nil, errInterrupted
+	} else if err != nil {
+		return nil, err
+	}
+
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		cs.CompressedBytes = cw.n
+	}
+	if bw != nil {
+		if err := bw.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	if sw != nil {
+		if err := sw.sync(); err != nil {
+			return nil, err
+		}
+		cs.Syncs, cs.SyncDuration = sw.n, sw.d
+	}
+	if fw != nil {
+		if err := fw.drop(); err != nil {
+			return nil, err
+		}
+		cs.Fadvises, cs.FadviseDuration = fw.n, fw.d
+	}
+	if tw != nil {
+		err := tw.Close()
+		if tw = nil; err != nil {
+			return nil, err
+		}
+	}
+
+	cs.Paused = pausedFor() - paused
+	cs.Duration = time.Since(t) - digestDuration - cs.Paused
+	cs.Bytes = mw.n
+	if verify {
+		if cs.Verified, err = verifyCopy(path, cfg, src); err != nil {
+			return nil, err
+		}
+	}
+	return cs, nil
+}
+
+// print writes the copy's timing to stdout.
+func (cs *copyStats) print() {
+	label := "copy"
+	if cs.Method == copyMethodWriteTo {
+		label = "writeto"
+	}
+	if cs.Direct {
+		label += " (O_DIRECT)"
+	}
+	if cs.Compression == "" {
+		fmt.Fprintf(stdout, "%s: %v (%s, %d bytes)\n", label, cs.Duration, cs.Target, cs.Bytes)
+	} else {
+		fmt.Fprintf(stdout, "%s: %v (%s, %d bytes, %s: %d bytes, ratio %.2f)\n",
+			label, cs.Duration, cs.Target, cs.Bytes, cs.Compression, cs.CompressedBytes, cs.ratio())
+	}
+	if cs.Paused > 0 {
+		fmt.Fprintf(stdout, "paused: %v, left out of the copy's duration\n", cs.Paused)
+	}
+	if cs.Method == copyMethodWriteTo && cs.WriteToBytes != cs.Bytes {
+		fmt.Fprintf(stdout, "writeto: reported %d bytes written\n", cs.WriteToBytes)
+	}
+	if cs.Verified != nil {
+		fmt.Fprintf(stdout, "verify: ok, %s (%v)\n", cs.Verified.Digest, cs.Verified.Duration)
+	}
+	if cs.Fadvises > 0 {
+		fmt.Fprintf(stdout, "fadvise: dropped from page cache in %v (n=%d)\n", cs.FadviseDuration, cs.Fadvises)
+	}
+	if cs.Syncs > 0 {
+		fmt.Fprintf(stdout, "durable: fsync: %v (n=%d), fast: %v (durable %.1f%% slower)\n",
+			cs.SyncDuration, cs.Syncs, cs.Duration-cs.SyncDuration,
+			float64(cs.SyncDuration)/float64(cs.Duration-cs.SyncDuration)*100)
+	}
+}
+
+// ratio returns the compression ratio of the copy, or zero if it was not
+// compressed.
+func (cs *copyStats) ratio() float64 {
+	if cs.CompressedBytes == 0 {
+		return 0
+	}
+	return float64(cs.Bytes) / float64(cs.CompressedBytes)
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes p to the underlying writer and counts the bytes written.
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,108 @@
+package copybench
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// digest summarizes the contents of a bolt database: the number of keys and
+// buckets, a checksum of every bucket name, key and value in order and the
+// number of values that failed their own checksum.
+type digest struct {
+	Keys     int    `json:"keys"`
+	Buckets  int    `json:"buckets"`
+	Checksum uint64 `json:"checksum"`
+	Corrupt  int    `json:"corrupt,omitempty"`
+}
+
+// digestTx computes the digest of the database as seen by tx, checking the
+// values of the scenario cfg.
+func digestTx(tx *bolt.Tx, cfg *Config) *digest {
+	d := &digest{}
+	h := fnv.New64a()
+	tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		d.Buckets++
+		digestBucket(cfg, d, h, name, b)
+		return nil
+	})
+	d.Checksum = h.Sum64()
+	return d
+}
+
+// digestBucket adds the bucket named name and everything in it to d and h.
+// Every field is length-prefixed so that moving bytes between a key and its
+// value changes the checksum.
+func digestBucket(cfg *Config, d *digest, h hash.Hash64, name []byte, b *bolt.Bucket) {
+	write := func(p []byte) {
+		var n [binary.MaxVarintLen64]byte
+		h.Write(n[:binary.PutUvarint(n[:], uint64(len(p)))])
+		h.Write(p)
+	}
+	write(name)
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v == nil {
+			d.Buckets++
+			digestBucket(cfg, d, h, k, b.Bucket(k))
+			continue
+		}
+		d.Keys++
+		if !cfg.checkValue(k, v) {
+			d.Corrupt++
+		}
+		write(k)
+		write(v)
+	}
+}
+
+// String summarizes the digest on a single line.
+func (d *digest) String() string {
+	return fmt.Sprintf("%d keys in %d buckets, checksum %016x", d.Keys, d.Buckets, d.Checksum)
+}
+
+// copyVerification is the outcome of checking a copy against its source.
+type copyVerification struct {
+	Digest   *digest       `json:"digest"`
+	Duration time.Duration `json:"duration"`
+}
+
+// verifyCopy opens the bolt database copied to path, runs bolt's consistency
+// check on it and compares its digest with want, that of the source in the
+// transaction the copy was made in.
+func verifyCopy(path string, cfg *Config, want *digest) (*copyVerification, error) {
+	t := time.Now()
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("verify %s: %s", path, err)
+	}
+	defer db.Close()
+
+	var got *digest
+	err = db.View(func(tx *bolt.Tx) error {
+		var checkErr error
+		for err := range tx.Check() {
+			if checkErr == nil {
+				checkErr = err
+			}
+		}
+		if checkErr != nil {
+			return fmt.Errorf("check: %s", checkErr)
+		}
+		got = digestTx(tx, cfg)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("verify %s: %s", path, err)
+	}
+	if *got != *want {
+		return nil, fmt.Errorf("verify %s: copy holds %s, source held %s", path, got, want)
+	} else if got.Corrupt > 0 {
+		return nil, fmt.Errorf("verify %s: %d values failed their checksum", path, got.Corrupt)
+	}
+	return &copyVerification{Digest: got, Duration: time.Since(t)}, nil
+}
@@ -0,0 +1,95 @@
+package copybench
+
+import (
+	"os"
+	"unsafe"
+)
+
+// directAlign is the alignment of the buffer, offsets and lengths of writes to
+// a file opened with O_DIRECT. It is a multiple of the logical block size of
+// common devices.
+const directAlign = 4096
+
+// directBufferSize is the size of the writes to a file opened with O_DIRECT.
+const directBufferSize = 1 << 20
+
+// directWriter writes to a file opened with O_DIRECT, so that the writes
+// bypass the page cache. Writes are gathered in an aligned buffer and written
+// out in full buffers; the last block is padded and the file is then
+// truncated to the bytes written.
+type directWriter struct {
+	f   *os.File
+	buf []byte
+	n   int
+	off int64
+}
+
+// openDirect creates the file at path for writing with O_DIRECT.
+func openDirect(path string) (*directWriter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|oDirect, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &directWriter{f: f, buf: alignedBuffer(directBufferSize)}, nil
+}
+
+// alignedBuffer returns a buffer of n bytes starting at a multiple of
+// directAlign.
+func alignedBuffer(n int) []byte {
+	b := make([]byte, n+directAlign)
+	i := int(uintptr(unsafe.Pointer(&b[0])) & (directAlign - 1))
+	if i > 0 {
+		i = directAlign - i
+	}
+	return b[i : i+n]
+}
+
+// Write buffers p, writing out the buffer whenever it is full.
+func (w *directWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		m := copy(w.buf[w.n:], p)
+		w.n += m
+		written += m
+		p = p[m:]
+		if w.n == len(w.buf) {
+			if err := w.flush(len(w.buf)); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flush writes the first n bytes of the buffer, a multiple of directAlign, and
+// keeps any bytes after them.
+func (w *directWriter) flush(n int) error {
+	if _, err := w.f.WriteAt(w.buf[:n], w.off); err != nil {
+		return err
+	}
+	w.off += int64(n)
+	w.n = copy(w.buf, w.buf[n:w.n])
+	return nil
+}
+
+// Close writes out the buffered bytes, padded to a whole block, truncates the
+// padding and closes the file.
+func (w *directWriter) Close() error {
+	size := w.off + int64(w.n)
+	if w.n > 0 {
+		n := (w.n + directAlign - 1) / directAlign * directAlign
+		for i := w.n; i < n; i++ {
+			w.buf[i] = 0
+		}
+		w.n = n
+		if err := w.flush(n); err != nil {
+			w.f.Close()
+			return err
+		}
+	}
+	if err := w.f.Truncate(size); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
@@ -0,0 +1,124 @@
+package copybench
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// diskInterval is the interval at which the block device is sampled.
+const diskInterval = 250 * time.Millisecond
+
+// diskCounters are the cumulative counters of a block device, from
+// /sys/block/DEV/stat.
+type diskCounters struct {
+	readSectors  int64
+	writeSectors int64
+	inFlight     int64
+	ioTicks      time.Duration // time the device was busy
+	queueTime    time.Duration // time requests spent queued or in flight
+}
+
+// diskStats summarizes the utilization of the block device that holds the
+// database over a phase, as iostat would. Util is the fraction of the phase
+// the device was busy, and QueueDepth the average number of requests queued
+// or in flight. The maximums are those of the intervals sampled.
+type diskStats struct {
+	Device      string  `json:"device"`
+	Util        float64 `json:"util"`
+	MaxUtil     float64 `json:"max_util"`
+	QueueDepth  float64 `json:"queue_depth"`
+	MaxInFlight int64   `json:"max_in_flight"`
+	ReadBytes   int64   `json:"read_bytes"`
+	WriteBytes  int64   `json:"write_bytes"`
+}
+
+// String summarizes the stats on a single line.
+func (s *diskStats) String() string {
+	return fmt.Sprintf("%s: util: %.1f%% (max %.1f%%), queue depth: %.2f, max in flight: %d, read: %d bytes, written: %d bytes",
+		s.Device, s.Util*100, s.MaxUtil*100, s.QueueDepth, s.MaxInFlight, s.ReadBytes, s.WriteBytes)
+}
+
+// diskSampler samples the utilization of a block device.
+type diskSampler struct {
+	dev string
+}
+
+// newDiskSampler returns a sampler of the block device holding path.
+func newDiskSampler(path string) (*diskSampler, error) {
+	dev, err := blockDevice(path)
+	if err != nil {
+		return nil, fmt.Errorf("iostat: %s", err)
+	}
+	if _, err := readDiskCounters(dev); err != nil {
+		return nil, fmt.Errorf("iostat: %s", err)
+	}
+	return &diskSampler{dev: dev}, nil
+}
+
+// start starts sampling the device every diskInterval. The returned function
+// stops sampling and returns the device's stats over the whole period. It
+// returns nil if the device couldn't be read.
+func (s *diskSampler) start() func() *diskStats {
+	first, err := readDiskCounters(s.dev)
+	if err != nil {
+		return func() *diskStats { return nil }
+	}
+	t := time.Now()
+	stats := &diskStats{Device: s.dev}
+
+	var mu sync.Mutex
+	prev, prevTime := first, t
+	sample := func() *diskCounters {
+		c, err := readDiskCounters(s.dev)
+		if err != nil {
+			return nil
+		}
+		now := time.Now()
+		mu.Lock()
+		defer mu.Unlock()
+		if d := now.Sub(prevTime); d > 0 {
+			if util := float64(c.ioTicks-prev.ioTicks) / float64(d); util > stats.MaxUtil {
+				stats.MaxUtil = util
+			}
+		}
+		if c.inFlight > stats.MaxInFlight {
+			stats.MaxInFlight = c.inFlight
+		}
+		prev, prevTime = c, now
+		return c
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(diskInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sample()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() *diskStats {
+		close(done)
+		wg.Wait()
+		last := sample()
+		if last == nil {
+			return nil
+		}
+		if d := time.Since(t); d > 0 {
+			stats.Util = float64(last.ioTicks-first.ioTicks) / float64(d)
+			stats.QueueDepth = float64(last.queueTime-first.queueTime) / float64(d)
+		}
+		stats.ReadBytes = (last.readSectors - first.readSectors) * 512
+		stats.WriteBytes = (last.writeSectors - first.writeSectors) * 512
+		return stats
+	}
+}
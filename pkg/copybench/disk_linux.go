@@ -0,0 +1,57 @@
+//go:build linux
+// +build linux
+
+package copybench
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// blockDevice returns the name of the block device, such as sda1, that holds
+// the file at path.
+func blockDevice(path string) (string, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return "", err
+	}
+	link := fmt.Sprintf("/sys/dev/block/%d:%d", unix.Major(uint64(st.Dev)), unix.Minor(uint64(st.Dev)))
+	dir, err := os.Readlink(link)
+	if err != nil {
+		return "", fmt.Errorf("%s is not on a block device", path)
+	}
+	return filepath.Base(dir), nil
+}
+
+// readDiskCounters reads the counters of the block device dev.
+func readDiskCounters(dev string) (*diskCounters, error) {
+	path := filepath.Join("/sys/class/block", dev, "stat")
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := strings.Fields(string(b))
+	if len(f) < 11 {
+		return nil, fmt.Errorf("%s: unexpected format", path)
+	}
+	var v [11]int64
+	for i := range v {
+		if v[i], err = strconv.ParseInt(f[i], 10, 64); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+	return &diskCounters{
+		readSectors:  v[2],
+		writeSectors: v[6],
+		inFlight:     v[8],
+		ioTicks:      time.Duration(v[9]) * time.Millisecond,
+		queueTime:    time.Duration(v[10]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package copybench
+
+import "fmt"
+
+// blockDevice is only supported on Linux.
+func blockDevice(path string) (string, error) {
+	return "", fmt.Errorf("only supported on Linux")
+}
+
+// readDiskCounters is only supported on Linux.
+func readDiskCounters(dev string) (*diskCounters, error) {
+	return nil, fmt.Errorf("only supported on Linux")
+}
@@ -0,0 +1,249 @@
+package copybench
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// engineBolt is the default engine, and the only one that supports every
+// workload, phase and command.
+const engineBolt = "bolt"
+
+// engineBbolt is etcd's maintained fork of bolt.
+const engineBbolt = "bbolt"
+
+// engineBadger is the Badger LSM tree.
+const engineBadger = "badger"
+
+// enginePebble is CockroachDB's Pebble LSM tree.
+const enginePebble = "pebble"
+
+// engineLevel is goleveldb, a Go port of LevelDB.
+const engineLevel = "leveldb"
+
+// engine is a storage engine that benchmark scenarios run against. Other
+// engines than bolt support seeding, the iterate workload and the copy phase.
+type engine interface {
+	// Seed writes the scenario's dataset to the empty store.
+	Seed() error
+
+	// Scan reads every key below end in a single consistent view of the
+	// store, calling fn, if set, after each key. It returns the number of keys
+	// read.
+	Scan(end []byte, fn func()) (int, error)
+
+	// Snapshot writes a consistent copy of the store to w and returns the
+	// number of bytes written.
+	Snapshot(w io.Writer) (int64, error)
+
+	// Size returns the size of the store in bytes.
+	Size() (int64, error)
+
+	Close() error
+}
+
+// freelister is implemented by engines that keep freed pages on a freelist
+// for reuse, so that its size can be reported at the end of each phase.
+type freelister interface {
+	Freelist() *freelistStats
+}
+
+// freelistStats holds the size of an engine's freelist. FreeAlloc is the
+// size in bytes of the free pages.
+type freelistStats struct {
+	FreePages    int `json:"free_pages"`
+	PendingPages int `json:"pending_pages"`
+	FreeAlloc    int `json:"free_alloc"`
+}
+
+// String summarizes the freelist on a single line.
+func (s *freelistStats) String() string {
+	return fmt.Sprintf("%d free, %d pending pages (%d bytes free)", s.FreePages, s.PendingPages, s.FreeAlloc)
+}
+
+// resumer is implemented by engines that can resume an interrupted seed.
+type resumer interface {
+	// Resume seeds the rest of the dataset into a partially seeded store
+	// and checks it holds the whole dataset. It returns the number of keys
+	// that were already seeded.
+	Resume() (int, error)
+}
+
+// mmapper is implemented by engines that memory map the database, so that
+// the number of times the map grew while seeding can be reported.
+type mmapper interface {
+	MmapGrowths() int
+}
+
+// openTimeout is the default open_timeout, and bounds the wait for the file
+// lock of the databases the bench creates itself, so that a database locked
+// by another handle is reported instead of hanging.
+const openTimeout = 5 * time.Second
+
+// lockWaiter is implemented by engines that record how long opening the store
+// blocked on its file lock.
+type lockWaiter interface {
+	LockWait() time.Duration
+}
+
+// preallocator is implemented by engines that extend new database files
+// before seeding, returning how long it took.
+type preallocator interface {
+	Preallocated() time.Duration
+}
+
+// batcher is implemented by engines that can seed with concurrent db.Batch
+// calls, returning the calls of the last seed.
+type batcher interface {
+	BatchStats() *batchStats
+}
+
+// engineOpener opens the store at path for the scenario cfg, creating it if
+// create is set.
+type engineOpener func(path string, create bool, cfg *Config) (engine, error)
+
+// engines maps engine names to their openers.
+var engines = map[string]engineOpener{
+	engineBolt:   openBoltEngine,
+	engineBbolt:  openBboltEngine,
+	engineBadger: openBadgerEngine,
+	enginePebble: openPebbleEngine,
+	engineLevel:  openLevelEngine,
+}
+
+// engineNames returns the names of the available engines, sorted.
+func engineNames() string {
+	var names []string
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// openEngine opens the store at path with the scenario's engine. Like open, it
+// refuses to create a store that already exists or to open a missing one.
+func openEngine(path string, create bool, cfg *Config) (engine, error) {
+	if err := checkPath(path, create); err != nil {
+		return nil, err
+	}
+	return engines[cfg.Engine](path, create, cfg)
+}
+
+// seedBatches generates the scenario's dataset for engines without buckets,
+// from the key with index start on, calling put with the keys and values of
+// each batch of up to BatchSize keys in the insert order. put returns the size
+// of the store after the batch.
+func seedBatches(cfg *Config, start int, put func(keys, values [][]byte) (int64, error)) error {
+	log.Print("seeding")
+
+	count := start
+	r := newSeedRand(cfg, start)
+	order := cfg.insertOrder()
+	progress := newSeedProgress(cfg.ItemCount, start)
+	for count < cfg.ItemCount {
+		if isInterrupted() {
+			return fmt.Errorf("interrupted after %d of %d rows (resume with seed -resume)", count, cfg.ItemCount)
+		}
+		var keys, values [][]byte
+		for j := 0; j < cfg.BatchSize && count < cfg.ItemCount; j++ {
+			k := make([]byte, cfg.KeySize)
+			cfg.encodeKey(k, order(count))
+			v := make([]byte, cfg.valueSize(r))
+			cfg.fillValue(k, v)
+			keys, values = append(keys, k), append(values, v)
+			count++
+		}
+		size, err := put(keys, values)
+		if err != nil {
+			return err
+		}
+		progress.update(count, size)
+	}
+	progress.done()
+	log.Print("(done)")
+	fmt.Fprintln(stdout, "")
+	return nil
+}
+
+// dirSize returns the total size of the files under the directory at path,
+// for engines that store their data in several files.
+func dirSize(path string) (int64, error) {
+	var sz int64
+	err := filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if fi.Mode().IsRegular() {
+			sz += fi.Size()
+		}
+		return nil
+	})
+	return sz, err
+}
+
+// validateEngine returns an error if the scenario uses features that only the
+// bolt engine supports.
+func (c *Config) validateEngine() error {
+	if engines[c.Engine] == nil {
+		return fmt.Errorf("unknown engine: %s (available: %s)", c.Engine, engineNames())
+	} else if (c.NoFreelistSync || c.FreelistType != "") && c.Engine != engineBbolt {
+		return fmt.Errorf("the %s engine does not support freelist options", c.Engine)
+	} else if c.SeedMode != seedModeUpdate && c.Engine != engineBolt {
+		return fmt.Errorf("the %s engine does not support seed_mode %s", c.Engine, c.SeedMode)
+	} else if c.FillPercent != 0 && c.Engine != engineBolt && c.Engine != engineBbolt {
+		return fmt.Errorf("the %s engine does not support fill_percent", c.Engine)
+	} else if (c.NoGrowSync || c.Preallocate != 0) && c.Engine != engineBolt && c.Engine != engineBbolt {
+		return fmt.Errorf("the %s engine does not support no_grow_sync or preallocate", c.Engine)
+	} else if c.PageSize != 0 && c.Engine != engineBbolt {
+		return fmt.Errorf("the %s engine does not support page_size (bolt always uses the OS page size, try bbolt)", c.Engine)
+	} else if c.Engine == engineBolt {
+		return nil
+	} else if c.VerifyCopies {
+		return fmt.Errorf("the %s engine does not support verify_copies", c.Engine)
+	} else if c.VerifySnapshot {
+		return fmt.Errorf("the %s engine does not support verify_snapshot", c.Engine)
+	}
+
+	for _, p := range c.Phases {
+		if p != phaseWarmup && p != phaseIterate && p != phaseCopy {
+			return fmt.Errorf("the %s engine does not support the %s phase", c.Engine, p)
+		} else if w := c.workload(p); w != workloadIterate {
+			return fmt.Errorf("the %s engine does not support the %s workload", c.Engine, w)
+		}
+	}
+	switch {
+	case c.Mix != "":
+		return fmt.Errorf("the %s engine does not support mix", c.Engine)
+	case c.DeleteRate > 0 || c.UpdateRate > 0:
+		return fmt.Errorf("the %s engine does not support background writers", c.Engine)
+	case c.Buckets != 1 || c.NestDepth != 0:
+		return fmt.Errorf("the %s engine does not support buckets", c.Engine)
+	case c.KeyPrefixes != 0:
+		return fmt.Errorf("the %s engine does not support key_prefixes", c.Engine)
+	case c.CopyMethod != copyMethodCopy:
+		return fmt.Errorf("the %s engine does not support copy_method", c.Engine)
+	case c.NoSync && c.Engine != engineBbolt:
+		return fmt.Errorf("the %s engine does not support nosync", c.Engine)
+	case c.InitialMmapSize != 0 && c.Engine != engineBbolt:
+		return fmt.Errorf("the %s engine does not support initial_mmap_size", c.Engine)
+	case c.MmapPopulate && c.Engine != engineBbolt:
+		return fmt.Errorf("the %s engine does not support mmap_populate", c.Engine)
+	case c.SeparateReader && c.Engine != engineBbolt:
+		return fmt.Errorf("the %s engine does not support separate_reader", c.Engine)
+	}
+	return nil
+}
+
+// requireBolt returns an error if the scenario's engine is not bolt.
+func requireBolt(cfg *Config, command string) error {
+	if cfg.Engine != engineBolt {
+		return fmt.Errorf("%s only supports the bolt engine", command)
+	}
+	return nil
+}
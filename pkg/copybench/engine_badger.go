@@ -0,0 +1,76 @@
+package copybench
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/dgraph-io/badger"
+)
+
+// badgerEngine runs scenarios against a Badger database, which is a directory
+// holding the LSM tree and value log.
+type badgerEngine struct {
+	db   *badger.DB
+	cfg  *Config
+	path string
+}
+
+// openBadgerEngine opens the Badger database in the directory at path.
+func openBadgerEngine(path string, create bool, cfg *Config) (engine, error) {
+	db, err := badger.Open(badger.DefaultOptions(path).WithLogger(nil))
+	if err != nil {
+		return nil, err
+	}
+	return &badgerEngine{db: db, cfg: cfg, path: path}, nil
+}
+
+// Seed inserts the dataset with a write batch per batch of keys.
+func (e *badgerEngine) Seed() error {
+	return seedBatches(e.cfg, 0, func(keys, values [][]byte) (int64, error) {
+		wb := e.db.NewWriteBatch()
+		defer wb.Cancel()
+		for i, k := range keys {
+			if err := wb.Set(k, values[i]); err != nil {
+				return 0, err
+			}
+		}
+		if err := wb.Flush(); err != nil {
+			return 0, err
+		}
+		return e.Size()
+	})
+}
+
+// Scan reads the keys below end, and their values, with an iterator in a
+// read-only transaction.
+func (e *badgerEngine) Scan(end []byte, fn func()) (int, error) {
+	var count int
+	err := e.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid() && bytes.Compare(it.Item().Key(), end) < 0; it.Next() {
+			if err := it.Item().Value(func([]byte) error { return nil }); err != nil {
+				return err
+			}
+			count++
+			if fn != nil {
+				fn()
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Snapshot writes a full backup of the database with DB.Backup, which streams
+// every key and value at a single read timestamp.
+func (e *badgerEngine) Snapshot(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	_, err := e.db.Backup(cw, 0)
+	return cw.n, err
+}
+
+// Size returns the size of the database's files.
+func (e *badgerEngine) Size() (int64, error) { return dirSize(e.path) }
+
+func (e *badgerEngine) Close() error { return e.db.Close() }
@@ -0,0 +1,191 @@
+package copybench
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	bbolt "go.etcd.io/bbolt"
+)
+
+// bboltEngine runs scenarios against a bbolt database, storing the dataset in
+// a single bucket named like bolt's.
+type bboltEngine struct {
+	db       *bbolt.DB
+	cfg      *Config
+	mmap     *mmapTracker
+	lockWait time.Duration
+	prealloc time.Duration
+}
+
+// openBboltEngine opens the bbolt database at path with the scenario's
+// freelist and mmap options and, for a new database, page size. It is opened
+// read-only if the scenario uses a separate reader.
+func openBboltEngine(path string, create bool, cfg *Config) (engine, error) {
+	readOnly := cfg.SeparateReader && !create
+	wait, err := waitLock(path, readOnly, cfg.OpenTimeout.Duration)
+	if err != nil {
+		return nil, err
+	}
+	var prealloc time.Duration
+	if create && cfg.Preallocate > 0 {
+		prealloc, err = preallocate(path, int64(cfg.Preallocate), func() error {
+			db, err := bbolt.Open(path, 0600, &bbolt.Options{PageSize: cfg.PageSize})
+			if err != nil {
+				return err
+			}
+			return db.Close()
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{
+		Timeout:         cfg.OpenTimeout.Duration,
+		ReadOnly:        readOnly,
+		NoGrowSync:      cfg.NoGrowSync,
+		NoFreelistSync:  cfg.NoFreelistSync,
+		FreelistType:    bbolt.FreelistType(cfg.FreelistType),
+		InitialMmapSize: cfg.InitialMmapSize,
+		MmapFlags:       cfg.mmapFlags(),
+		PageSize:        cfg.PageSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	mmap, err := newMmapTracker(path, cfg.InitialMmapSize)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &bboltEngine{db: db, cfg: cfg, mmap: mmap, lockWait: wait, prealloc: prealloc}, nil
+}
+
+// Seed inserts the dataset in batched write transactions. With nosync, the
+// commits are not fsynced and the database is synced once at the end.
+func (e *bboltEngine) Seed() error {
+	return e.seedFrom(0)
+}
+
+// Resume seeds the keys after the highest key of an interrupted seed, and then
+// checks that the bucket holds every key.
+func (e *bboltEngine) Resume() (int, error) {
+	var start int
+	err := e.db.View(func(tx *bbolt.Tx) error {
+		if b := tx.Bucket(bucketName); b != nil {
+			if k, _ := b.Cursor().Last(); k != nil {
+				start = e.cfg.decodeKey(k) + 1
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := e.seedFrom(start); err != nil {
+		return 0, err
+	}
+	var count int
+	err = e.db.View(func(tx *bbolt.Tx) error {
+		count = tx.Bucket(bucketName).Stats().KeyN
+		return nil
+	})
+	if err == nil && count != e.cfg.ItemCount {
+		err = fmt.Errorf("invalid item count: %d != %d", count, e.cfg.ItemCount)
+	}
+	return start, err
+}
+
+// seedFrom seeds the keys from index start on.
+func (e *bboltEngine) seedFrom(start int) error {
+	e.db.NoSync = e.cfg.NoSync
+	defer func() { e.db.NoSync = false }()
+	err := seedBatches(e.cfg, start, func(keys, values [][]byte) (int64, error) {
+		var size int64
+		err := e.db.Update(func(tx *bbolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists(bucketName)
+			if err != nil {
+				return fmt.Errorf("create bucket: %s", err)
+			}
+			if e.cfg.FillPercent != 0 {
+				b.FillPercent = e.cfg.FillPercent
+			}
+			for i, k := range keys {
+				if err := b.Put(k, values[i]); err != nil {
+					return fmt.Errorf("put: %s", err)
+				}
+			}
+			size = tx.Size()
+			return nil
+		})
+		e.mmap.observe(size)
+		return size, err
+	})
+	if err != nil {
+		return err
+	}
+	if e.cfg.NoSync {
+		return e.db.Sync()
+	}
+	return nil
+}
+
+// Scan reads the keys below end with a cursor in a read transaction.
+func (e *bboltEngine) Scan(end []byte, fn func()) (int, error) {
+	var count int
+	err := e.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketName)
+		if b == nil {
+			return fmt.Errorf("bucket not found: %s", bucketName)
+		}
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = c.Next() {
+			count++
+			if fn != nil {
+				fn()
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Snapshot copies the database with Tx.WriteTo, which replaced Tx.Copy in
+// bbolt.
+func (e *bboltEngine) Snapshot(w io.Writer) (int64, error) {
+	var n int64
+	err := e.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// Size returns the size of the database file.
+func (e *bboltEngine) Size() (int64, error) {
+	var sz int64
+	err := e.db.View(func(tx *bbolt.Tx) error {
+		sz = tx.Size()
+		return nil
+	})
+	return sz, err
+}
+
+// MmapGrowths returns the estimated number of times the memory map grew.
+func (e *bboltEngine) MmapGrowths() int { return e.mmap.growths }
+
+// Preallocated returns how long extending the new database file took.
+func (e *bboltEngine) Preallocated() time.Duration { return e.prealloc }
+
+// LockWait returns how long opening the database waited for its file lock.
+func (e *bboltEngine) LockWait() time.Duration { return e.lockWait }
+
+// Freelist returns the size of bbolt's freelist.
+func (e *bboltEngine) Freelist() *freelistStats {
+	s := e.db.Stats()
+	return &freelistStats{FreePages: s.FreePageN, PendingPages: s.PendingPageN, FreeAlloc: s.FreeAlloc}
+}
+
+func (e *bboltEngine) Close() error { return e.db.Close() }
@@ -0,0 +1,148 @@
+package copybench
+
+import (
+	"io"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// boltEngine runs scenarios against a bolt database.
+type boltEngine struct {
+	db       *bolt.DB
+	cfg      *Config
+	mmap     *mmapTracker
+	lockWait time.Duration
+	prealloc time.Duration
+	batch    *batchStats
+}
+
+// openBoltEngine opens the bolt database at path with the scenario's mmap
+// options, read-only if the scenario uses a separate reader.
+func openBoltEngine(path string, create bool, cfg *Config) (engine, error) {
+	readOnly := cfg.SeparateReader && !create
+	wait, err := waitLock(path, readOnly, cfg.OpenTimeout.Duration)
+	if err != nil {
+		return nil, err
+	}
+	var prealloc time.Duration
+	if create && cfg.Preallocate > 0 {
+		prealloc, err = preallocate(path, int64(cfg.Preallocate), func() error {
+			db, err := bolt.Open(path, 0600, nil)
+			if err != nil {
+				return err
+			}
+			return db.Close()
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{
+		Timeout:         cfg.OpenTimeout.Duration,
+		ReadOnly:        readOnly,
+		NoGrowSync:      cfg.NoGrowSync,
+		InitialMmapSize: cfg.InitialMmapSize,
+		MmapFlags:       cfg.mmapFlags(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	mmap, err := newMmapTracker(path, cfg.InitialMmapSize)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltEngine{db: db, cfg: cfg, mmap: mmap, lockWait: wait, prealloc: prealloc}, nil
+}
+
+// Seed inserts the dataset in batched write transactions. With nosync, the
+// commits are not fsynced and the database is synced once at the end.
+func (e *boltEngine) Seed() error {
+	return e.seedFrom(0)
+}
+
+// Resume seeds the keys missing after an interrupted seed, those after the
+// highest key seeded, and then verifies the dataset.
+func (e *boltEngine) Resume() (int, error) {
+	start, err := seeded(e.db, e.cfg)
+	if err != nil {
+		return 0, err
+	}
+	if err := e.seedFrom(start); err != nil {
+		return 0, err
+	}
+	return start, verify(e.db, e.cfg)
+}
+
+// seedFrom seeds the keys from index start on.
+func (e *boltEngine) seedFrom(start int) error {
+	e.db.NoSync = e.cfg.NoSync
+	defer func() { e.db.NoSync = false }()
+	var err error
+	if e.cfg.SeedMode == seedModeBatch {
+		e.batch = &batchStats{}
+		err = seedBatch(e.db, e.cfg, e.mmap, start, e.batch)
+	} else {
+		err = seed(e.db, e.cfg, e.mmap, start)
+	}
+	if err != nil {
+		return err
+	}
+	if e.cfg.NoSync {
+		return e.db.Sync()
+	}
+	return nil
+}
+
+// Scan reads the keys below end in every bucket in a read transaction.
+func (e *boltEngine) Scan(end []byte, fn func()) (int, error) {
+	var count int
+	err := e.db.View(func(tx *bolt.Tx) error {
+		count = scan(tx, e.cfg, end, false, fn)
+		return nil
+	})
+	return count, err
+}
+
+// Snapshot copies the database with Tx.Copy.
+func (e *boltEngine) Snapshot(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	err := e.db.View(func(tx *bolt.Tx) error {
+		return tx.Copy(cw)
+	})
+	return cw.n, err
+}
+
+// Size returns the size of the database file.
+func (e *boltEngine) Size() (int64, error) { return size(e.db) }
+
+// MmapGrowths returns the estimated number of times the memory map grew.
+func (e *boltEngine) MmapGrowths() int { return e.mmap.growths }
+
+// Preallocated returns how long extending the new database file took.
+func (e *boltEngine) Preallocated() time.Duration { return e.prealloc }
+
+// LockWait returns how long opening the database waited for its file lock.
+func (e *boltEngine) LockWait() time.Duration { return e.lockWait }
+
+// BatchStats returns the db.Batch calls of the last seed, or nil if it didn't
+// use db.Batch.
+func (e *boltEngine) BatchStats() *batchStats { return e.batch }
+
+// Freelist returns the size of bolt's freelist.
+func (e *boltEngine) Freelist() *freelistStats {
+	s := e.db.Stats()
+	return &freelistStats{FreePages: s.FreePageN, PendingPages: s.PendingPageN, FreeAlloc: s.FreeAlloc}
+}
+
+func (e *boltEngine) Close() error { return e.db.Close() }
+
+// boltDB returns the bolt database behind eng, or nil if eng is another
+// engine.
+func boltDB(eng engine) *bolt.DB {
+	if e, ok := eng.(*boltEngine); ok {
+		return e.db
+	}
+	return nil
+}
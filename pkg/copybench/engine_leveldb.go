@@ -0,0 +1,97 @@
+package copybench
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// levelEngine runs scenarios against a goleveldb database, which is a
+// directory of sorted tables and a journal.
+type levelEngine struct {
+	db   *leveldb.DB
+	cfg  *Config
+	path string
+}
+
+// openLevelEngine opens the goleveldb database in the directory at path.
+func openLevelEngine(path string, create bool, cfg *Config) (engine, error) {
+	db, err := leveldb.OpenFile(path, &opt.Options{ErrorIfMissing: !create, ErrorIfExist: create})
+	if err != nil {
+		return nil, err
+	}
+	return &levelEngine{db: db, cfg: cfg, path: path}, nil
+}
+
+// Seed inserts the dataset with a synced batch write per batch of keys.
+func (e *levelEngine) Seed() error {
+	return seedBatches(e.cfg, 0, func(keys, values [][]byte) (int64, error) {
+		var b leveldb.Batch
+		for i, k := range keys {
+			b.Put(k, values[i])
+		}
+		if err := e.db.Write(&b, &opt.WriteOptions{Sync: true}); err != nil {
+			return 0, err
+		}
+		return e.Size()
+	})
+}
+
+// Scan reads the keys below end, and their values, with an iterator, which
+// sees a consistent view of the database.
+func (e *levelEngine) Scan(end []byte, fn func()) (int, error) {
+	it := e.db.NewIterator(&util.Range{Limit: end}, nil)
+	defer it.Release()
+	var count int
+	for it.Next() {
+		count++
+		if fn != nil {
+			fn()
+		}
+	}
+	return count, it.Error()
+}
+
+// Snapshot writes every key and value of a database snapshot to w, as it has
+// no backup API of its own. Each key and value is preceded by its length as a
+// uvarint.
+func (e *levelEngine) Snapshot(w io.Writer) (int64, error) {
+	snap, err := e.db.GetSnapshot()
+	if err != nil {
+		return 0, err
+	}
+	defer snap.Release()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	it := snap.NewIterator(nil, nil)
+	defer it.Release()
+	buf := make([]byte, binary.MaxVarintLen64)
+	for it.Next() {
+		for _, p := range [][]byte{it.Key(), it.Value()} {
+			n := binary.PutUvarint(buf, uint64(len(p)))
+			if _, err := bw.Write(buf[:n]); err != nil {
+				return 0, err
+			}
+			if _, err := bw.Write(p); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return 0, err
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+	return cw.n, nil
+}
+
+// Size returns the size of the database's files.
+func (e *levelEngine) Size() (int64, error) { return dirSize(e.path) }
+
+func (e *levelEngine) Close() error { return e.db.Close() }
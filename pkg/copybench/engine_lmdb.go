@@ -0,0 +1,146 @@
+//go:build lmdb
+// +build lmdb
+
+package copybench
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bmatsuo/lmdb-go/lmdb"
+)
+
+// engineLMDB is LMDB, the C B+tree bolt was modeled on. It needs cgo and is
+// only built with the lmdb build tag.
+const engineLMDB = "lmdb"
+
+// lmdbMapSize is the size of LMDB's memory map, which bounds the size of the
+// database. Only the pages in use take up space in the file.
+const lmdbMapSize = 1 << 40
+
+func init() {
+	engines[engineLMDB] = openLMDBEngine
+}
+
+// lmdbEngine runs scenarios against an LMDB environment stored in a single
+// file, like bolt, with a lock file next to it.
+type lmdbEngine struct {
+	env *lmdb.Env
+	dbi lmdb.DBI
+	cfg *Config
+}
+
+// openLMDBEngine opens the LMDB environment at path and its root database.
+func openLMDBEngine(path string, create bool, cfg *Config) (engine, error) {
+	env, err := lmdb.NewEnv()
+	if err != nil {
+		return nil, err
+	}
+	if err := env.SetMapSize(lmdbMapSize); err != nil {
+		env.Close()
+		return nil, err
+	}
+	if err := env.Open(path, lmdb.NoSubdir, 0600); err != nil {
+		env.Close()
+		return nil, err
+	}
+
+	e := &lmdbEngine{env: env, cfg: cfg}
+	err = env.View(func(txn *lmdb.Txn) error {
+		e.dbi, err = txn.OpenRoot(0)
+		return err
+	})
+	if err != nil {
+		env.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// Seed inserts the dataset in batched write transactions.
+func (e *lmdbEngine) Seed() error {
+	return seedBatches(e.cfg, 0, func(keys, values [][]byte) (int64, error) {
+		err := e.env.Update(func(txn *lmdb.Txn) error {
+			for i, k := range keys {
+				if err := txn.Put(e.dbi, k, values[i], 0); err != nil {
+					return fmt.Errorf("put: %s", err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		return e.Size()
+	})
+}
+
+// Scan reads the keys below end with a cursor in a read transaction. Keys and
+// values are read in place from the memory map, as with bolt.
+func (e *lmdbEngine) Scan(end []byte, fn func()) (int, error) {
+	var count int
+	err := e.env.View(func(txn *lmdb.Txn) error {
+		txn.RawRead = true
+		c, err := txn.OpenCursor(e.dbi)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		for k, _, err := c.Get(nil, nil, lmdb.First); ; k, _, err = c.Get(nil, nil, lmdb.Next) {
+			if lmdb.IsNotFound(err) {
+				return nil
+			} else if err != nil {
+				return err
+			} else if bytes.Compare(k, end) >= 0 {
+				return nil
+			}
+			count++
+			if fn != nil {
+				fn()
+			}
+		}
+	})
+	return count, err
+}
+
+// Snapshot copies the environment with mdb_env_copyfd, the streaming form of
+// mdb_env_copy, through a pipe to w.
+func (e *lmdbEngine) Snapshot(w io.Writer) (int64, error) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer pr.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		err := e.env.CopyFD(pw.Fd())
+		pw.Close()
+		errc <- err
+	}()
+	n, err := io.Copy(w, pr)
+	if err != nil {
+		// Unblock the copy before waiting for it.
+		pr.Close()
+		<-errc
+		return n, err
+	}
+	return n, <-errc
+}
+
+// Size returns the size of the pages in use.
+func (e *lmdbEngine) Size() (int64, error) {
+	info, err := e.env.Info()
+	if err != nil {
+		return 0, err
+	}
+	st, err := e.env.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return (info.LastPNO + 1) * int64(st.PSize), nil
+}
+
+func (e *lmdbEngine) Close() error { return e.env.Close() }
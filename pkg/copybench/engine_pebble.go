@@ -0,0 +1,128 @@
+package copybench
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// pebbleEngine runs scenarios against a Pebble database, which is a directory
+// of sstables, a write-ahead log and a manifest.
+type pebbleEngine struct {
+	db   *pebble.DB
+	cfg  *Config
+	path string
+}
+
+// openPebbleEngine opens the Pebble database in the directory at path.
+func openPebbleEngine(path string, create bool, cfg *Config) (engine, error) {
+	db, err := pebble.Open(path, &pebble.Options{})
+	if err != nil {
+		return nil, err
+	}
+	return &pebbleEngine{db: db, cfg: cfg, path: path}, nil
+}
+
+// Seed inserts the dataset with a synced batch per batch of keys.
+func (e *pebbleEngine) Seed() error {
+	return seedBatches(e.cfg, 0, func(keys, values [][]byte) (int64, error) {
+		b := e.db.NewBatch()
+		defer b.Close()
+		for i, k := range keys {
+			if err := b.Set(k, values[i], nil); err != nil {
+				return 0, err
+			}
+		}
+		if err := b.Commit(pebble.Sync); err != nil {
+			return 0, err
+		}
+		return e.Size()
+	})
+}
+
+// Scan reads the keys below end, and their values, with an iterator, which
+// sees a consistent view of the database.
+func (e *pebbleEngine) Scan(end []byte, fn func()) (int, error) {
+	it, err := e.db.NewIter(&pebble.IterOptions{UpperBound: end})
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	for valid := it.First(); valid; valid = it.Next() {
+		if _, err := it.ValueAndErr(); err != nil {
+			it.Close()
+			return count, err
+		}
+		count++
+		if fn != nil {
+			fn()
+		}
+	}
+	return count, it.Close()
+}
+
+// Snapshot takes a checkpoint of the database, which hard links its sstables
+// into a new directory next to it, and writes the checkpoint's files to w as a
+// tar archive. The checkpoint is removed afterwards.
+func (e *pebbleEngine) Snapshot(w io.Writer) (int64, error) {
+	tmp, err := ioutil.TempDir(filepath.Dir(e.path), "checkpoint-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmp)
+
+	dir := filepath.Join(tmp, "db")
+	if err := e.db.Checkpoint(dir); err != nil {
+		return 0, err
+	}
+
+	cw := &countingWriter{w: w}
+	if err := writeTar(cw, dir); err != nil {
+		return 0, err
+	}
+	return cw.n, nil
+}
+
+// Size returns the size of the database's files.
+func (e *pebbleEngine) Size() (int64, error) { return dirSize(e.path) }
+
+func (e *pebbleEngine) Close() error { return e.db.Close() }
+
+// writeTar writes the regular files in the directory at dir to w as a tar
+// archive.
+func writeTar(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.Mode().IsRegular() {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(name)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
@@ -0,0 +1,171 @@
+//go:build cgo
+// +build cgo
+
+package copybench
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// engineSQLite is SQLite, storing the dataset in a key/value table. Its
+// driver needs cgo.
+const engineSQLite = "sqlite"
+
+func init() {
+	engines[engineSQLite] = openSQLiteEngine
+}
+
+// sqliteBackupPages is the number of pages copied by each step of an online
+// backup. The source is only locked while a step runs.
+const sqliteBackupPages = 1024
+
+// sqliteEngine runs scenarios against a SQLite database in WAL mode, holding
+// the dataset in a kv table keyed by the key.
+type sqliteEngine struct {
+	db   *sql.DB
+	cfg  *Config
+	path string
+}
+
+// openSQLiteEngine opens the SQLite database at path and creates the kv table
+// if create is set.
+func openSQLiteEngine(path string, create bool, cfg *Config) (engine, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	if create {
+		if _, err := db.Exec("CREATE TABLE kv (k BLOB PRIMARY KEY, v BLOB) WITHOUT ROWID"); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("create table: %s", err)
+		}
+	}
+	return &sqliteEngine{db: db, cfg: cfg, path: path}, nil
+}
+
+// Seed inserts the dataset in a transaction per batch of keys.
+func (e *sqliteEngine) Seed() error {
+	return seedBatches(e.cfg, 0, func(keys, values [][]byte) (int64, error) {
+		tx, err := e.db.Begin()
+		if err != nil {
+			return 0, err
+		}
+		defer tx.Rollback()
+		stmt, err := tx.Prepare("INSERT INTO kv (k, v) VALUES (?, ?)")
+		if err != nil {
+			return 0, err
+		}
+		defer stmt.Close()
+		for i, k := range keys {
+			if _, err := stmt.Exec(k, values[i]); err != nil {
+				return 0, fmt.Errorf("insert: %s", err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+		return e.Size()
+	})
+}
+
+// Scan reads the keys below end, and their values, with a single query.
+func (e *sqliteEngine) Scan(end []byte, fn func()) (int, error) {
+	rows, err := e.db.Query("SELECT k, v FROM kv WHERE k < ? ORDER BY k", end)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var count int
+	var k, v sql.RawBytes
+	for rows.Next() {
+		if err := rows.Scan(&k, &v); err != nil {
+			return count, err
+		}
+		count++
+		if fn != nil {
+			fn()
+		}
+	}
+	return count, rows.Err()
+}
+
+// Snapshot copies the database with the online backup API to a temporary file
+// next to it, sqliteBackupPages pages at a time, and then writes the file to
+// w. The temporary file is removed afterwards.
+func (e *sqliteEngine) Snapshot(w io.Writer) (int64, error) {
+	f, err := ioutil.TempFile(filepath.Dir(e.path), "backup-")
+	if err != nil {
+		return 0, err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	if err := e.backup(f.Name()); err != nil {
+		return 0, err
+	}
+
+	if f, err = os.Open(f.Name()); err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(w, f)
+}
+
+// backup copies the database to the SQLite database at path.
+func (e *sqliteEngine) backup(path string) error {
+	dest, err := sql.Open("sqlite3", "file:"+path)
+	if err != nil {
+		return err
+	}
+	defer dest.Close()
+
+	ctx := context.Background()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := e.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(d interface{}) error {
+		return srcConn.Raw(func(s interface{}) error {
+			b, err := d.(*sqlite3.SQLiteConn).Backup("main", s.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return fmt.Errorf("backup: %s", err)
+			}
+			for done := false; !done; {
+				if done, err = b.Step(sqliteBackupPages); err != nil {
+					b.Close()
+					return fmt.Errorf("backup: %s", err)
+				}
+			}
+			return b.Finish()
+		})
+	})
+}
+
+// Size returns the size of the database's pages.
+func (e *sqliteEngine) Size() (int64, error) {
+	var pages, pageSize int64
+	if err := e.db.QueryRow("PRAGMA page_count").Scan(&pages); err != nil {
+		return 0, err
+	}
+	if err := e.db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return pages * pageSize, nil
+}
+
+func (e *sqliteEngine) Close() error { return e.db.Close() }
@@ -0,0 +1,67 @@
+package copybench
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+)
+
+// environment describes the machine and build a result was measured with, so
+// that results from different machines can be told apart.
+type environment struct {
+	Hostname  string `json:"hostname,omitempty"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Kernel    string `json:"kernel,omitempty"`
+	CPU       string `json:"cpu,omitempty"`
+	CPUs      int    `json:"cpus"`
+	GoVersion string `json:"go_version"`
+
+	// Modules holds the versions of the storage engine modules the binary
+	// was built with, such as bolt's, if it was built in module mode.
+	Modules map[string]string `json:"modules,omitempty"`
+
+	// Filesystem and MountOptions describe the mount holding the database.
+	Filesystem   string `json:"filesystem,omitempty"`
+	MountOptions string `json:"mount_options,omitempty"`
+}
+
+// engineModules are the modules whose versions are recorded in results.
+var engineModules = []string{
+	"github.com/boltdb/bolt",
+	"go.etcd.io/bbolt",
+	"github.com/dgraph-io/badger",
+	"github.com/cockroachdb/pebble",
+	"github.com/syndtr/goleveldb",
+	"github.com/bmatsuo/lmdb-go",
+	"github.com/mattn/go-sqlite3",
+}
+
+// captureEnvironment describes the current machine and build, and the
+// filesystem holding path. Details that can't be determined are left empty.
+func captureEnvironment(path string) *environment {
+	env := &environment{
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+		GoVersion: runtime.Version(),
+		Kernel:    kernelVersion(),
+		CPU:       cpuModel(),
+	}
+	env.Hostname, _ = os.Hostname()
+	if info, ok := debug.ReadBuildInfo(); ok {
+		env.Modules = make(map[string]string)
+		for _, m := range info.Deps {
+			for _, p := range engineModules {
+				if m.Path == p {
+					env.Modules[m.Path] = m.Version
+				}
+			}
+		}
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		env.Filesystem, env.MountOptions = mountOf(abs)
+	}
+	return env
+}
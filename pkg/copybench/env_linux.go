@@ -0,0 +1,71 @@
+//go:build linux
+// +build linux
+
+package copybench
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// kernelVersion returns the release of the running kernel.
+func kernelVersion() string {
+	var u unix.Utsname
+	if err := unix.Uname(&u); err != nil {
+		return ""
+	}
+	return unix.ByteSliceToString(u.Release[:])
+}
+
+// cpuModel returns the model name of the first CPU.
+func cpuModel() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		kv := strings.SplitN(s.Text(), ":", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == "model name" {
+			return strings.TrimSpace(kv[1])
+		}
+	}
+	return ""
+}
+
+// mountOf returns the filesystem type and mount options of the mount holding
+// the absolute path, from the mount with the longest mount point that
+// contains it.
+func mountOf(path string) (fstype, options string) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", ""
+	}
+	defer f.Close()
+
+	var best string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// ID PARENT MAJOR:MINOR ROOT MOUNTPOINT OPTIONS [OPTIONAL...] - FSTYPE SOURCE SUPEROPTIONS
+		parts := strings.SplitN(s.Text(), " - ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		a, b := strings.Fields(parts[0]), strings.Fields(parts[1])
+		if len(a) < 6 || len(b) < 1 {
+			continue
+		}
+		dir := a[4]
+		if !strings.HasPrefix(path, dir) || (dir != "/" && len(path) > len(dir) && path[len(dir)] != '/') {
+			continue
+		}
+		if len(dir) >= len(best) {
+			best, fstype, options = dir, b[0], a[5]
+		}
+	}
+	return fstype, options
+}
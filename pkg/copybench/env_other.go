@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package copybench
+
+// kernelVersion is only supported on Linux.
+func kernelVersion() string { return "" }
+
+// cpuModel is only supported on Linux.
+func cpuModel() string { return "" }
+
+// mountOf is only supported on Linux.
+func mountOf(path string) (fstype, options string) { return "", "" }
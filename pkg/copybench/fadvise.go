@@ -0,0 +1,54 @@
+package copybench
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// fadviseInterval is the number of bytes written to a copy destination
+// between each drop of the written range from the page cache.
+const fadviseInterval = 8 << 20
+
+// fadviseWriter writes to a file and drops the written pages from the page
+// cache every fadviseInterval bytes, so that the copy's pages don't evict the
+// source database's. Writes go through w, which writes to f.
+type fadviseWriter struct {
+	w       io.Writer
+	f       *os.File
+	off     int64
+	dropped int64
+
+	// n is the number of ranges dropped and d the time spent dropping them.
+	n int
+	d time.Duration
+}
+
+// Write writes p and drops the pages written since the last drop once there
+// are fadviseInterval bytes of them.
+func (w *fadviseWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.off += int64(n)
+	if err != nil {
+		return n, err
+	}
+	if w.off-w.dropped >= fadviseInterval {
+		if err := w.drop(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// drop drops the pages written since the last drop.
+func (w *fadviseWriter) drop() error {
+	if w.off == w.dropped {
+		return nil
+	}
+	t := time.Now()
+	err := dropRange(w.f, w.dropped, w.off-w.dropped)
+	w.d += time.Since(t)
+	w.n++
+	w.dropped = w.off
+	return err
+}
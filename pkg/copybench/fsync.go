@@ -0,0 +1,44 @@
+package copybench
+
+import (
+	"os"
+	"time"
+)
+
+// syncWriter writes to a file and fsyncs it every interval bytes, timing the
+// syncs. A zero interval never syncs on its own.
+type syncWriter struct {
+	f        *os.File
+	interval int64
+	pending  int64
+
+	// n is the number of syncs and d the total time spent in them.
+	n int
+	d time.Duration
+}
+
+// Write writes p to the file, syncing it whenever interval bytes have been
+// written since the last sync.
+func (w *syncWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.pending += int64(n)
+	if err != nil {
+		return n, err
+	}
+	if w.interval > 0 && w.pending >= w.interval {
+		if err := w.sync(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// sync fsyncs the file.
+func (w *syncWriter) sync() error {
+	t := time.Now()
+	err := w.f.Sync()
+	w.d += time.Since(t)
+	w.n++
+	w.pending = 0
+	return err
+}
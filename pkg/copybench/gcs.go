@@ -0,0 +1,47 @@
+package copybench
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+// gcsWriter streams a copy to a Google Cloud Storage object using a resumable
+// upload.
+type gcsWriter struct {
+	*storage.Writer
+	client *storage.Client
+	cancel context.CancelFunc
+}
+
+// openGCS starts an upload to gs://BUCKET/KEY using application default
+// credentials.
+func openGCS(ctx context.Context, u *url.URL) (io.WriteCloser, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	w := client.Bucket(u.Host).Object(strings.TrimPrefix(u.Path, "/")).NewWriter(ctx)
+	return &gcsWriter{Writer: w, client: client, cancel: cancel}, nil
+}
+
+// Close completes the upload and waits for it to finish.
+func (w *gcsWriter) Close() error {
+	defer w.cancel()
+	err := w.Writer.Close()
+	if e := w.client.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// Abort cancels the upload so that no object is created.
+func (w *gcsWriter) Abort() {
+	w.cancel()
+	w.Writer.Close()
+	w.client.Close()
+}
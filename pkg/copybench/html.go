@@ -0,0 +1,233 @@
+package copybench
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"math"
+	"strings"
+	"time"
+)
+
+// Chart geometry, in SVG user units.
+const (
+	chartWidth  = 760
+	chartHeight = 240
+	chartLeft   = 70
+	chartTop    = 10
+	chartBottom = 40
+)
+
+// chartColors are assigned to phases in order of appearance.
+var chartColors = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b"}
+
+// chart is a line chart rendered as inline SVG.
+type chart struct {
+	Title  string
+	XLabel string
+	YLabel string
+	XTicks []tick
+	YTicks []tick
+	Series []series
+}
+
+// tick is an axis label at a pixel offset.
+type tick struct {
+	Pos   float64
+	Label string
+}
+
+// series is a single named line of a chart.
+type series struct {
+	Name   string
+	Color  string
+	Points string
+}
+
+// writeHTML writes a self-contained HTML report with latency and throughput
+// charts to path. It is a no-op if path is empty.
+func (r *Result) writeHTML(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	cfg, err := json.MarshalIndent(r.Config, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, map[string]interface{}{
+		"Result": r,
+		"Config": string(cfg),
+		"Charts": []*chart{r.latencyChart(), r.throughputChart()},
+	}); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// start returns the time of the first recorded iteration pass.
+func (r *Result) start() time.Time {
+	var t time.Time
+	for _, p := range r.Phases {
+		if p.Iterate != nil && len(p.Iterate.Samples) > 0 {
+			if s := p.Iterate.Samples[0].Time; t.IsZero() || s.Before(t) {
+				t = s
+			}
+		}
+	}
+	return t
+}
+
+// latencyChart plots the duration of every iteration pass over time.
+func (r *Result) latencyChart() *chart {
+	start := r.start()
+	var data [][][2]float64
+	for _, p := range r.Phases {
+		var pts [][2]float64
+		if p.Iterate != nil {
+			for _, s := range p.Iterate.Samples {
+				pts = append(pts, [2]float64{s.Time.Sub(start).Seconds(), float64(s.Duration) / float64(time.Millisecond)})
+			}
+		}
+		data = append(data, pts)
+	}
+	return r.newChart("Iteration latency", "elapsed (s)", "pass duration (ms)", data)
+}
+
+// throughputChart plots the keys read per second, bucketed over time.
+func (r *Result) throughputChart() *chart {
+	start := r.start()
+
+	// Size buckets so a run is split into roughly 60 of them.
+	var end float64
+	for _, p := range r.Phases {
+		if p.Iterate != nil && len(p.Iterate.Samples) > 0 {
+			s := p.Iterate.Samples[len(p.Iterate.Samples)-1]
+			end = math.Max(end, s.Time.Add(s.Duration).Sub(start).Seconds())
+		}
+	}
+	width := math.Max(end/60, 0.1)
+
+	var data [][][2]float64
+	for _, p := range r.Phases {
+		var pts [][2]float64
+		if p.Iterate != nil {
+			buckets := make(map[int]int)
+			var lo, hi int
+			for i, s := range p.Iterate.Samples {
+				b := int(s.Time.Add(s.Duration).Sub(start).Seconds() / width)
+				buckets[b] += s.Keys
+				if i == 0 || b < lo {
+					lo = b
+				}
+				if b > hi {
+					hi = b
+				}
+			}
+			for b := lo; len(buckets) > 0 && b <= hi; b++ {
+				pts = append(pts, [2]float64{(float64(b) + 0.5) * width, float64(buckets[b]) / width})
+			}
+		}
+		data = append(data, pts)
+	}
+	return r.newChart("Iteration throughput", "elapsed (s)", "keys/sec", data)
+}
+
+// newChart scales one set of points per phase into a chart.
+func (r *Result) newChart(title, xlabel, ylabel string, data [][][2]float64) *chart {
+	var xmax, ymax float64
+	for _, pts := range data {
+		for _, pt := range pts {
+			xmax, ymax = math.Max(xmax, pt[0]), math.Max(ymax, pt[1])
+		}
+	}
+	if xmax == 0 {
+		xmax = 1
+	}
+	if ymax == 0 {
+		ymax = 1
+	}
+
+	c := &chart{Title: title, XLabel: xlabel, YLabel: ylabel}
+	for i := 0; i <= 4; i++ {
+		f := float64(i) / 4
+		c.XTicks = append(c.XTicks, tick{Pos: chartLeft + f*chartWidth, Label: fmt.Sprintf("%.3g", f*xmax)})
+		c.YTicks = append(c.YTicks, tick{Pos: chartTop + (1-f)*chartHeight, Label: fmt.Sprintf("%.3g", f*ymax)})
+	}
+
+	for i, pts := range data {
+		if len(pts) == 0 {
+			continue
+		}
+		var points []string
+		for _, pt := range pts {
+			x := chartLeft + pt[0]/xmax*chartWidth
+			y := chartTop + (1-pt[1]/ymax)*chartHeight
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		}
+		c.Series = append(c.Series, series{
+			Name:   r.Phases[i].Label(),
+			Color:  chartColors[i%len(chartColors)],
+			Points: strings.Join(points, " "),
+		})
+	}
+	return c
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"add": func(a, b float64) float64 { return a + b },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>copy-bench {{.Result.Command}} {{.Result.Time.Format "2006-01-02 15:04:05"}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 4px 10px; text-align: right; }
+th { background: #f0f0f0; }
+td:first-child { text-align: left; }
+pre { background: #f8f8f8; padding: 1em; }
+svg text { font-size: 11px; }
+</style>
+</head>
+<body>
+<h1>copy-bench {{.Result.Command}}</h1>
+<p>Run at {{.Result.Time.Format "2006-01-02 15:04:05 MST"}}, database size {{.Result.Size}} bytes.</p>
+
+<h2>Phases</h2>
+<table>
+<tr><th>phase</th><th>duration</th><th>passes</th><th>avg pass</th><th>p99 pass</th><th>copies</th></tr>
+{{range .Result.Phases}}<tr>
+<td>{{.Label}}</td>
+<td>{{.Duration}}</td>
+<td>{{if .Iterate}}{{.Iterate.N}}{{end}}</td>
+<td>{{if .Iterate}}{{.Iterate.Avg}}{{end}}</td>
+<td>{{if .Iterate}}{{with .Iterate.Latency}}{{.P99}}{{end}}{{end}}</td>
+<td>{{range .Copies}}{{.Duration}} ({{.Bytes}} bytes)<br>{{end}}</td>
+</tr>
+{{end}}</table>
+
+{{range .Charts}}
+<h2>{{.Title}}</h2>
+<svg width="850" height="290" xmlns="http://www.w3.org/2000/svg">
+<rect x="70" y="10" width="760" height="240" fill="none" stroke="#999"/>
+{{range .XTicks}}<text x="{{.Pos}}" y="265" text-anchor="middle">{{.Label}}</text>
+{{end}}{{range .YTicks}}<text x="64" y="{{add .Pos 4}}" text-anchor="end">{{.Label}}</text>
+<line x1="70" x2="830" y1="{{.Pos}}" y2="{{.Pos}}" stroke="#eee"/>
+{{end}}<text x="450" y="285" text-anchor="middle">{{.XLabel}}</text>
+<text x="12" y="130" text-anchor="middle" transform="rotate(-90 12 130)">{{.YLabel}}</text>
+{{range .Series}}<polyline fill="none" stroke="{{.Color}}" stroke-width="1" points="{{.Points}}"/>
+{{end}}</svg>
+<p>{{range .Series}}<span style="color: {{.Color}}">&#9632;</span> {{.Name}} &nbsp; {{end}}</p>
+{{end}}
+
+<h2>Configuration</h2>
+<pre>{{.Config}}</pre>
+</body>
+</html>
+`))
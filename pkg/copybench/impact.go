@@ -0,0 +1,162 @@
+package copybench
+
+import (
+	"fmt"
+	"time"
+)
+
+// copyImpact compares iteration during a copy with iteration without one.
+type copyImpact struct {
+	// Avg and CopyAvg are the mean pass durations without and during a copy.
+	Avg     time.Duration `json:"avg"`
+	CopyAvg time.Duration `json:"copy_avg"`
+
+	// P99 and CopyP99 are the mean 99th percentile pass durations without
+	// and during a copy.
+	P99     time.Duration `json:"p99"`
+	CopyP99 time.Duration `json:"copy_p99"`
+
+	// Throughput and CopyThroughput are the keys read per second of pass
+	// time without and during a copy, which is per reader if several ran.
+	Throughput     float64 `json:"throughput"`
+	CopyThroughput float64 `json:"copy_throughput"`
+
+	// phase is the phase compared with the iterate phase.
+	phase string
+}
+
+// copyImpact returns the impact of the copy phases on iteration, pooling every
+// repetition, or nil if r is missing either the iterate or copy phase.
+func (r *Result) copyImpact() *copyImpact {
+	return r.phaseImpact(phaseCopy)
+}
+
+// phaseImpact returns the impact of the named phases on iteration, like
+// copyImpact.
+func (r *Result) phaseImpact(phase string) *copyImpact {
+	base, copying := &iterateStats{}, &iterateStats{}
+	var baseP99, copyP99 []time.Duration
+	for _, p := range r.Phases {
+		if p.Iterate == nil {
+			continue
+		}
+		s, p99 := base, &baseP99
+		switch p.Name {
+		case phaseIterate:
+		case phase:
+			s, p99 = copying, &copyP99
+		default:
+			continue
+		}
+		s.N += p.Iterate.N
+		s.Keys += p.Iterate.Keys
+		s.Total += p.Iterate.Total
+		if p.Iterate.Latency != nil {
+			*p99 = append(*p99, p.Iterate.Latency.P99)
+		}
+	}
+	if base.N == 0 || copying.N == 0 {
+		return nil
+	}
+
+	return &copyImpact{
+		Avg:            base.Total / time.Duration(base.N),
+		CopyAvg:        copying.Total / time.Duration(copying.N),
+		P99:            meanDuration(baseP99),
+		CopyP99:        meanDuration(copyP99),
+		Throughput:     float64(base.Keys) / base.Total.Seconds(),
+		CopyThroughput: float64(copying.Keys) / copying.Total.Seconds(),
+		phase:          phase,
+	}
+}
+
+// coldStart compares the first pass over a freshly opened database, made by
+// the warmup phase, with the warm passes of the iterate phases.
+type coldStart struct {
+	Cold     time.Duration `json:"cold"`
+	Warm     time.Duration `json:"warm"`
+	Populate bool          `json:"populate,omitempty"`
+}
+
+// coldStart returns the cold and warm pass durations, or nil if r is missing
+// either the warmup or the iterate phase.
+func (r *Result) coldStart() *coldStart {
+	c := &coldStart{Populate: r.Config.MmapPopulate}
+	var warm iterateStats
+	for _, p := range r.Phases {
+		if p.Iterate == nil || p.Iterate.N == 0 {
+			continue
+		}
+		switch p.Name {
+		case phaseWarmup:
+			c.Cold = p.Iterate.Avg
+			if len(p.Iterate.Samples) > 0 {
+				c.Cold = p.Iterate.Samples[0].Duration
+			}
+		case phaseIterate:
+			warm.N += p.Iterate.N
+			warm.Total += p.Iterate.Total
+		}
+	}
+	if c.Cold == 0 || warm.N == 0 {
+		return nil
+	}
+	c.Warm = warm.Total / time.Duration(warm.N)
+	return c
+}
+
+// print writes the cold start summary to stdout.
+func (c *coldStart) print() {
+	label := "cold start"
+	if c.Populate {
+		label += " (mmap populated)"
+	}
+	fmt.Fprintln(stdout, label)
+	fmt.Fprintf(stdout, "first pass: %v, warm avg: %v (%s, %.1fx)\n",
+		c.Cold, c.Warm, signed(c.Cold-c.Warm), float64(c.Cold)/float64(c.Warm))
+	fmt.Fprintln(stdout, "")
+}
+
+// Slowdown returns the percentage increase of the mean pass duration.
+func (c *copyImpact) Slowdown() float64 {
+	return (float64(c.CopyAvg)/float64(c.Avg) - 1) * 100
+}
+
+// ThroughputLoss returns the percentage of read throughput lost to the copy.
+func (c *copyImpact) ThroughputLoss() float64 {
+	if c.Throughput == 0 {
+		return 0
+	}
+	return (1 - c.CopyThroughput/c.Throughput) * 100
+}
+
+// print writes the impact summary to stdout.
+func (c *copyImpact) print() {
+	fmt.Fprintf(stdout, "%s impact\n", c.phase)
+	fmt.Fprintf(stdout, "avg: %v -> %v (%s, %+.1f%%)\n", c.Avg, c.CopyAvg, signed(c.CopyAvg-c.Avg), c.Slowdown())
+	if c.P99 > 0 {
+		fmt.Fprintf(stdout, "p99: %v -> %v (%s)\n", c.P99, c.CopyP99, signed(c.CopyP99-c.P99))
+	}
+	fmt.Fprintf(stdout, "throughput: %.0f -> %.0f keys/s (%.1f%% lost)\n", c.Throughput, c.CopyThroughput, c.ThroughputLoss())
+	fmt.Fprintln(stdout, "")
+}
+
+// signed formats d with a leading sign.
+func signed(d time.Duration) string {
+	if d < 0 {
+		return d.String()
+	}
+	return "+" + d.String()
+}
+
+// meanDuration returns the mean of a, or zero if a is empty.
+func meanDuration(a []time.Duration) time.Duration {
+	if len(a) == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, d := range a {
+		sum += d
+	}
+	return sum / time.Duration(len(a))
+}
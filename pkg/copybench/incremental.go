@@ -0,0 +1,139 @@
+package copybench
+
+import (
+	"fmt"
+	"hash/crc64"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// incrementalStats compares a page-level delta backup with a full copy.
+type incrementalStats struct {
+	Full          *copyStats    `json:"full"`
+	Writes        int           `json:"writes"`
+	WriteDuration time.Duration `json:"write_duration"`
+	Duration      time.Duration `json:"duration"`
+	PageSize      int           `json:"page_size"`
+	Pages         int           `json:"pages"`
+	ChangedPages  int           `json:"changed_pages"`
+	Bytes         int64         `json:"bytes"`
+}
+
+// crcTable is used to fingerprint database pages.
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+// incremental takes a full snapshot of the database, applies the scenario's
+// incremental writes and then measures a delta backup holding only the pages
+// that changed since the snapshot.
+func incremental(db *bolt.DB, cfg *Config) (*incrementalStats, error) {
+	pageSize := db.Info().PageSize
+	stats := &incrementalStats{PageSize: pageSize, Writes: cfg.IncrementalWrites}
+
+	// Take the full snapshot, remembering a fingerprint of every page.
+	full := &pageWriter{size: pageSize}
+	t := time.Now()
+	if err := db.View(func(tx *bolt.Tx) error { return tx.Copy(full) }); err != nil {
+		return nil, err
+	}
+	stats.Full = &copyStats{Target: "full", Duration: time.Since(t), Bytes: full.n}
+
+	// Overwrite random keys so that some pages change.
+	t = time.Now()
+	if err := overwrite(db, cfg, cfg.IncrementalWrites); err != nil {
+		return nil, err
+	}
+	stats.WriteDuration = time.Since(t)
+
+	// Copy again, keeping only the pages whose fingerprint changed.
+	delta := &pageWriter{size: pageSize, prev: full.sums}
+	t = time.Now()
+	if err := db.View(func(tx *bolt.Tx) error { return tx.Copy(delta) }); err != nil {
+		return nil, err
+	}
+	stats.Duration = time.Since(t)
+	stats.Pages = len(delta.sums)
+	stats.ChangedPages = delta.changed
+	stats.Bytes = delta.deltaBytes
+
+	fmt.Fprintf(stdout, "full copy: %v (%d bytes)\n", stats.Full.Duration, stats.Full.Bytes)
+	fmt.Fprintf(stdout, "writes: %v (n=%d)\n", stats.WriteDuration, stats.Writes)
+	fmt.Fprintf(stdout, "incremental: %v (%d of %d pages changed, %d bytes, %.1f%% of full)\n",
+		stats.Duration, stats.ChangedPages, stats.Pages, stats.Bytes, float64(stats.Bytes)/float64(stats.Full.Bytes)*100)
+	return stats, nil
+}
+
+// overwrite replaces the values of n random keys with random data.
+func overwrite(db *bolt.DB, cfg *Config, n int) error {
+	keys := newKeyChooser(cfg)
+	r := newRand(cfg, streamOverwrite)
+	for i := 0; i < n; i += cfg.BatchSize {
+		err := db.Update(func(tx *bolt.Tx) error {
+			for j := 0; j < cfg.BatchSize && i+j < n; j++ {
+				k, v := make([]byte, cfg.KeySize), make([]byte, cfg.valueSize(r))
+				idx := keys.next(r)
+				cfg.encodeKey(k, idx)
+				cfg.rewriteValue(k, v, r)
+				if err := cfg.bucket(tx, idx).Put(k, v); err != nil {
+					return fmt.Errorf("put: %s", err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pageWriter fingerprints a database copy page by page. If prev holds the
+// fingerprints of an earlier copy, pages that differ from it are counted as
+// part of the delta, each along with its 8-byte page id.
+type pageWriter struct {
+	size int
+	prev []uint64
+	sums []uint64
+	buf  []byte
+	n    int64
+
+	changed    int
+	deltaBytes int64
+}
+
+// Write splits p into pages and fingerprints each complete page.
+func (w *pageWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	n := len(p)
+	for len(p) > 0 {
+		// Fingerprint whole pages straight from p when nothing is buffered.
+		if len(w.buf) == 0 && len(p) >= w.size {
+			w.page(p[:w.size])
+			p = p[w.size:]
+			continue
+		}
+
+		m := w.size - len(w.buf)
+		if m > len(p) {
+			m = len(p)
+		}
+		w.buf = append(w.buf, p[:m]...)
+		p = p[m:]
+		if len(w.buf) == w.size {
+			w.page(w.buf)
+			w.buf = w.buf[:0]
+		}
+	}
+	return n, nil
+}
+
+// page records the fingerprint of the next page.
+func (w *pageWriter) page(p []byte) {
+	id := len(w.sums)
+	sum := crc64.Checksum(p, crcTable)
+	w.sums = append(w.sums, sum)
+	if w.prev != nil && (id >= len(w.prev) || w.prev[id] != sum) {
+		w.changed++
+		w.deltaBytes += int64(8 + len(p))
+	}
+}
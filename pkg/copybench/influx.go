@@ -0,0 +1,191 @@
+package copybench
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// influxPending is the number of unsent lines the Influx exporter keeps while
+// its endpoint is unreachable. Older lines are dropped first.
+const influxPending = 10000
+
+// influxTimeout bounds each write to the Influx endpoint.
+const influxTimeout = 10 * time.Second
+
+// influxTagEscaper escapes tag keys and values in line protocol.
+var influxTagEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+
+// influxExporter pushes a copybench line in Influx line protocol to a write
+// endpoint every interval, with the passes, keys read and bytes copied since
+// the last one. Lines that fail to be written are retried with the next.
+// All methods are no-ops on a nil exporter.
+type influxExporter struct {
+	mu         sync.Mutex
+	url        string
+	token      string
+	tags       string
+	interval   time.Duration
+	last       time.Time
+	phase      string
+	passes     []time.Duration
+	lastKeys   int64
+	lastCopied int64
+	pending    []string
+
+	closing chan struct{}
+	done    chan struct{}
+}
+
+// startInfluxExporter starts pushing samples to the write endpoint url, such
+// as http://localhost:8086/write?db=bench for InfluxDB 1.x or
+// http://localhost:8086/api/v2/write?org=ORG&bucket=BUCKET for 2.x, every
+// interval. $INFLUX_TOKEN, if set, is sent as the API token. It returns nil if
+// url is empty.
+func startInfluxExporter(url string, interval time.Duration, command string, cfg *Config) *influxExporter {
+	if url == "" {
+		return nil
+	}
+	host, _ := os.Hostname()
+	x := &influxExporter{
+		url:        url,
+		token:      os.Getenv("INFLUX_TOKEN"),
+		tags:       influxTags(map[string]string{"command": command, "engine": cfg.Engine, "host": host}),
+		interval:   interval,
+		last:       time.Now(),
+		lastKeys:   atomic.LoadInt64(&keysRead),
+		lastCopied: atomic.LoadInt64(&bytesCopied),
+		closing:    make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	log.Printf("influx: pushing to %s every %v", url, interval)
+	go x.run()
+	return x
+}
+
+// influxTags formats tags as the ",key=value" suffix of a measurement, sorted
+// by key as Influx recommends. Empty values are left out.
+func influxTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&b, ",%s=%s", influxTagEscaper.Replace(k), influxTagEscaper.Replace(tags[k]))
+	}
+	return b.String()
+}
+
+// run pushes a sample every interval until the exporter is closed.
+func (x *influxExporter) run() {
+	defer close(x.done)
+	ticker := time.NewTicker(x.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-x.closing:
+			x.push(time.Now())
+			return
+		case t := <-ticker.C:
+			x.push(t)
+		}
+	}
+}
+
+// Close pushes a last sample, covering the end of the run, and stops the
+// exporter.
+func (x *influxExporter) Close() {
+	if x == nil {
+		return
+	}
+	close(x.closing)
+	<-x.done
+}
+
+// setPhase tags the following samples with phase.
+func (x *influxExporter) setPhase(phase string) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.phase = phase
+}
+
+// observe records a single iteration pass.
+func (x *influxExporter) observe(d time.Duration) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.passes = append(x.passes, d)
+}
+
+// line formats the sample taken at t, covering the passes since the last
+// one.
+func (x *influxExporter) line(t time.Time) string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	keys, copied := atomic.LoadInt64(&keysRead), atomic.LoadInt64(&bytesCopied)
+	s := t.Sub(x.last).Seconds()
+	fields := fmt.Sprintf("passes=%di,keys_per_sec=%f,copy_bytes_per_sec=%f", len(x.passes), float64(keys-x.lastKeys)/s, float64(copied-x.lastCopied)/s)
+	x.last, x.lastKeys, x.lastCopied = t, keys, copied
+	if n := len(x.passes); n > 0 {
+		sort.Slice(x.passes, func(i, j int) bool { return x.passes[i] < x.passes[j] })
+		q := func(q float64) int64 { return int64(x.passes[int(q*float64(n-1))]) }
+		fields += fmt.Sprintf(",p50_ns=%di,p99_ns=%di,max_ns=%di", q(0.5), q(0.99), q(1))
+		x.passes = x.passes[:0]
+	}
+	return fmt.Sprintf("copybench%s %s %d", x.tags+influxTags(map[string]string{"phase": x.phase}), fields, t.UnixNano())
+}
+
+// push writes the sample taken at t, along with any lines that failed to be
+// written before.
+func (x *influxExporter) push(t time.Time) {
+	x.pending = append(x.pending, x.line(t))
+	if len(x.pending) > influxPending {
+		x.pending = x.pending[len(x.pending)-influxPending:]
+	}
+	if err := x.write(strings.Join(x.pending, "\n") + "\n"); err != nil {
+		log.Printf("influx: %s (%d lines pending)", err, len(x.pending))
+		return
+	}
+	x.pending = x.pending[:0]
+}
+
+// write posts body to the write endpoint.
+func (x *influxExporter) write(body string) error {
+	req, err := http.NewRequest("POST", x.url, bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if x.token != "" {
+		req.Header.Set("Authorization", "Token "+x.token)
+	}
+	client := &http.Client{Timeout: influxTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
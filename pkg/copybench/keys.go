@@ -0,0 +1,132 @@
+package copybench
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+)
+
+// encodeKey writes the key with index i to k. Keys are the big-endian index
+// by default. With key_prefixes set, they are composite keys of a 4-byte
+// prefix and a 4-byte sequence number within the prefix, assigned so that
+// every prefix holds a contiguous run of indexes and keys still sort in index
+// order.
+func (c *Config) encodeKey(k []byte, i int) {
+	if c.KeyPrefixes == 0 {
+		binary.BigEndian.PutUint64(k, uint64(i))
+		return
+	}
+	n := c.perPrefix()
+	binary.BigEndian.PutUint32(k[0:4], uint32(i/n))
+	binary.BigEndian.PutUint32(k[4:8], uint32(i%n))
+}
+
+// decodeKey returns the index of the key k.
+func (c *Config) decodeKey(k []byte) int {
+	if c.KeyPrefixes == 0 {
+		return int(binary.BigEndian.Uint64(k))
+	}
+	return int(binary.BigEndian.Uint32(k[0:4]))*c.perPrefix() + int(binary.BigEndian.Uint32(k[4:8]))
+}
+
+// perPrefix returns the number of keys sharing each prefix.
+func (c *Config) perPrefix() int {
+	return (c.ItemCount + c.KeyPrefixes - 1) / c.KeyPrefixes
+}
+
+// Key distributions accepted by key_distribution.
+const (
+	distUniform = "uniform" // every key is equally likely
+	distZipfian = "zipfian" // a few hot keys receive most of the accesses
+)
+
+// Random number streams. Every random workload draws from its own generator
+// seeded from the scenario's seed, so that concurrent workloads don't perturb
+// each other's sequence of keys and values. Reader i uses streamReader+i.
+const (
+	streamMix = iota + 1
+	streamOverwrite
+	streamSeed
+	streamDelete
+	streamUpdate
+	streamChurn
+	streamInsert
+	streamReader
+)
+
+// newRand returns the generator of the given stream.
+func newRand(cfg *Config, stream int64) *rand.Rand {
+	return rand.New(rand.NewSource(cfg.Seed + stream))
+}
+
+// keyChooser picks the index of the next key accessed by a random workload
+// using random numbers from r. Implementations must be safe for concurrent
+// use with different generators.
+type keyChooser interface {
+	next(r *rand.Rand) int
+}
+
+// newKeyChooser returns the key chooser described by the scenario.
+func newKeyChooser(cfg *Config) keyChooser {
+	switch cfg.KeyDistribution {
+	case distZipfian:
+		return newZipfian(cfg.ItemCount, cfg.ZipfSkew)
+	default:
+		return uniform(cfg.ItemCount)
+	}
+}
+
+// uniform chooses any of its n keys with equal probability.
+type uniform int
+
+func (n uniform) next(r *rand.Rand) int { return r.Intn(int(n)) }
+
+// zipfian chooses keys with a Zipfian distribution over their index, so that
+// key 0 is the most popular, key 1 the next most popular, and so on. It uses
+// the method from Gray et al., "Quickly Generating Billion-Record Synthetic
+// Databases", which is also what YCSB uses, and supports skews in (0, 1).
+type zipfian struct {
+	n     float64
+	theta float64
+	alpha float64
+	zetan float64
+	eta   float64
+}
+
+// newZipfian returns a Zipfian chooser over n keys with the given skew.
+// Computing the distribution's constants takes time proportional to n.
+func newZipfian(n int, theta float64) *zipfian {
+	zetan := zeta(n, theta)
+	return &zipfian{
+		n:     float64(n),
+		theta: theta,
+		alpha: 1 / (1 - theta),
+		zetan: zetan,
+		eta:   (1 - math.Pow(2/float64(n), 1-theta)) / (1 - zeta(2, theta)/zetan),
+	}
+}
+
+func (z *zipfian) next(r *rand.Rand) int {
+	u := r.Float64()
+	uz := u * z.zetan
+	switch {
+	case uz < 1:
+		return 0
+	case uz < 1+math.Pow(0.5, z.theta):
+		return 1
+	}
+	i := int(z.n * math.Pow(z.eta*u-z.eta+1, z.alpha))
+	if i >= int(z.n) {
+		i = int(z.n) - 1
+	}
+	return i
+}
+
+// zeta returns the sum of 1/i^theta for i from 1 to n.
+func zeta(n int, theta float64) float64 {
+	var sum float64
+	for i := 1; i <= n; i++ {
+		sum += 1 / math.Pow(float64(i), theta)
+	}
+	return sum
+}
@@ -0,0 +1,52 @@
+package copybench
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// latencySummary holds percentiles of recorded latencies.
+type latencySummary struct {
+	P50  time.Duration `json:"p50"`
+	P90  time.Duration `json:"p90"`
+	P99  time.Duration `json:"p99"`
+	P999 time.Duration `json:"p999"`
+	Max  time.Duration `json:"max"`
+}
+
+// String returns the percentiles in a form suitable for printing.
+func (s *latencySummary) String() string {
+	return fmt.Sprintf("p50: %v, p90: %v, p99: %v, p99.9: %v, max: %v", s.P50, s.P90, s.P99, s.P999, s.Max)
+}
+
+// newLatencyHistogram returns a histogram for latencies from 1ns to 1 hour
+// with 3 significant digits.
+func newLatencyHistogram() *hdrhistogram.Histogram {
+	return hdrhistogram.New(1, int64(time.Hour), 3)
+}
+
+// recordLatency adds d to h, clamping values outside the histogram's range.
+func recordLatency(h *hdrhistogram.Histogram, d time.Duration) {
+	if d < 1 {
+		d = 1
+	} else if max := time.Duration(h.HighestTrackableValue()); d > max {
+		d = max
+	}
+	h.RecordValue(int64(d))
+}
+
+// summarizeHistogram returns the percentiles of h, or nil if it is empty.
+func summarizeHistogram(h *hdrhistogram.Histogram) *latencySummary {
+	if h == nil || h.TotalCount() == 0 {
+		return nil
+	}
+	return &latencySummary{
+		P50:  time.Duration(h.ValueAtQuantile(50)),
+		P90:  time.Duration(h.ValueAtQuantile(90)),
+		P99:  time.Duration(h.ValueAtQuantile(99)),
+		P999: time.Duration(h.ValueAtQuantile(99.9)),
+		Max:  time.Duration(h.Max()),
+	}
+}
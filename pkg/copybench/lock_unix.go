@@ -0,0 +1,47 @@
+//go:build unix
+
+package copybench
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// lockPollInterval is how often waitLock retries the file lock, as bolt does.
+const lockPollInterval = 50 * time.Millisecond
+
+// waitLock waits for the flock bolt takes on the database at path to be
+// available, shared for a read-only handle and exclusive otherwise, and
+// returns how long it waited. The lock is released again before returning so
+// that bolt can take it, which it then does without waiting unless another
+// process takes it first. A zero timeout waits indefinitely.
+func waitLock(path string, readOnly bool, timeout time.Duration) (time.Duration, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	how := syscall.LOCK_EX
+	if readOnly {
+		how = syscall.LOCK_SH
+	}
+	t := time.Now()
+	for {
+		err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+		if err == nil {
+			break
+		} else if err != syscall.EWOULDBLOCK {
+			return 0, fmt.Errorf("lock %s: %s", path, err)
+		} else if timeout > 0 && time.Since(t) > timeout {
+			return 0, fmt.Errorf("timed out after %v waiting for the lock on %s (open_timeout)", timeout, path)
+		}
+		time.Sleep(lockPollInterval)
+	}
+	wait := time.Since(t)
+	return wait, syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,63 @@
+package copybench
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// memStats is the change in the Go heap over a phase. HeapAlloc is the heap
+// in use at the end of the phase, and HeapAllocDelta its change.
+type memStats struct {
+	TotalAlloc     uint64 `json:"total_alloc"`
+	Mallocs        uint64 `json:"mallocs"`
+	HeapAlloc      uint64 `json:"heap_alloc"`
+	HeapAllocDelta int64  `json:"heap_alloc_delta"`
+
+	// GCs is the number of garbage collections that completed during the
+	// phase, GCPause their total stop-the-world pause time and MaxGCPause
+	// the longest pause.
+	GCs        uint32        `json:"gcs"`
+	GCPause    time.Duration `json:"gc_pause"`
+	MaxGCPause time.Duration `json:"max_gc_pause"`
+}
+
+// readMemStats returns the current memory statistics.
+func readMemStats() *runtime.MemStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return &ms
+}
+
+// memSince returns the change in memory statistics from prev to now.
+func memSince(prev *runtime.MemStats) *memStats {
+	ms := readMemStats()
+	m := &memStats{
+		TotalAlloc:     ms.TotalAlloc - prev.TotalAlloc,
+		Mallocs:        ms.Mallocs - prev.Mallocs,
+		HeapAlloc:      ms.HeapAlloc,
+		HeapAllocDelta: int64(ms.HeapAlloc) - int64(prev.HeapAlloc),
+		GCs:            ms.NumGC - prev.NumGC,
+		GCPause:        time.Duration(ms.PauseTotalNs - prev.PauseTotalNs),
+	}
+
+	// PauseNs holds the pauses of the last 256 collections, the most recent
+	// at (NumGC+255)%256.
+	n := m.GCs
+	if n > uint32(len(ms.PauseNs)) {
+		n = uint32(len(ms.PauseNs))
+	}
+	for i := uint32(0); i < n; i++ {
+		d := time.Duration(ms.PauseNs[(ms.NumGC-i+255)%256])
+		if d > m.MaxGCPause {
+			m.MaxGCPause = d
+		}
+	}
+	return m
+}
+
+// String summarizes the allocations and collections on a single line.
+func (m *memStats) String() string {
+	return fmt.Sprintf("allocated: %d bytes in %d objects, heap: %d bytes (%+d), gc: %d (pause: %v, max: %v)",
+		m.TotalAlloc, m.Mallocs, m.HeapAlloc, m.HeapAllocDelta, m.GCs, m.GCPause, m.MaxGCPause)
+}
@@ -0,0 +1,99 @@
+package copybench
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Live metrics published on the -metrics-addr endpoint.
+var (
+	iterationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "copybench_iterations_total",
+		Help: "Number of completed iteration passes.",
+	}, []string{"phase"})
+
+	iterateKeysTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "copybench_iterate_keys_total",
+		Help: "Number of keys read by iteration passes.",
+	}, []string{"phase"})
+
+	iterateDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "copybench_iterate_duration_seconds",
+		Help:    "Duration of a single iteration pass.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 2, 18),
+	}, []string{"phase"})
+
+	copyBytesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "copybench_copy_bytes_total",
+		Help: "Number of bytes written by database copies.",
+	})
+
+	currentPhase = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "copybench_phase",
+		Help: "Set to 1 for the phase that is currently running.",
+	}, []string{"phase"})
+)
+
+// copyProgress is the number of bytes written so far by the copy in progress.
+var copyProgress int64
+
+func init() {
+	prometheus.MustRegister(iterationsTotal, iterateKeysTotal, iterateDuration, copyBytesTotal, currentPhase)
+}
+
+// serveMetrics listens on addr and serves /metrics in the background. It is a
+// no-op if addr is empty.
+func serveMetrics(addr string) error {
+	if addr == "" {
+		return nil
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("metrics: %s", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	log.Printf("metrics: listening on %s", lis.Addr())
+	go func() {
+		if err := http.Serve(lis, mux); err != nil {
+			log.Printf("metrics: %s", err)
+		}
+	}()
+	return nil
+}
+
+// setPhase marks phase as the one currently running.
+func setPhase(phase string) {
+	setControlPhase(phase)
+	currentPhase.Reset()
+	if phase != "" {
+		currentPhase.WithLabelValues(phase).Set(1)
+	}
+}
+
+// meteredWriter counts the bytes written through it.
+type meteredWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Write writes p to the underlying writer and counts the bytes written.
+func (m *meteredWriter) Write(p []byte) (int, error) {
+	waitIfPaused()
+	if isInterrupted() {
+		return 0, errInterrupted
+	}
+	n, err := m.w.Write(p)
+	m.n += int64(n)
+	copyBytesTotal.Add(float64(n))
+	atomic.AddInt64(&copyProgress, int64(n))
+	atomic.AddInt64(&bytesCopied, int64(n))
+	return n, err
+}
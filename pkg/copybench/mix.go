@@ -0,0 +1,115 @@
+package copybench
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// mixStats summarizes the mixed read/write load run alongside a phase.
+type mixStats struct {
+	Reads        int             `json:"reads"`
+	Writes       int             `json:"writes"`
+	ReadLatency  *latencySummary `json:"read_latency,omitempty"`
+	WriteLatency *latencySummary `json:"write_latency,omitempty"`
+}
+
+// mixWrites counts the writes of mixed workloads since the process started.
+var mixWrites int64
+
+// parseMix parses a READ:WRITE ratio such as "95:5" and returns the fraction
+// of operations that are reads.
+func parseMix(s string) (float64, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("mix must be READ:WRITE, e.g. 95:5")
+	}
+	r, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("mix: %s", err)
+	}
+	w, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("mix: %s", err)
+	}
+	if r < 0 || w < 0 || r+w == 0 {
+		return 0, fmt.Errorf("mix: ratio must be non-negative and not all zero")
+	}
+	return r / (r + w), nil
+}
+
+// startMix runs the scenario's mixed workload in a separate goroutine. Each
+// operation is either a Get in its own read transaction or an overwrite in its
+// own write transaction, of a key picked by the bench's key chooser. The
+// returned function stops the workload and returns its stats.
+func (b *bench) startMix() func() *mixStats {
+	readFrac, _ := parseMix(b.cfg.Mix)
+	c := make(chan bool)
+	done := make(chan *mixStats)
+	go func() { done <- b.mix(readFrac, c) }()
+	return func() *mixStats {
+		c <- true
+		return <-done
+	}
+}
+
+// mix performs mixed operations until c is signaled.
+func (b *bench) mix(readFrac float64, c chan bool) *mixStats {
+	var stats mixStats
+	readHist, writeHist := newLatencyHistogram(), newLatencyHistogram()
+	k := make([]byte, b.cfg.KeySize)
+	r := newRand(b.cfg, streamMix)
+	for {
+		select {
+		case <-c:
+			stats.ReadLatency = summarizeHistogram(readHist)
+			stats.WriteLatency = summarizeHistogram(writeHist)
+			return &stats
+		default:
+		}
+		waitIfPaused()
+
+		n := b.keys.next(r)
+		b.cfg.encodeKey(k, n)
+		t := time.Now()
+		if r.Float64() < readFrac {
+			b.db.View(func(tx *bolt.Tx) error {
+				b.cfg.bucket(tx, n).Get(k)
+				return nil
+			})
+			recordLatency(readHist, time.Since(t))
+			stats.Reads++
+			continue
+		}
+
+		v := make([]byte, b.cfg.valueSize(r))
+		b.cfg.rewriteValue(k, v, r)
+		err := b.db.Update(func(tx *bolt.Tx) error {
+			return b.cfg.bucket(tx, n).Put(k, v)
+		})
+		if err != nil {
+			log.Printf("  mix: put: %s", err)
+			continue
+		}
+		recordLatency(writeHist, time.Since(t))
+		atomic.AddInt64(&mixWrites, 1)
+		stats.Writes++
+	}
+}
+
+// String summarizes the mixed workload on a single line.
+func (s *mixStats) String() string {
+	str := fmt.Sprintf("reads: %d, writes: %d", s.Reads, s.Writes)
+	if s.ReadLatency != nil {
+		str += fmt.Sprintf(", read p99: %v", s.ReadLatency.P99)
+	}
+	if s.WriteLatency != nil {
+		str += fmt.Sprintf(", write p99: %v", s.WriteLatency.P99)
+	}
+	return str
+}
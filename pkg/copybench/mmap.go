@@ -0,0 +1,61 @@
+package copybench
+
+import "os"
+
+// mmapFlags returns the flags the bolt engines memory map the database with.
+func (c *Config) mmapFlags() int {
+	if c.MmapPopulate {
+		return mapPopulate
+	}
+	return 0
+}
+
+// maxMmapStep is the largest step by which bolt grows its memory map.
+const maxMmapStep = 1 << 30
+
+// mmapSize returns the size of the memory map bolt uses for a database of
+// size bytes. The map doubles from 32KB up to 1GB and then grows 1GB at a time.
+func mmapSize(size int64) int64 {
+	for i := uint(15); i <= 30; i++ {
+		if size <= 1<<i {
+			return 1 << i
+		}
+	}
+	if r := size % maxMmapStep; r > 0 {
+		size += maxMmapStep - r
+	}
+	return size
+}
+
+// mmapTracker estimates how many times bolt grows its memory map while a
+// database grows, by applying bolt's growth policy to the size of the
+// database after each commit. Every growth remaps the file, which waits for
+// all open read transactions to finish.
+type mmapTracker struct {
+	mapped  int64
+	growths int
+}
+
+// newMmapTracker returns a tracker for the database file at path, opened with
+// the given initial mmap size.
+func newMmapTracker(path string, initial int) (*mmapTracker, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if int64(initial) > size {
+		size = int64(initial)
+	}
+	return &mmapTracker{mapped: mmapSize(size)}, nil
+}
+
+// observe records the size of the database after a commit. Bolt remaps as
+// soon as an allocation reaches the end of the map, so each step of the
+// policy up to size is counted.
+func (m *mmapTracker) observe(size int64) {
+	for size >= m.mapped {
+		m.mapped = mmapSize(m.mapped + 1)
+		m.growths++
+	}
+}
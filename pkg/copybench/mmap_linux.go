@@ -0,0 +1,6 @@
+package copybench
+
+import "syscall"
+
+// mapPopulate prefaults the pages of the memory map when it is created.
+const mapPopulate = syscall.MAP_POPULATE
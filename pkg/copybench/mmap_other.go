@@ -0,0 +1,7 @@
+//go:build !linux
+// +build !linux
+
+package copybench
+
+// mapPopulate is zero where MAP_POPULATE is not supported.
+const mapPopulate = 0
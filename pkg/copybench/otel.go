@@ -0,0 +1,178 @@
+package copybench
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// otelInterval is how often metrics are exported over OTLP.
+const otelInterval = 10 * time.Second
+
+// otelShutdownTimeout bounds flushing the last spans and metrics at the end of
+// a run.
+const otelShutdownTimeout = 10 * time.Second
+
+// otelExporter exports a run over OTLP: a span for the run with a child span
+// per phase, and the live metrics also served on -metrics-addr. All methods
+// are no-ops on a nil exporter.
+type otelExporter struct {
+	tracer trace.Tracer
+	traces *sdktrace.TracerProvider
+	meters *sdkmetric.MeterProvider
+
+	ctx  context.Context
+	root trace.Span
+
+	iterations metric.Int64Counter
+	keys       metric.Int64Counter
+	passes     metric.Float64Histogram
+}
+
+// startOtelExporter exports spans and metrics to the OTLP gRPC endpoint, such
+// as http://localhost:4317, for a run of command. Further settings such as
+// headers are read from the standard OTEL_EXPORTER_OTLP_* variables. It returns
+// nil if endpoint is empty.
+func startOtelExporter(endpoint, command, path string, cfg *Config) (*otelExporter, error) {
+	if endpoint == "" {
+		return nil, nil
+	}
+	ctx := context.Background()
+	host, _ := os.Hostname()
+	res := resource.NewSchemaless(
+		attribute.String("service.name", "copy-bench"),
+		attribute.String("host.name", host),
+	)
+	te, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("otlp: %s", err)
+	}
+	me, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithEndpointURL(endpoint))
+	if err != nil {
+		te.Shutdown(ctx)
+		return nil, fmt.Errorf("otlp: %s", err)
+	}
+
+	x := &otelExporter{
+		traces: sdktrace.NewTracerProvider(sdktrace.WithBatcher(te), sdktrace.WithResource(res)),
+		meters: sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(me, sdkmetric.WithInterval(otelInterval))), sdkmetric.WithResource(res)),
+	}
+	x.tracer = x.traces.Tracer("github.com/boltdb/copy-bench")
+	if err := x.instruments(); err != nil {
+		x.traces.Shutdown(ctx)
+		x.meters.Shutdown(ctx)
+		return nil, fmt.Errorf("otlp: %s", err)
+	}
+
+	x.ctx, x.root = x.tracer.Start(ctx, command, trace.WithAttributes(
+		attribute.String("copybench.path", path),
+		attribute.String("copybench.engine", cfg.Engine),
+		attribute.Int("copybench.item_count", cfg.ItemCount),
+		attribute.Int("copybench.value_size", cfg.ValueSize),
+		attribute.String("copybench.workload", cfg.Workload),
+	))
+	log.Printf("otlp: exporting to %s", endpoint)
+	return x, nil
+}
+
+// instruments creates the exporter's metric instruments.
+func (x *otelExporter) instruments() error {
+	meter := x.meters.Meter("github.com/boltdb/copy-bench")
+	var err error
+	if x.iterations, err = meter.Int64Counter("copybench.iterations", metric.WithDescription("Number of completed iteration passes.")); err != nil {
+		return err
+	}
+	if x.keys, err = meter.Int64Counter("copybench.iterate.keys", metric.WithDescription("Number of keys read by iteration passes.")); err != nil {
+		return err
+	}
+	if x.passes, err = meter.Float64Histogram("copybench.iterate.duration", metric.WithDescription("Duration of a single iteration pass."), metric.WithUnit("s")); err != nil {
+		return err
+	}
+	_, err = meter.Int64ObservableCounter("copybench.copy.bytes", metric.WithDescription("Number of bytes written by database copies."), metric.WithUnit("By"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(atomic.LoadInt64(&bytesCopied))
+			return nil
+		}))
+	return err
+}
+
+// Close ends the run's span and flushes the spans and metrics not yet
+// exported.
+func (x *otelExporter) Close() {
+	if x == nil {
+		return
+	}
+	x.root.End()
+	ctx, cancel := context.WithTimeout(context.Background(), otelShutdownTimeout)
+	defer cancel()
+	if err := x.traces.Shutdown(ctx); err != nil {
+		log.Printf("otlp: %s", err)
+	}
+	if err := x.meters.Shutdown(ctx); err != nil {
+		log.Printf("otlp: %s", err)
+	}
+}
+
+// startPhase starts the span of a phase, and returns a function that ends it
+// with its results, or the error it failed with.
+func (x *otelExporter) startPhase(phase string, rep int) func(pr *phaseResult, err error) {
+	if x == nil {
+		return func(*phaseResult, error) {}
+	}
+	_, span := x.tracer.Start(x.ctx, phase, trace.WithAttributes(
+		attribute.String("copybench.phase", phase),
+		attribute.Int("copybench.rep", rep),
+	))
+	return func(pr *phaseResult, err error) {
+		defer span.End()
+		if err != nil && err != errInterrupted {
+			span.SetStatus(codes.Error, err.Error())
+			return
+		}
+		if pr == nil {
+			return
+		}
+		span.SetAttributes(attribute.Bool("copybench.interrupted", pr.Interrupted))
+		if it := pr.Iterate; it != nil {
+			span.SetAttributes(
+				attribute.Int("copybench.iterate.n", it.N),
+				attribute.Int64("copybench.iterate.avg_ns", int64(it.Avg)),
+			)
+			if it.Latency != nil {
+				span.SetAttributes(attribute.Int64("copybench.iterate.p99_ns", int64(it.Latency.P99)))
+			}
+		}
+		for _, cs := range pr.Copies {
+			span.AddEvent("copy", trace.WithAttributes(
+				attribute.String("copybench.copy.target", cs.Target),
+				attribute.String("copybench.copy.method", cs.Method),
+				attribute.Int64("copybench.copy.duration_ns", int64(cs.Duration)),
+				attribute.Int64("copybench.copy.bytes", cs.Bytes),
+			))
+		}
+	}
+}
+
+// observe records a single iteration pass of phase that read keys.
+func (x *otelExporter) observe(phase string, d time.Duration, keys int) {
+	if x == nil {
+		return
+	}
+	attrs := metric.WithAttributes(attribute.String("phase", phase))
+	x.iterations.Add(x.ctx, 1, attrs)
+	x.keys.Add(x.ctx, int64(keys), attrs)
+	x.passes.Record(x.ctx, d.Seconds(), attrs)
+}
@@ -0,0 +1,13 @@
+package copybench
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// allocate reserves disk blocks for the first size bytes of f with fallocate,
+// extending the file if it is smaller.
+func allocate(f *os.File, size int64) error {
+	return unix.Fallocate(int(f.Fd()), 0, 0, size)
+}
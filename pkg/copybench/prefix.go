@@ -0,0 +1,48 @@
+package copybench
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/boltdb/bolt"
+)
+
+// prefixScan performs cfg.GetCount scans of every key sharing a random prefix.
+// The prefix is that of a key picked by keys using r. The time taken to seek
+// to the start of each scan is recorded in seekHist. It returns the number of
+// keys read.
+func prefixScan(tx *bolt.Tx, cfg *Config, keys keyChooser, r *rand.Rand, seekHist *hdrhistogram.Histogram) int {
+	var count int
+	prefix := make([]byte, 4)
+	for i := 0; i < cfg.GetCount; i++ {
+		binary.BigEndian.PutUint32(prefix, uint32(keys.next(r)/cfg.perPrefix()))
+		for j := 0; j < cfg.Buckets; j++ {
+			count += scanPrefix(tx.Bucket(cfg.bucketKey(j)), prefix, seekHist)
+		}
+	}
+	return count
+}
+
+// scanPrefix reads the keys of b starting with prefix, or those of its nested
+// buckets if it holds buckets rather than keys.
+func scanPrefix(b *bolt.Bucket, prefix []byte, seekHist *hdrhistogram.Histogram) int {
+	var count int
+	c := b.Cursor()
+	if k, v := c.First(); k != nil && v == nil {
+		for ; k != nil; k, _ = c.Next() {
+			count += scanPrefix(b.Bucket(k), prefix, seekHist)
+		}
+		return count
+	}
+
+	t := time.Now()
+	k, _ := c.Seek(prefix)
+	recordLatency(seekHist, time.Since(t))
+	for ; k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		count++
+	}
+	return count
+}
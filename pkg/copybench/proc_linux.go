@@ -0,0 +1,53 @@
+//go:build linux
+// +build linux
+
+package copybench
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+// residentSize returns the resident set size of the process in bytes, which
+// includes the pages of memory mapped databases that are in memory.
+func residentSize() (int64, error) {
+	b, err := ioutil.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, err
+	}
+	var size, resident int64
+	if _, err := fmt.Sscan(string(b), &size, &resident); err != nil {
+		return 0, fmt.Errorf("/proc/self/statm: %s", err)
+	}
+	return resident * int64(os.Getpagesize()), nil
+}
+
+// storageIO returns the bytes the process has read from and written to
+// storage, as opposed to the page cache.
+func storageIO() (read, written int64, err error) {
+	b, err := ioutil.ReadFile("/proc/self/io")
+	if err != nil {
+		return 0, 0, err
+	}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		f := bytes.Fields(s.Bytes())
+		if len(f) != 2 {
+			continue
+		}
+		switch string(f[0]) {
+		case "read_bytes:":
+			read, err = strconv.ParseInt(string(f[1]), 10, 64)
+		case "write_bytes:":
+			written, err = strconv.ParseInt(string(f[1]), 10, 64)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("/proc/self/io: %s", err)
+		}
+	}
+	return read, written, nil
+}
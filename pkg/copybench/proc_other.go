@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package copybench
+
+import "fmt"
+
+// residentSize is only supported on Linux.
+func residentSize() (int64, error) {
+	return 0, fmt.Errorf("only supported on Linux")
+}
+
+// storageIO is only supported on Linux.
+func storageIO() (read, written int64, err error) {
+	return 0, 0, fmt.Errorf("only supported on Linux")
+}
@@ -0,0 +1,184 @@
+package copybench
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strings"
+)
+
+// profiler writes CPU and heap profiles of a command, either of the whole
+// command or of each bench phase in turn, and block and mutex profiles and an
+// execution trace of its copies.
+type profiler struct {
+	cpu    string
+	mem    string
+	block  string
+	mutex  string
+	trace  string
+	phases bool
+	f      *os.File
+	label  string
+
+	// tf is the running execution trace and traced is set once a trace has
+	// been written without a label.
+	tf     *os.File
+	traced bool
+}
+
+// registerProfileFlags registers the profiling flags of a command. Commands
+// without phases ignore -profile-phases.
+func registerProfileFlags(fs *flag.FlagSet) *profiler {
+	p := &profiler{}
+	fs.StringVar(&p.cpu, "cpuprofile", "", "write a CPU profile to `FILE`")
+	fs.StringVar(&p.mem, "memprofile", "", "write a heap profile to `FILE`")
+	fs.StringVar(&p.block, "blockprofile", "", "write a profile of blocking during the copy to `FILE`")
+	fs.StringVar(&p.mutex, "mutexprofile", "", "write a profile of mutex contention during the copy to `FILE`")
+	fs.StringVar(&p.trace, "trace", "", "write an execution trace of the copy to `FILE`")
+	fs.BoolVar(&p.phases, "profile-phases", false, "write a profile of each phase, named after the phase")
+	return p
+}
+
+// start starts profiling. A nonempty label names the phase being profiled.
+func (p *profiler) start(label string) error {
+	p.label = label
+	if p.cpu == "" {
+		return nil
+	}
+	f, err := os.Create(p.path(p.cpu))
+	if err != nil {
+		return fmt.Errorf("cpu profile: %s", err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("cpu profile: %s", err)
+	}
+	p.f = f
+	return nil
+}
+
+// stop stops the CPU profile and writes the heap profile, which includes every
+// allocation made so far and not only those made since start.
+func (p *profiler) stop() error {
+	if p.f != nil {
+		pprof.StopCPUProfile()
+		err := p.f.Close()
+		p.f = nil
+		if err != nil {
+			return fmt.Errorf("cpu profile: %s", err)
+		}
+	}
+	if p.mem == "" {
+		return nil
+	}
+	f, err := os.Create(p.path(p.mem))
+	if err != nil {
+		return fmt.Errorf("heap profile: %s", err)
+	}
+	// Collect garbage so the profile reflects the live heap.
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("heap profile: %s", err)
+	}
+	return f.Close()
+}
+
+// startCopy starts recording every blocking event and contended mutex, if
+// their profiles are written, and starts the execution trace. Without a label
+// only the first copy is traced, since every trace is written to the same
+// file.
+func (p *profiler) startCopy(label string) error {
+	if p.block != "" {
+		runtime.SetBlockProfileRate(1)
+	}
+	if p.mutex != "" {
+		runtime.SetMutexProfileFraction(1)
+	}
+	if p.trace == "" || (label == "" && p.traced) {
+		return nil
+	}
+	path := p.trace
+	if label != "" {
+		path = phaseProfilePath(path, label)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("trace: %s", err)
+	}
+	if err := trace.Start(f); err != nil {
+		f.Close()
+		return fmt.Errorf("trace: %s", err)
+	}
+	p.tf = f
+	p.traced = p.traced || label == ""
+	return nil
+}
+
+// stopCopy stops the execution trace and recording blocking events and
+// contended mutexes, and writes their profiles, labeled by label if it is
+// nonempty. The profiles include every event recorded so far, so a profile
+// written without a label covers every copy.
+func (p *profiler) stopCopy(label string) error {
+	if p.tf != nil {
+		trace.Stop()
+		err := p.tf.Close()
+		p.tf = nil
+		if err != nil {
+			return fmt.Errorf("trace: %s", err)
+		}
+	}
+	if p.block != "" {
+		runtime.SetBlockProfileRate(0)
+	}
+	if p.mutex != "" {
+		runtime.SetMutexProfileFraction(0)
+	}
+	for _, prof := range []struct{ name, path string }{{"block", p.block}, {"mutex", p.mutex}} {
+		if prof.path == "" {
+			continue
+		}
+		path := prof.path
+		if label != "" {
+			path = phaseProfilePath(path, label)
+		}
+		if err := writeProfile(prof.name, path); err != nil {
+			return fmt.Errorf("%s profile: %s", prof.name, err)
+		}
+	}
+	return nil
+}
+
+// writeProfile writes the named runtime profile to path.
+func writeProfile(name, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pprof.Lookup(name).WriteTo(f, 0); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// path returns the path of the profile written to path for the current label.
+func (p *profiler) path(path string) string {
+	if p.label == "" {
+		return path
+	}
+	return phaseProfilePath(path, p.label)
+}
+
+// phaseProfilePath returns the path of the profile of the phase labeled label,
+// inserting the label before the extension of path: cpu.pprof becomes
+// cpu.copy.pprof, and cpu.copy-2.pprof for its second repetition.
+func phaseProfilePath(path, label string) string {
+	label = strings.NewReplacer(" #", "-", " ", "-").Replace(label)
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + label + ext
+}
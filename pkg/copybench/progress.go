@@ -0,0 +1,61 @@
+package copybench
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// progressInterval is the minimum interval between redraws of the progress
+// line on a terminal.
+const progressInterval = 100 * time.Millisecond
+
+// seedProgress reports the progress of seeding: a single line redrawn in place
+// when stderr is a terminal, or a log line per batch otherwise.
+type seedProgress struct {
+	total   int
+	resumed int
+	start   time.Time
+	tty     bool
+	drawn   time.Time
+}
+
+// newSeedProgress starts reporting progress towards total rows, of which
+// resumed were seeded by an earlier run.
+func newSeedProgress(total, resumed int) *seedProgress {
+	return &seedProgress{total: total, resumed: resumed, start: time.Now(), tty: isTerminal(os.Stderr)}
+}
+
+// update reports that count rows, taking size bytes, have been written.
+func (p *seedProgress) update(count int, size int64) {
+	now := time.Now()
+	if p.tty && count < p.total && now.Sub(p.drawn) < progressInterval {
+		return
+	}
+	p.drawn = now
+
+	elapsed := now.Sub(p.start)
+	var rate float64
+	var eta time.Duration
+	if elapsed > 0 {
+		rate = float64(count-p.resumed) / elapsed.Seconds()
+	}
+	if rate > 0 {
+		eta = time.Duration(float64(p.total-count) / rate * float64(time.Second)).Round(time.Second)
+	}
+	line := fmt.Sprintf("%d/%d rows (%.1f%%), %d bytes, %.0f rows/s, ETA %v",
+		count, p.total, 100*float64(count)/float64(p.total), size, rate, eta)
+	if p.tty {
+		fmt.Fprintf(os.Stderr, "\r\033[K  %s", line)
+	} else {
+		log.Printf("  %s", line)
+	}
+}
+
+// done ends the progress line.
+func (p *seedProgress) done() {
+	if p.tty {
+		fmt.Fprintln(os.Stderr)
+	}
+}
@@ -0,0 +1,55 @@
+package copybench
+
+import (
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimitBurst is the largest write let through the limiter at once.
+const rateLimitBurst = 256 * 1024
+
+// limitedWriter throttles writes to a fixed number of bytes per second using
+// a token bucket.
+type limitedWriter struct {
+	w       io.Writer
+	limiter *rate.Limiter
+}
+
+// newLimitedWriter returns a writer that passes at most mbps megabytes per
+// second through to w.
+func newLimitedWriter(w io.Writer, mbps float64) *limitedWriter {
+	burst := rateLimitBurst
+	if max := int(mbps * 1e6); max < burst {
+		burst = max
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &limitedWriter{w: w, limiter: rate.NewLimiter(rate.Limit(mbps*1e6), burst)}
+}
+
+// Write blocks until the limiter allows p to be written, in chunks no larger
+// than the limiter's burst. A signal aborts the wait with errInterrupted.
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > l.limiter.Burst() {
+			chunk = chunk[:l.limiter.Burst()]
+		}
+		if err := l.limiter.WaitN(interruptCtx, len(chunk)); err != nil {
+			if isInterrupted() {
+				return written, errInterrupted
+			}
+			return written, err
+		}
+		n, err := l.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,179 @@
+package copybench
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+)
+
+// readerMessage is written as JSON by a reader process to its parent: once
+// its readers have started, and with their stats, passes and the values that
+// failed their checksum once they have stopped. The parent writes one with
+// Interrupt set to stop the readers early.
+type readerMessage struct {
+	Ready     bool          `json:"ready,omitempty"`
+	Stats     *iterateStats `json:"stats,omitempty"`
+	Samples   []sample      `json:"samples,omitempty"`
+	Corrupt   int64         `json:"corrupt,omitempty"`
+	Interrupt bool          `json:"interrupt,omitempty"`
+}
+
+// startReaderProcess is startIterateN for reader_process: the phase's readers
+// run in a child process with its own read-only handle on the database,
+// started by re-executing the running binary with the reader command. The
+// child reads the scenario as JSON from its stdin and stops once it's closed.
+// It ignores signals, so that a signal to the process group leaves it to
+// report its passes; a signal to the bench is passed on as an Interrupt
+// message instead.
+func (b *bench) startReaderProcess(phase string, passes int) (func() (*iterateStats, error), error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("reader process: %s", err)
+	}
+	args := []string{"reader", "-phase", phase, "-passes", strconv.Itoa(passes)}
+	if b.keyLatency {
+		args = append(args, "-key-latency")
+	}
+	cmd := exec.Command(exe, append(args, b.path)...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("reader process: %s", err)
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("reader process: %s", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("reader process: %s", err)
+	}
+	enc := json.NewEncoder(stdin)
+	if err := enc.Encode(b.cfg); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, fmt.Errorf("reader process: %s", err)
+	}
+
+	// Wait for the readers to start, so that the phase doesn't begin with
+	// the child still opening the database.
+	dec := json.NewDecoder(out)
+	var msg readerMessage
+	if err := dec.Decode(&msg); err != nil || !msg.Ready {
+		stdin.Close()
+		return nil, fmt.Errorf("reader process: didn't start: %v", cmd.Wait())
+	}
+
+	return func() (*iterateStats, error) {
+		// Readers making a number of passes only stop early if the bench
+		// is interrupted, before or while waiting for them.
+		done := make(chan struct{})
+		defer close(done)
+		if passes == 0 {
+			stdin.Close()
+		} else {
+			go func() {
+				select {
+				case <-interrupted:
+					enc.Encode(&readerMessage{Interrupt: true})
+				case <-done:
+				}
+			}()
+		}
+
+		var msg readerMessage
+		if err := dec.Decode(&msg); err != nil || msg.Stats == nil {
+			stdin.Close()
+			return nil, fmt.Errorf("reader process: no stats: %v", cmd.Wait())
+		}
+		stdin.Close()
+		if err := cmd.Wait(); err != nil {
+			return nil, fmt.Errorf("reader process: %s", err)
+		}
+		atomic.AddInt64(&corruptValues, msg.Corrupt)
+		msg.Stats.Samples = msg.Samples
+		for _, s := range msg.Samples {
+			if err := b.samples.record(s.Time, phase, s.Duration, s.Keys); err != nil {
+				log.Printf("  csv: %s", err)
+			}
+		}
+		msg.Stats.print()
+		return msg.Stats, nil
+	}, nil
+}
+
+// readerMain runs the readers of a bench phase in a reader process, until
+// its stdin is closed or the parent interrupts it, or for the given number
+// of passes.
+func readerMain(args []string) error {
+	fs := flag.NewFlagSet("reader", flag.ExitOnError)
+	phase := fs.String("phase", phaseIterate, "run the readers of phase `NAME`")
+	passes := fs.Int("passes", 0, "make `N` passes per reader (0 runs until stdin is closed)")
+	keyLatency := fs.Bool("key-latency", false, "record the latency of every key read by a scan")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() != 1 {
+		return errUsage
+	}
+	path := fs.Arg(0)
+
+	// The parent stops the readers, so that they report what they measured
+	// when the whole process group is signalled.
+	signal.Ignore(os.Interrupt, syscall.SIGTERM)
+
+	cfg := defaultConfig()
+	dec := json.NewDecoder(os.Stdin)
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("reader: scenario: %s", err)
+	}
+	cfg.ReaderProcess = false
+	if err := cfg.prepare(); err != nil {
+		return err
+	}
+	eng, err := openEngine(path, false, cfg)
+	if err != nil {
+		return err
+	}
+	defer eng.Close()
+
+	// The parent prints the readers' stats.
+	enc := json.NewEncoder(os.Stdout)
+	stdout = ioutil.Discard
+
+	b := newBench(eng, cfg)
+	b.path, b.keyLatency = path, *keyLatency
+	stop, err := b.startIterateN(*phase, *passes)
+	if err != nil {
+		return err
+	}
+	if err := enc.Encode(&readerMessage{Ready: true}); err != nil {
+		return err
+	}
+
+	// Closing stdin, or the parent going away, stops the readers; so does
+	// an Interrupt message, which also cuts a number of passes short.
+	go func() {
+		for {
+			var msg readerMessage
+			if err := dec.Decode(&msg); err != nil || msg.Interrupt {
+				interrupt()
+				return
+			}
+		}
+	}()
+	if *passes == 0 {
+		<-interrupted
+	}
+	stats, err := stop()
+	if err != nil {
+		return err
+	}
+	return enc.Encode(&readerMessage{Stats: stats, Samples: stats.Samples, Corrupt: atomic.LoadInt64(&corruptValues)})
+}
@@ -0,0 +1,77 @@
+package copybench
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// reportMain prints stats about an existing database, or with -runs lists the
+// runs stored in a results database.
+func reportMain(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	cfg := defaultConfig()
+	runs := fs.Bool("runs", false, "list the runs stored in the results database PATH")
+	q := &runQuery{}
+	fs.StringVar(&q.Command, "command", "", "with -runs, list only runs of the command `NAME`")
+	fs.StringVar(&q.Host, "host", "", "with -runs, list only runs on the host `NAME`")
+	fs.StringVar(&q.Module, "module", "", "with -runs, list only runs built with a module matching `PATH@VERSION`, or part of it")
+	fs.IntVar(&q.Limit, "limit", 20, "with -runs, list at most `N` runs")
+	path, err := parseArgs(fs, args, cfg)
+	if err != nil {
+		return err
+	}
+	if *runs {
+		// -engine selects the runs stored under an engine's name, if given,
+		// whether or not this build has the engine.
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name == "engine" {
+				q.Engine = cfg.Engine
+			}
+		})
+		return reportRuns(path, q)
+	}
+	if err := cfg.prepare(); err != nil {
+		return err
+	}
+
+	t := time.Now()
+	eng, err := openEngine(path, false, cfg)
+	if err != nil {
+		return err
+	}
+	defer eng.Close()
+	fmt.Fprintf(stdout, "open: %v\n", time.Since(t))
+	if lw, ok := eng.(lockWaiter); ok {
+		fmt.Fprintf(stdout, "lock wait: %v\n", lw.LockWait())
+	}
+	if f, ok := eng.(freelister); ok {
+		fmt.Fprintf(stdout, "freelist: %s\n", f.Freelist())
+	}
+
+	_, err = stat(eng)
+	return err
+}
+
+// stat prints out stats about the store and returns its size.
+func stat(eng engine) (int64, error) {
+	sz, err := eng.Size()
+	if err != nil {
+		return 0, err
+	}
+	fmt.Fprintf(stdout, "size: %d bytes\n", sz)
+	fmt.Fprintln(stdout, "")
+	return sz, nil
+}
+
+// size returns the size of the database in bytes.
+func size(db *bolt.DB) (int64, error) {
+	var sz int64
+	err := db.View(func(tx *bolt.Tx) error {
+		sz = tx.Size()
+		return nil
+	})
+	return sz, err
+}
@@ -0,0 +1,97 @@
+package copybench
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// restoreStats describes the restore of a single copy: opening it as a
+// database and reading every key, after which the copy is usable.
+type restoreStats struct {
+	Target string        `json:"target"`
+	Open   time.Duration `json:"open"`
+	Scan   time.Duration `json:"scan"`
+	Keys   int           `json:"keys"`
+
+	// Duration is the time to a usable restore, from opening the copy to the
+	// end of the scan.
+	Duration time.Duration `json:"duration"`
+
+	// Evicted names the method used to evict the copy from the page cache
+	// before the restore, if it was.
+	Evicted string `json:"evicted,omitempty"`
+}
+
+// String summarizes the restore on a single line.
+func (s *restoreStats) String() string {
+	return fmt.Sprintf("%v to usable (%s: open %v, scan %v, %d keys)", s.Duration, s.Target, s.Open, s.Scan, s.Keys)
+}
+
+// restoreTargets returns the distinct files copied to by copies, in order.
+// Copies to ioutil.Discard or to object stores can't be restored.
+func restoreTargets(copies []*copyStats) []string {
+	var targets []string
+	seen := make(map[string]bool)
+	for _, cs := range copies {
+		if cs.Target == "discard" || strings.Contains(cs.Target, "://") || seen[cs.Target] {
+			continue
+		}
+		seen[cs.Target] = true
+		targets = append(targets, cs.Target)
+	}
+	return targets
+}
+
+// restore opens the copy at path as a fresh database and reads every key in
+// it, checking the values of the scenario cfg. With drop_caches the copy is
+// first evicted from the page cache, as a backup restored onto another
+// machine would be.
+func restore(path string, cfg *Config) (*restoreStats, error) {
+	s := &restoreStats{Target: path}
+	if cfg.DropCaches {
+		var err error
+		if s.Evicted, err = evictCache(path); err != nil {
+			return nil, fmt.Errorf("restore %s: evict: %s", path, err)
+		}
+	}
+
+	t := time.Now()
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("restore %s: %s", path, err)
+	}
+	defer db.Close()
+	s.Open = time.Since(t)
+
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(_ []byte, b *bolt.Bucket) error {
+			s.Keys += restoreBucket(cfg, b)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("restore %s: %s", path, err)
+	}
+	s.Duration = time.Since(t)
+	s.Scan = s.Duration - s.Open
+	return s, nil
+}
+
+// restoreBucket reads every key of b and its nested buckets and returns the
+// number of keys read.
+func restoreBucket(cfg *Config, b *bolt.Bucket) int {
+	var count int
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v == nil {
+			count += restoreBucket(cfg, b.Bucket(k))
+			continue
+		}
+		cfg.checkValue(k, v)
+		count++
+	}
+	return count
+}
@@ -0,0 +1,223 @@
+package copybench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// Result is the machine-readable outcome of a command, written with -o.
+// Durations are encoded in nanoseconds.
+type Result struct {
+	Command string         `json:"command"`
+	Time    time.Time      `json:"time"`
+	Config  *Config        `json:"config"`
+	Size    int64          `json:"size"`
+	Phases  []*phaseResult `json:"phases"`
+
+	// Summary aggregates metrics across repetitions when reps > 1.
+	Summary []*summary `json:"summary,omitempty"`
+
+	// Impact compares iteration during the copy with iteration without it,
+	// and CompactImpact iteration during compaction, in its Copy fields.
+	Impact        *copyImpact `json:"impact,omitempty"`
+	CompactImpact *copyImpact `json:"compact_impact,omitempty"`
+
+	// CompactCopy compares compaction and copies run at once with each run
+	// alone.
+	CompactCopy *compactCopyStats `json:"compact_copy,omitempty"`
+
+	// Open is the time taken to open the database, which includes reading it
+	// into memory with mmap_populate. ColdStart compares the warmup pass with
+	// the warm passes that follow it.
+	Open      time.Duration `json:"open,omitempty"`
+	ColdStart *coldStart    `json:"cold_start,omitempty"`
+
+	// LockWait is the part of Open spent waiting for the database's file
+	// lock, held by another process.
+	LockWait time.Duration `json:"lock_wait,omitempty"`
+
+	// Throughput holds the read and copy throughput of every second of the
+	// run.
+	Throughput []throughputBucket `json:"throughput,omitempty"`
+
+	// Interrupted is set if a signal stopped the command before it completed,
+	// in which case Phases holds the phases completed until then.
+	Interrupted bool `json:"interrupted,omitempty"`
+
+	// Workers holds what every worker of the coordinate command measured
+	// during each phase.
+	Workers []*workerPhase `json:"workers,omitempty"`
+
+	// Soak holds the rounds of the soak command.
+	Soak *soakStats `json:"soak,omitempty"`
+
+	// Buckets describes the shape of the dataset at the end of the command.
+	Buckets *datasetStats `json:"buckets,omitempty"`
+
+	// Env describes the machine and build the result was measured with.
+	Env *environment `json:"env,omitempty"`
+}
+
+// phaseResult holds the measurements taken during one phase.
+type phaseResult struct {
+	Name     string        `json:"name"`
+	Rep      int           `json:"rep"`
+	Duration time.Duration `json:"duration"`
+	Rows     int           `json:"rows,omitempty"`
+
+	// Interrupted is set if a signal cut the phase short.
+	Interrupted bool `json:"interrupted,omitempty"`
+
+	// Paused is how long the control API held the phase, which its
+	// duration leaves out.
+	Paused time.Duration `json:"paused,omitempty"`
+
+	Iterate  *iterateStats   `json:"iterate,omitempty"`
+	Copies   []*copyStats    `json:"copies,omitempty"`
+	Restores []*restoreStats `json:"restores,omitempty"`
+	Compact  *compactStats   `json:"compact,omitempty"`
+	Churn    *churnStats     `json:"churn,omitempty"`
+	Stats    *statsDelta     `json:"stats,omitempty"`
+	Freelist *freelistStats  `json:"freelist,omitempty"`
+	Usage    *usageStats     `json:"usage,omitempty"`
+	Mem      *memStats       `json:"mem,omitempty"`
+	IO       *ioStats        `json:"io,omitempty"`
+	Disk     *diskStats      `json:"disk,omitempty"`
+
+	// Seed describes how the seed phase wrote the dataset.
+	Seed *seedStats `json:"seed,omitempty"`
+
+	// MmapGrowths is the estimated number of times the memory map grew
+	// while seeding.
+	MmapGrowths int `json:"mmap_growths,omitempty"`
+
+	// Preallocate is how long extending the database file before seeding
+	// took.
+	Preallocate time.Duration `json:"preallocate,omitempty"`
+
+	Incremental *incrementalStats `json:"incremental,omitempty"`
+	Mix         *mixStats         `json:"mix,omitempty"`
+	Deletes     *writeStats       `json:"deletes,omitempty"`
+	Updates     *writeStats       `json:"updates,omitempty"`
+}
+
+// Label returns the phase name, qualified by its repetition if repeated.
+func (p *phaseResult) Label() string {
+	if p.Rep > 0 {
+		return fmt.Sprintf("%s #%d", p.Name, p.Rep+1)
+	}
+	return p.Name
+}
+
+// iterateStats summarizes the passes made by iterate, either by a single
+// reader or combined across all readers.
+type iterateStats struct {
+	Reader int           `json:"reader,omitempty"`
+	N      int           `json:"n"`
+	Keys   int           `json:"keys"`
+	Total  time.Duration `json:"total"`
+	Avg    time.Duration `json:"avg"`
+
+	// Latency holds percentiles of pass durations, KeyLatency percentiles of
+	// individual key reads of a scan, if recorded, and GetLatency percentiles
+	// of individual lookups of the get workload.
+	Latency    *latencySummary `json:"latency,omitempty"`
+	KeyLatency *latencySummary `json:"key_latency,omitempty"`
+	GetLatency *latencySummary `json:"get_latency,omitempty"`
+
+	// SeekLatency holds percentiles of the seeks to the start of each scan of
+	// the prefix and range workloads.
+	SeekLatency *latencySummary `json:"seek_latency,omitempty"`
+
+	// OpLatency holds percentiles of each operation type of a YCSB
+	// workload.
+	OpLatency map[string]*latencySummary `json:"op_latency,omitempty"`
+
+	// Readers holds the stats of each reader when several ran.
+	Readers []*iterateStats `json:"readers,omitempty"`
+
+	// Samples holds every individual pass, in order.
+	Samples []sample `json:"-"`
+}
+
+// sample is a single iteration pass.
+type sample struct {
+	Time     time.Time
+	Duration time.Duration
+	Keys     int
+}
+
+// copyStats describes a single copy of the database.
+type copyStats struct {
+	Target   string        `json:"target"`
+	Method   string        `json:"method"`
+	Duration time.Duration `json:"duration"`
+	Bytes    int64         `json:"bytes"`
+
+	// Paused is how long the control API held the copy, which its duration
+	// leaves out.
+	Paused time.Duration `json:"paused,omitempty"`
+
+	// Start is when the copy started since the start of its phase, if the
+	// phase copies repeatedly.
+	Start time.Duration `json:"start,omitempty"`
+
+	// Direct is set if the destination was written with O_DIRECT.
+	Direct bool `json:"direct,omitempty"`
+
+	// Verified holds the digest of the copy, if it was checked against its
+	// source.
+	Verified *copyVerification `json:"verified,omitempty"`
+
+	// Snapshot holds the generation of the snapshot writer's keys the copy
+	// was found to hold, if checked.
+	Snapshot *snapshotCheck `json:"snapshot,omitempty"`
+
+	// WriteToBytes is the byte count returned by Tx.WriteTo, if used.
+	WriteToBytes int64 `json:"write_to_bytes,omitempty"`
+
+	// Compression is the compressor used and CompressedBytes the size of
+	// its output, if the copy was compressed.
+	Compression     string `json:"compression,omitempty"`
+	CompressedBytes int64  `json:"compressed_bytes,omitempty"`
+
+	// Syncs is the number of times a durable copy fsynced its destination
+	// and SyncDuration the part of Duration spent doing so.
+	Syncs        int           `json:"syncs,omitempty"`
+	SyncDuration time.Duration `json:"sync_duration,omitempty"`
+
+	// Fadvises is the number of times the written pages of the destination
+	// were dropped from the page cache and FadviseDuration the part of
+	// Duration spent doing so.
+	Fadvises        int           `json:"fadvises,omitempty"`
+	FadviseDuration time.Duration `json:"fadvise_duration,omitempty"`
+}
+
+// newResult returns an empty result for a command run with cfg against the
+// database at path.
+func newResult(command, path string, cfg *Config) *Result {
+	return &Result{Command: command, Time: time.Now().UTC(), Config: cfg, Env: captureEnvironment(path)}
+}
+
+// save appends the result to the scenario's results_db, if set, and writes it
+// as JSON to path.
+func (r *Result) save(path string) error {
+	if err := r.store(); err != nil {
+		return err
+	}
+	return r.write(path)
+}
+
+// write encodes the result as JSON to path. It is a no-op if path is empty.
+func (r *Result) write(path string) error {
+	if path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
@@ -0,0 +1,247 @@
+package copybench
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// resultsDriver is the database/sql driver of results databases, registered
+// by the sqlite engine's driver when built with cgo.
+const resultsDriver = "sqlite3"
+
+// engineModule maps the engines to the module whose version report -runs
+// shows beside them. The lmdb and sqlite engines are only built with cgo, so
+// they are named here rather than by their constants.
+var engineModule = map[string]string{
+	engineBolt:   "github.com/boltdb/bolt",
+	engineBbolt:  "go.etcd.io/bbolt",
+	engineBadger: "github.com/dgraph-io/badger",
+	enginePebble: "github.com/cockroachdb/pebble",
+	engineLevel:  "github.com/syndtr/goleveldb",
+	"lmdb":       "github.com/bmatsuo/lmdb-go",
+	"sqlite":     "github.com/mattn/go-sqlite3",
+}
+
+// resultsSchema creates the tables of a results database: a row per run,
+// with its scenario and full results as JSON, and a row per phase with the
+// metrics that are compared across runs.
+const resultsSchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id INTEGER PRIMARY KEY,
+	time TEXT NOT NULL,
+	command TEXT NOT NULL,
+	engine TEXT NOT NULL,
+	version TEXT NOT NULL,
+	modules TEXT NOT NULL,
+	hostname TEXT NOT NULL,
+	os TEXT NOT NULL,
+	arch TEXT NOT NULL,
+	cpus INTEGER NOT NULL,
+	go_version TEXT NOT NULL,
+	item_count INTEGER NOT NULL,
+	size INTEGER NOT NULL,
+	interrupted INTEGER NOT NULL,
+	config TEXT NOT NULL,
+	result TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS phases (
+	run INTEGER NOT NULL REFERENCES runs(id),
+	name TEXT NOT NULL,
+	rep INTEGER NOT NULL,
+	duration_ns INTEGER NOT NULL,
+	iterate_n INTEGER,
+	iterate_avg_ns INTEGER,
+	iterate_p99_ns INTEGER,
+	copies INTEGER,
+	copy_avg_ns INTEGER,
+	copy_bytes INTEGER
+);
+CREATE INDEX IF NOT EXISTS phases_run ON phases (run);
+`
+
+// checkResultsDB returns an error if results databases can't be written by
+// this build.
+func checkResultsDB() error {
+	for _, d := range sql.Drivers() {
+		if d == resultsDriver {
+			return nil
+		}
+	}
+	return fmt.Errorf("results_db needs the sqlite driver, which needs cgo")
+}
+
+// openResultsDB opens the results database at path, creating it if needed.
+func openResultsDB(path string) (*sql.DB, error) {
+	if err := checkResultsDB(); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(resultsDriver, "file:"+path+"?_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(resultsSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("results db: %s", err)
+	}
+	return db, nil
+}
+
+// store appends the result to the scenario's results_db, if set.
+func (r *Result) store() error {
+	if r.Config == nil || r.Config.ResultsDB == "" {
+		return nil
+	}
+	db, err := openResultsDB(r.Config.ResultsDB)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := r.insert(db); err != nil {
+		return fmt.Errorf("results db: %s", err)
+	}
+	return nil
+}
+
+// insert adds the result and its phases to db in a single transaction.
+func (r *Result) insert(db *sql.DB) error {
+	cfg, err := json.Marshal(r.Config)
+	if err != nil {
+		return err
+	}
+	res, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	env := r.Env
+	if env == nil {
+		env = &environment{}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	row, err := tx.Exec(`INSERT INTO runs (time, command, engine, version, modules, hostname, os, arch, cpus, go_version, item_count, size, interrupted, config, result)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Time.Format(time.RFC3339), r.Command, r.Config.Engine, env.Modules[engineModule[r.Config.Engine]], env.modules(), env.Hostname, env.OS, env.Arch, env.CPUs, env.GoVersion,
+		r.Config.ItemCount, r.Size, r.Interrupted, string(cfg), string(res))
+	if err != nil {
+		return err
+	}
+	id, err := row.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for _, p := range r.Phases {
+		var n, avg, p99, copies, copyAvg, copyBytes sql.NullInt64
+		if it := p.Iterate; it != nil {
+			n = sql.NullInt64{Int64: int64(it.N), Valid: true}
+			avg = sql.NullInt64{Int64: int64(it.Avg), Valid: true}
+			if it.Latency != nil {
+				p99 = sql.NullInt64{Int64: int64(it.Latency.P99), Valid: true}
+			}
+		}
+		if len(p.Copies) > 0 {
+			var total time.Duration
+			var bytes int64
+			for _, cs := range p.Copies {
+				total += cs.Duration
+				bytes += cs.Bytes
+			}
+			copies = sql.NullInt64{Int64: int64(len(p.Copies)), Valid: true}
+			copyAvg = sql.NullInt64{Int64: int64(total) / int64(len(p.Copies)), Valid: true}
+			copyBytes = sql.NullInt64{Int64: bytes, Valid: true}
+		}
+		if _, err := tx.Exec(`INSERT INTO phases (run, name, rep, duration_ns, iterate_n, iterate_avg_ns, iterate_p99_ns, copies, copy_avg_ns, copy_bytes)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, p.Name, p.Rep, int64(p.Duration), n, avg, p99, copies, copyAvg, copyBytes); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// modules returns the storage engine module versions as a sorted list of
+// PATH@VERSION, separated by spaces.
+func (env *environment) modules() string {
+	var mods []string
+	for p, v := range env.Modules {
+		mods = append(mods, p+"@"+v)
+	}
+	sort.Strings(mods)
+	return strings.Join(mods, " ")
+}
+
+// runQuery selects the runs listed by report -runs. Empty fields match every
+// run.
+type runQuery struct {
+	Command string
+	Engine  string
+	Host    string
+	Module  string
+	Limit   int
+}
+
+// reportRuns lists the runs of the results database at path matching q, most
+// recent first, with the version of their engine and the iteration latency
+// and copy duration each measured, averaged across repetitions.
+func reportRuns(path string, q *runQuery) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := openResultsDB(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT r.id, r.time, r.command, r.engine, r.version, r.hostname, r.size,
+			(SELECT AVG(iterate_avg_ns) FROM phases WHERE run = r.id AND name = ?),
+			(SELECT AVG(iterate_avg_ns) FROM phases WHERE run = r.id AND name = ?),
+			(SELECT AVG(copy_avg_ns) FROM phases WHERE run = r.id AND name = ?)
+		FROM runs r
+		WHERE (? = '' OR r.command = ?) AND (? = '' OR r.engine = ?) AND (? = '' OR r.hostname = ?)
+			AND (? = '' OR r.modules LIKE '%' || ? || '%')
+		ORDER BY r.id DESC LIMIT ?`,
+		phaseIterate, phaseCopy, phaseCopy,
+		q.Command, q.Command, q.Engine, q.Engine, q.Host, q.Host, q.Module, q.Module, q.Limit)
+	if err != nil {
+		return fmt.Errorf("results db: %s", err)
+	}
+	defer rows.Close()
+
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "id\ttime\tcommand\tengine\thost\tsize\titerate\titerate during copy\tcopy")
+	for rows.Next() {
+		var id, sz int64
+		var t, command, engine, version, host string
+		var iterate, during, cp sql.NullFloat64
+		if err := rows.Scan(&id, &t, &command, &engine, &version, &host, &sz, &iterate, &during, &cp); err != nil {
+			return fmt.Errorf("results db: %s", err)
+		}
+		if version != "" {
+			engine += " " + version
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n", id, t, command, engine, host, sz, nullDuration(iterate), nullDuration(during), nullDuration(cp))
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("results db: %s", err)
+	}
+	return tw.Flush()
+}
+
+// nullDuration formats a duration in nanoseconds averaged by SQL, or "-" if
+// there was nothing to average.
+func nullDuration(v sql.NullFloat64) string {
+	if !v.Valid {
+		return "-"
+	}
+	return time.Duration(v.Float64).Round(time.Microsecond).String()
+}
@@ -0,0 +1,68 @@
+package copybench
+
+import (
+	"fmt"
+	"time"
+)
+
+// usageStats is the change in the process's resource usage over a phase.
+// Minor faults are served from the page cache, such as when a memory mapped
+// page is first touched; major faults had to read from disk.
+type usageStats struct {
+	MinorFaults int64         `json:"minor_faults"`
+	MajorFaults int64         `json:"major_faults"`
+	User        time.Duration `json:"user"`
+	System      time.Duration `json:"system"`
+}
+
+// String summarizes the usage on a single line.
+func (u *usageStats) String() string {
+	return fmt.Sprintf("minor faults: %d, major faults: %d, user: %v, system: %v",
+		u.MinorFaults, u.MajorFaults, u.User, u.System)
+}
+
+// ioStats is the storage I/O of the process over a phase: the bytes read from
+// and written to disk rather than the page cache, and the write rate over the
+// phase in MB/s.
+type ioStats struct {
+	ReadBytes  int64   `json:"read_bytes"`
+	WriteBytes int64   `json:"write_bytes"`
+	WriteRate  float64 `json:"write_rate"`
+}
+
+// ioCounter measures the storage I/O of the process from the time it was
+// created. It is nil where the counters are unavailable.
+type ioCounter struct {
+	read, written int64
+}
+
+// newIOCounter starts measuring storage I/O.
+func newIOCounter() *ioCounter {
+	read, written, err := storageIO()
+	if err != nil {
+		return nil
+	}
+	return &ioCounter{read: read, written: written}
+}
+
+// since returns the storage I/O since c was created, d ago, or nil if it
+// can't be measured.
+func (c *ioCounter) since(d time.Duration) *ioStats {
+	if c == nil {
+		return nil
+	}
+	read, written, err := storageIO()
+	if err != nil {
+		return nil
+	}
+	s := &ioStats{ReadBytes: read - c.read, WriteBytes: written - c.written}
+	if d > 0 {
+		s.WriteRate = float64(s.WriteBytes) / 1e6 / d.Seconds()
+	}
+	return s
+}
+
+// String summarizes the I/O on a single line.
+func (s *ioStats) String() string {
+	return fmt.Sprintf("read: %d bytes, written: %d bytes (%.2f MB/s)", s.ReadBytes, s.WriteBytes, s.WriteRate)
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package copybench
+
+// rusage is empty where getrusage isn't available.
+type rusage struct{}
+
+// getrusage is only supported on Unix.
+func getrusage() (*rusage, error) {
+	return &rusage{}, nil
+}
+
+// usageSince is only supported on Unix, and returns no usage.
+func usageSince(prev *rusage) (*usageStats, error) {
+	return nil, nil
+}
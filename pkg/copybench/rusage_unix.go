@@ -0,0 +1,35 @@
+//go:build unix
+
+package copybench
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// rusage is the process's resource usage at some point.
+type rusage = syscall.Rusage
+
+// getrusage returns the process's resource usage so far.
+func getrusage() (*rusage, error) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return nil, fmt.Errorf("getrusage: %s", err)
+	}
+	return &ru, nil
+}
+
+// usageSince returns the change in resource usage from prev to now.
+func usageSince(prev *rusage) (*usageStats, error) {
+	ru, err := getrusage()
+	if err != nil {
+		return nil, err
+	}
+	return &usageStats{
+		MinorFaults: int64(ru.Minflt - prev.Minflt),
+		MajorFaults: int64(ru.Majflt - prev.Majflt),
+		User:        time.Duration(ru.Utime.Nano() - prev.Utime.Nano()),
+		System:      time.Duration(ru.Stime.Nano() - prev.Stime.Nano()),
+	}, nil
+}
@@ -0,0 +1,63 @@
+package copybench
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// errAborted is the error a partial upload is aborted with.
+var errAborted = errors.New("copy aborted")
+
+// s3Writer streams a copy to S3 as a multipart upload. Writes block while the
+// uploader is busy, so upload backpressure is felt by the copy transaction.
+type s3Writer struct {
+	pw   *io.PipeWriter
+	done chan error
+}
+
+// openS3 starts a multipart upload to s3://BUCKET/KEY. Credentials and region
+// are taken from the standard AWS environment and config files.
+func openS3(ctx context.Context, u *url.URL) (io.WriteCloser, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	uploader := manager.NewUploader(s3.NewFromConfig(cfg))
+
+	pr, pw := io.Pipe()
+	w := &s3Writer{pw: pw, done: make(chan error, 1)}
+	go func() {
+		_, err := uploader.Upload(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(u.Host),
+			Key:    aws.String(strings.TrimPrefix(u.Path, "/")),
+			Body:   pr,
+		})
+		// Unblock the writer if the upload failed early.
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+	return w, nil
+}
+
+// Write passes p to the uploader.
+func (w *s3Writer) Write(p []byte) (int, error) { return w.pw.Write(p) }
+
+// Close completes the upload and waits for it to finish.
+func (w *s3Writer) Close() error {
+	w.pw.Close()
+	return <-w.done
+}
+
+// Abort cancels the upload, discarding any uploaded parts.
+func (w *s3Writer) Abort() {
+	w.pw.CloseWithError(errAborted)
+	<-w.done
+}
@@ -0,0 +1,167 @@
+package copybench
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sampleWriter writes one CSV row per iteration pass so that latency can be
+// plotted over the course of a run. A nil sampleWriter discards all samples.
+type sampleWriter struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *csv.Writer
+}
+
+// createSampleWriter creates the CSV file at path and writes its header.
+func createSampleWriter(path string) (*sampleWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &sampleWriter{f: f, w: csv.NewWriter(f)}
+	if err := s.w.Write([]string{"timestamp", "phase", "duration_ns", "keys"}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// record writes a single iteration pass that started at t.
+func (s *sampleWriter) record(t time.Time, phase string, d time.Duration, keys int) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write([]string{
+		t.UTC().Format(time.RFC3339Nano),
+		phase,
+		strconv.FormatInt(int64(d), 10),
+		strconv.Itoa(keys),
+	})
+}
+
+// Close flushes any buffered rows and closes the file. It is safe to call
+// more than once.
+func (s *sampleWriter) Close() error {
+	if s == nil || s.f == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w.Flush()
+	err := s.w.Error()
+	if e := s.f.Close(); err == nil {
+		err = e
+	}
+	s.f = nil
+	return err
+}
+
+// memoryInterval is the interval at which memorySampler samples memory usage.
+const memoryInterval = time.Second
+
+// memorySampler writes one CSV row of the process's memory usage every
+// memoryInterval, so that memory growth can be plotted alongside latency. A
+// nil memorySampler does nothing.
+type memorySampler struct {
+	mu    sync.Mutex
+	f     *os.File
+	w     *csv.Writer
+	phase string
+	err   error
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// startMemorySampler creates the CSV file at path, writes its header and
+// starts sampling.
+func startMemorySampler(path string) (*memorySampler, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &memorySampler{f: f, w: csv.NewWriter(f), done: make(chan struct{})}
+	if err := s.w.Write([]string{"timestamp", "phase", "rss_bytes", "heap_alloc_bytes", "heap_sys_bytes"}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+// setPhase labels the following samples with phase, taking one as the phase
+// starts.
+func (s *memorySampler) setPhase(phase string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.phase = phase
+	s.mu.Unlock()
+	s.sample(time.Now())
+}
+
+// run samples memory usage until Close is called.
+func (s *memorySampler) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(memoryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case t := <-ticker.C:
+			s.sample(t)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// sample writes a single row of memory usage taken at t. The RSS is left empty
+// where it can't be read.
+func (s *memorySampler) sample(t time.Time) {
+	var rss string
+	if n, err := residentSize(); err == nil {
+		rss = strconv.FormatInt(n, 10)
+	}
+	ms := readMemStats()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return
+	}
+	s.err = s.w.Write([]string{
+		t.UTC().Format(time.RFC3339Nano),
+		s.phase,
+		rss,
+		strconv.FormatUint(ms.HeapAlloc, 10),
+		strconv.FormatUint(ms.HeapSys, 10),
+	})
+}
+
+// Close takes a last sample, stops sampling, flushes any buffered rows and
+// closes the file. It is safe to call more than once.
+func (s *memorySampler) Close() error {
+	if s == nil || s.f == nil {
+		return nil
+	}
+	close(s.done)
+	s.wg.Wait()
+	s.sample(time.Now())
+	s.w.Flush()
+	err := s.err
+	if err == nil {
+		err = s.w.Error()
+	}
+	if e := s.f.Close(); err == nil {
+		err = e
+	}
+	s.f = nil
+	return err
+}
@@ -0,0 +1,227 @@
+package copybench
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/boltdb/bolt"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// workloadScript runs the Starlark script named by workload_script.
+const workloadScript = "script"
+
+// Operations performed by scripts.
+const (
+	scriptGet    = "get"
+	scriptPut    = "put"
+	scriptDelete = "delete"
+	scriptScan   = "scan"
+)
+
+func init() {
+	RegisterWorkload(workloadScript, func() Workload { return &scriptWorkload{} })
+}
+
+// scriptWorkload runs a Starlark script as a reader workload. The script
+// defines step(), which is called for every pass and performs operations on
+// the dataset's keys, by index, with the builtins below. Every operation runs
+// in its own transaction and its latency is recorded by type. A pass reads
+// the number of keys step returns or, if it returns None, the number of keys
+// its operations read and wrote.
+type scriptWorkload struct {
+	env    *WorkloadEnv
+	thread *starlark.Thread
+	step   starlark.Callable
+	count  int
+}
+
+// checkScript returns an error if the script at path doesn't parse.
+func checkScript(path string) error {
+	if _, err := (&syntax.FileOptions{}).Parse(path, nil, 0); err != nil {
+		return fmt.Errorf("workload_script: %s", err)
+	}
+	return nil
+}
+
+func (w *scriptWorkload) Setup(env *WorkloadEnv) error {
+	w.env = env
+	if env.hists.ops == nil {
+		env.hists.ops = map[string]*hdrhistogram.Histogram{
+			scriptGet:    newLatencyHistogram(),
+			scriptPut:    newLatencyHistogram(),
+			scriptDelete: newLatencyHistogram(),
+			scriptScan:   newLatencyHistogram(),
+		}
+	}
+	w.thread = &starlark.Thread{
+		Name:  fmt.Sprintf("reader %d", env.Reader),
+		Print: func(_ *starlark.Thread, msg string) { log.Printf("  script: %s", msg) },
+	}
+	path := env.Config.WorkloadScript
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, w.thread, path, nil, w.builtins())
+	if err != nil {
+		return err
+	}
+	step, ok := globals["step"].(starlark.Callable)
+	if !ok {
+		return fmt.Errorf("%s does not define step()", path)
+	}
+	w.step = step
+	return nil
+}
+
+func (w *scriptWorkload) Step() (int, error) {
+	w.count = 0
+	v, err := starlark.Call(w.thread, w.step, nil, nil)
+	if err != nil {
+		return w.count, err
+	}
+	if n, ok := v.(starlark.Int); ok {
+		if i, ok := n.Int64(); ok {
+			return int(i), nil
+		}
+	}
+	return w.count, nil
+}
+
+func (w *scriptWorkload) Teardown() error { return nil }
+
+// builtins returns the names predeclared for the script: the scenario's
+// item_count, the script's reader number, and these functions:
+//
+//	get(i)        look up key i, returning whether it exists
+//	put(i)        write a new value to key i, which may be past item_count
+//	delete(i)     delete key i
+//	scan(i, n)    read up to n keys from key i on, returning the number read
+//	random(n)     a random number in [0, n) from the reader's stream
+//	choose()      a key index picked with the scenario's key_dist
+func (w *scriptWorkload) builtins() starlark.StringDict {
+	return starlark.StringDict{
+		"item_count": starlark.MakeInt(w.env.Config.ItemCount),
+		"reader":     starlark.MakeInt(w.env.Reader),
+		"get":        starlark.NewBuiltin("get", w.get),
+		"put":        starlark.NewBuiltin("put", w.put),
+		"delete":     starlark.NewBuiltin("delete", w.delete),
+		"scan":       starlark.NewBuiltin("scan", w.scan),
+		"random":     starlark.NewBuiltin("random", w.random),
+		"choose":     starlark.NewBuiltin("choose", w.choose),
+	}
+}
+
+// key unpacks the index of the key passed to fn along with any further int
+// arguments into rest, and returns the key.
+func (w *scriptWorkload) key(fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple, n *int, rest ...interface{}) ([]byte, error) {
+	vars := append([]interface{}{n}, rest...)
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, len(vars), vars...); err != nil {
+		return nil, err
+	} else if *n < 0 {
+		return nil, fmt.Errorf("%s: negative key index %d", fn.Name(), *n)
+	}
+	k := make([]byte, w.env.Config.KeySize)
+	w.env.Config.encodeKey(k, *n)
+	return k, nil
+}
+
+// record records the latency of an operation of type op started at t.
+func (w *scriptWorkload) record(op string, t time.Time) {
+	recordLatency(w.env.hists.ops[op], time.Since(t))
+}
+
+func (w *scriptWorkload) get(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var n int
+	k, err := w.key(fn, args, kwargs, &n)
+	if err != nil {
+		return nil, err
+	}
+	cfg := w.env.Config
+	var found bool
+	t := time.Now()
+	err = w.env.DB.View(func(tx *bolt.Tx) error {
+		if v := cfg.bucket(tx, n).Get(k); v != nil {
+			cfg.checkValue(k, v)
+			found = true
+		}
+		return nil
+	})
+	w.record(scriptGet, t)
+	if found {
+		w.count++
+	}
+	return starlark.Bool(found), err
+}
+
+func (w *scriptWorkload) put(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var n int
+	k, err := w.key(fn, args, kwargs, &n)
+	if err != nil {
+		return nil, err
+	}
+	cfg := w.env.Config
+	v := make([]byte, cfg.valueSize(w.env.Rand))
+	cfg.rewriteValue(k, v, w.env.Rand)
+	t := time.Now()
+	err = w.env.DB.Update(func(tx *bolt.Tx) error {
+		return cfg.bucket(tx, n).Put(k, v)
+	})
+	w.record(scriptPut, t)
+	w.count++
+	return starlark.None, err
+}
+
+func (w *scriptWorkload) delete(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var n int
+	k, err := w.key(fn, args, kwargs, &n)
+	if err != nil {
+		return nil, err
+	}
+	t := time.Now()
+	err = w.env.DB.Update(func(tx *bolt.Tx) error {
+		return w.env.Config.bucket(tx, n).Delete(k)
+	})
+	w.record(scriptDelete, t)
+	w.count++
+	return starlark.None, err
+}
+
+func (w *scriptWorkload) scan(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var n, length int
+	k, err := w.key(fn, args, kwargs, &n, &length)
+	if err != nil {
+		return nil, err
+	}
+	cfg := w.env.Config
+	var count int
+	t := time.Now()
+	err = w.env.DB.View(func(tx *bolt.Tx) error {
+		c := cfg.bucket(tx, n).Cursor()
+		for k, v := c.Seek(k); k != nil && count < length; k, v = c.Next() {
+			cfg.checkValue(k, v)
+			count++
+		}
+		return nil
+	})
+	w.record(scriptScan, t)
+	w.count += count
+	return starlark.MakeInt(count), err
+}
+
+func (w *scriptWorkload) random(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var n int
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &n); err != nil {
+		return nil, err
+	} else if n <= 0 {
+		return nil, fmt.Errorf("random: n must be positive")
+	}
+	return starlark.MakeInt(w.env.Rand.Intn(n)), nil
+}
+
+func (w *scriptWorkload) choose(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	return starlark.MakeInt(w.env.keys.next(w.env.Rand)), nil
+}
@@ -0,0 +1,421 @@
+package copybench
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// seedMain creates a new database and populates it with the initial dataset.
+func seedMain(args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	cfg := defaultConfig()
+	out := fs.String("o", "", "write results as JSON to `FILE`")
+	fs.BoolVar(&cfg.NoSync, "nosync", cfg.NoSync, "don't fsync each commit, only once the dataset is written")
+	fs.IntVar(&cfg.Preallocate, "preallocate", cfg.Preallocate, "extend the new database file to `BYTES` before seeding")
+	memoryCSV := fs.String("memory-csv", "", "write memory usage every second as CSV to `FILE`")
+	resume := fs.Bool("resume", false, "resume an interrupted seed of an existing database")
+	fs.StringVar(&cfg.SeedMode, "seed-mode", cfg.SeedMode, "seed with `MODE` (update for batched db.Update, batch for concurrent db.Batch)")
+	fs.Var(seedWorkersFlag{cfg}, "seed-workers", "seed from `N` goroutines with db.Batch (implies -seed-mode batch)")
+	path, err := parseFlags(fs, args, cfg)
+	if err != nil {
+		return err
+	}
+	handleSignals()
+
+	// Only resume if there is something to resume from.
+	if *resume {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			*resume = false
+		}
+	}
+	eng, err := openEngine(path, !*resume, cfg)
+	if err != nil {
+		return err
+	}
+	defer eng.Close()
+	r, ok := eng.(resumer)
+	if *resume && !ok {
+		return fmt.Errorf("the %s engine can't resume seeding", cfg.Engine)
+	} else if *resume && cfg.InsertOrder != orderSequential {
+		// Resuming relies on every key below the highest one being seeded.
+		return fmt.Errorf("can't resume a seed in %s insert order", cfg.InsertOrder)
+	} else if *resume && cfg.SeedMode == seedModeBatch {
+		// Concurrent producers commit out of order, leaving gaps below it.
+		return fmt.Errorf("can't resume a seed in %s seed mode", cfg.SeedMode)
+	}
+
+	// Bolt's counters are only available with the bolt engine.
+	db := boltDB(eng)
+	var before *statsSnapshot
+	if db != nil {
+		if before, err = snapshotStats(db); err != nil {
+			return err
+		}
+	}
+	var memory *memorySampler
+	if *memoryCSV != "" {
+		if memory, err = startMemorySampler(*memoryCSV); err != nil {
+			return err
+		}
+		defer memory.Close()
+		memory.setPhase("seed")
+	}
+	var commits int
+	if db != nil {
+		if commits, err = txID(db); err != nil {
+			return err
+		}
+	}
+	t := time.Now()
+	var resumed int
+	if *resume {
+		resumed, err = r.Resume()
+	} else {
+		err = eng.Seed()
+	}
+	if err != nil {
+		return err
+	}
+	if err := memory.Close(); err != nil {
+		return err
+	}
+	pr := &phaseResult{Name: "seed", Duration: time.Since(t), Rows: cfg.ItemCount}
+	if *resume {
+		pr.Rows = cfg.ItemCount - resumed
+		fmt.Fprintf(stdout, "resumed: %d of %d rows were already seeded, the dataset is complete\n", resumed, cfg.ItemCount)
+	}
+	if db != nil {
+		last, err := txID(db)
+		if err != nil {
+			return err
+		}
+		pr.Seed = &seedStats{Mode: cfg.SeedMode, Commits: last - commits, RowsPerSec: float64(pr.Rows) / pr.Duration.Seconds()}
+		if pr.Seed.Commits > 0 {
+			pr.Seed.KeysPerCommit = float64(pr.Rows) / float64(pr.Seed.Commits)
+		}
+		if b, ok := eng.(batcher); ok {
+			pr.Seed.Batch = b.BatchStats()
+		}
+		fmt.Fprintf(stdout, "seed: %s\n", pr.Seed)
+	}
+	if cfg.NoSync {
+		fmt.Fprintln(stdout, "nosync: commits were not synced, the database was synced once at the end")
+	}
+	if p, ok := eng.(preallocator); ok && cfg.Preallocate > 0 && !*resume {
+		pr.Preallocate = p.Preallocated()
+		fmt.Fprintf(stdout, "preallocate: %d bytes in %v (not included in the seed time)\n", cfg.Preallocate, pr.Preallocate)
+	}
+	if m, ok := eng.(mmapper); ok {
+		pr.MmapGrowths = m.MmapGrowths()
+		fmt.Fprintf(stdout, "mmap: %d growths (initial size: %d bytes)\n", pr.MmapGrowths, cfg.InitialMmapSize)
+	}
+	if db != nil {
+		after, err := snapshotStats(db)
+		if err != nil {
+			return err
+		}
+		pr.Stats = after.sub(before)
+		fmt.Fprintf(stdout, "stats: %s\n", pr.Stats)
+	}
+	if f, ok := eng.(freelister); ok {
+		pr.Freelist = f.Freelist()
+		fmt.Fprintf(stdout, "freelist: %s\n", pr.Freelist)
+	}
+
+	res := newResult("seed", path, cfg)
+	res.Phases = append(res.Phases, pr)
+
+	if res.Size, err = stat(eng); err != nil {
+		return err
+	}
+	return res.save(*out)
+}
+
+// Seeding strategies accepted by seed_mode.
+const (
+	seedModeUpdate = "update" // one db.Update per batch of batch_size keys
+	seedModeBatch  = "batch"  // concurrent producers calling db.Batch per key
+)
+
+// seedWorkersFlag is the -seed-workers N flag, which also selects the batch
+// seed mode.
+type seedWorkersFlag struct{ cfg *Config }
+
+func (f seedWorkersFlag) String() string { return "" }
+
+func (f seedWorkersFlag) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	f.cfg.SeedWorkers, f.cfg.SeedMode = n, seedModeBatch
+	return nil
+}
+
+// seedStats describes how the dataset was written.
+type seedStats struct {
+	Mode          string      `json:"mode"`
+	Commits       int         `json:"commits"`
+	KeysPerCommit float64     `json:"keys_per_commit"`
+	RowsPerSec    float64     `json:"rows_per_sec"`
+	Batch         *batchStats `json:"batch,omitempty"`
+}
+
+// String summarizes the seed on a single line.
+func (s *seedStats) String() string {
+	str := fmt.Sprintf("%.0f rows/s in %d commits of %.1f keys (%s)", s.RowsPerSec, s.Commits, s.KeysPerCommit, s.Mode)
+	if s.Batch != nil {
+		str += ", " + s.Batch.String()
+	}
+	return str
+}
+
+// batchStats counts the db.Batch calls of a batch seed. When a call fails,
+// bolt rolls back the transaction it was coalesced into, which every other
+// call of the batch shares, and runs the others again: Conflicts counts the
+// failed calls and Retries the calls run more than once.
+type batchStats struct {
+	Workers   int   `json:"workers"`
+	Calls     int64 `json:"calls"`
+	Retries   int64 `json:"retries"`
+	Conflicts int64 `json:"conflicts"`
+}
+
+// String summarizes the calls on a single line.
+func (s *batchStats) String() string {
+	return fmt.Sprintf("%d workers, %d calls, %d retries, %d conflicts", s.Workers, s.Calls, s.Retries, s.Conflicts)
+}
+
+// txID returns the ID of the last transaction committed to db.
+func txID(db *bolt.DB) (int, error) {
+	var id int
+	err := db.View(func(tx *bolt.Tx) error {
+		id = tx.ID()
+		return nil
+	})
+	return id, err
+}
+
+// seed inserts an initial dataset into the database, from the key with index
+// start on, recording the size of the database after each batch with mmap.
+func seed(db *bolt.DB, cfg *Config, mmap *mmapTracker, start int) error {
+	log.Print("seeding")
+
+	count := start
+	var size int64
+	r := newSeedRand(cfg, start)
+	order := cfg.insertOrder()
+	progress := newSeedProgress(cfg.ItemCount, start)
+	for count < cfg.ItemCount {
+		if isInterrupted() {
+			return fmt.Errorf("interrupted after %d of %d rows (resume with seed -resume)", count, cfg.ItemCount)
+		}
+		err := db.Update(func(tx *bolt.Tx) error {
+			if _, err := cfg.createBuckets(tx); err != nil {
+				return err
+			}
+
+			for j := 0; j < cfg.BatchSize && count < cfg.ItemCount; j++ {
+				n := order(count)
+				k, v := make([]byte, cfg.KeySize), make([]byte, cfg.valueSize(r))
+				cfg.encodeKey(k, n)
+				cfg.fillValue(k, v)
+				if err := cfg.seedBucket(tx, n).Put(k, v); err != nil {
+					return fmt.Errorf("put: %s", err)
+				}
+				count++
+			}
+
+			size = tx.Size()
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		mmap.observe(size)
+		progress.update(count, size)
+	}
+	progress.done()
+	log.Print("(done)")
+	fmt.Fprintln(stdout, "")
+
+	if count != cfg.ItemCount {
+		return fmt.Errorf("invalid insert count: %d != %d", count, cfg.ItemCount)
+	}
+
+	return nil
+}
+
+// seedBatch inserts the dataset like seed, but from SeedWorkers concurrent
+// producers, BatchSize by default, that each put one key at a time with
+// db.Batch, which coalesces their calls into transactions of up to BatchSize
+// keys. The keys and values are generated in order by a single goroutine, so
+// the dataset is the same as seed's. The calls are counted in stats.
+func seedBatch(db *bolt.DB, cfg *Config, mmap *mmapTracker, start int, stats *batchStats) error {
+	log.Print("seeding")
+
+	type item struct {
+		n    int
+		k, v []byte
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := cfg.createBuckets(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// A signal stops the generator, and the producers drain the keys already
+	// generated, so that an interrupted seed can be resumed.
+	items := make(chan item, cfg.BatchSize)
+	var stopped bool
+	go func() {
+		defer close(items)
+		r := newSeedRand(cfg, start)
+		order := cfg.insertOrder()
+		for i := start; i < cfg.ItemCount; i++ {
+			if isInterrupted() {
+				stopped = true
+				return
+			}
+			n := order(i)
+			k, v := make([]byte, cfg.KeySize), make([]byte, cfg.valueSize(r))
+			cfg.encodeKey(k, n)
+			cfg.fillValue(k, v)
+			items <- item{n, k, v}
+		}
+	}()
+
+	db.MaxBatchSize = cfg.BatchSize
+	stats.Workers = cfg.SeedWorkers
+	if stats.Workers == 0 {
+		stats.Workers = cfg.BatchSize
+	}
+	count, size := int64(start), int64(0)
+	var wg sync.WaitGroup
+	errs := make(chan error, stats.Workers)
+	for i := 0; i < stats.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range items {
+				var calls int
+				err := db.Batch(func(tx *bolt.Tx) error {
+					atomic.AddInt64(&stats.Calls, 1)
+					if calls++; calls > 1 {
+						atomic.AddInt64(&stats.Retries, 1)
+					}
+					if err := cfg.seedBucket(tx, it.n).Put(it.k, it.v); err != nil {
+						atomic.AddInt64(&stats.Conflicts, 1)
+						return fmt.Errorf("put: %s", err)
+					}
+					atomic.StoreInt64(&size, tx.Size())
+					return nil
+				})
+				if err != nil {
+					errs <- err
+					for range items {
+					}
+					return
+				}
+				atomic.AddInt64(&count, 1)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	progress := newSeedProgress(cfg.ItemCount, start)
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+loop:
+	for {
+		select {
+		case <-ticker.C:
+		case <-done:
+			break loop
+		}
+		sz := atomic.LoadInt64(&size)
+		mmap.observe(sz)
+		progress.update(int(atomic.LoadInt64(&count)), sz)
+	}
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	} else if stopped {
+		return fmt.Errorf("interrupted after %d of %d rows", count, cfg.ItemCount)
+	}
+	mmap.observe(size)
+	progress.update(int(count), size)
+	progress.done()
+	log.Print("(done)")
+	fmt.Fprintln(stdout, "")
+	return nil
+}
+
+// Key orders accepted by insert_order, besides orderSequential and
+// orderRandom.
+const orderReverse = "reverse" // keys in descending order
+
+// insertOrder returns the index of the i-th key seeded in the scenario's
+// insert order. A random order is a permutation drawn from its own stream.
+func (c *Config) insertOrder() func(i int) int {
+	switch c.InsertOrder {
+	case orderRandom:
+		perm := newRand(c, streamInsert).Perm(c.ItemCount)
+		return func(i int) int { return perm[i] }
+	case orderReverse:
+		return func(i int) int { return c.ItemCount - 1 - i }
+	default:
+		return func(i int) int { return i }
+	}
+}
+
+// newSeedRand returns the generator of the seeded value sizes, advanced past
+// the first start keys so that a resumed seed writes the same values.
+func newSeedRand(cfg *Config, start int) *rand.Rand {
+	r := newRand(cfg, streamSeed)
+	for i := 0; i < start; i++ {
+		cfg.valueSize(r)
+	}
+	return r
+}
+
+// seeded returns the number of keys of an interrupted seed: one more than the
+// index of the highest key in any bucket. Every batch is committed at once,
+// so every key below it was seeded.
+func seeded(db *bolt.DB, cfg *Config) (int, error) {
+	var n int
+	err := db.View(func(tx *bolt.Tx) error {
+		for i := 0; i < cfg.Buckets; i++ {
+			top := tx.Bucket(cfg.bucketKey(i))
+			for l := 0; l < cfg.leaves() && top != nil; l++ {
+				b := top
+				if cfg.NestDepth > 0 {
+					if b = cfg.leaf(top, l); b == nil {
+						continue
+					}
+				}
+				if k, _ := b.Cursor().Last(); k != nil && cfg.decodeKey(k)+1 > n {
+					n = cfg.decodeKey(k) + 1
+				}
+			}
+		}
+		return nil
+	})
+	return n, err
+}
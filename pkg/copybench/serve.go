@@ -0,0 +1,218 @@
+package copybench
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// serveMain serves copies of the database over HTTP and measures the impact
+// of every download on concurrent iteration.
+func serveMain(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	cfg := defaultConfig()
+	addr := fs.String("addr", "localhost:8080", "listen on `ADDR`")
+	count := fs.Int("count", 1, "exit after serving `N` copies (0 serves forever)")
+	out := fs.String("o", "", "write results as JSON to `FILE`")
+	path, err := parseFlags(fs, args, cfg)
+	if err != nil {
+		return err
+	}
+	if err := requireBolt(cfg, "serve"); err != nil {
+		return err
+	}
+	handleSignals()
+
+	eng, err := openEngine(path, false, cfg)
+	if err != nil {
+		return err
+	}
+	defer eng.Close()
+	if err := cfg.checkBuckets(boltDB(eng)); err != nil {
+		return err
+	}
+
+	res := newResult("serve", path, cfg)
+	if res.Size, err = stat(eng); err != nil {
+		return err
+	}
+
+	// Measure iteration with no download in flight for comparison.
+	b := newBench(eng, cfg)
+	b.path = path
+	pr, err := b.runPhase(phaseIterate)
+	if err != nil {
+		return err
+	}
+	res.Phases = append(res.Phases, pr)
+
+	s := &copyServer{b: b, res: res, count: *count, done: make(chan struct{})}
+	srv := &http.Server{Addr: *addr, Handler: s}
+	// Stop once the last copy is served, or on a signal, which aborts the
+	// copy in flight. Shutdown returns once no handler is running.
+	shutdown := make(chan struct{})
+	go func() {
+		select {
+		case <-s.done:
+		case <-interrupted:
+		}
+		srv.Shutdown(context.Background())
+		close(shutdown)
+	}()
+
+	log.Printf("serving copies on http://%s/backup", *addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	<-shutdown
+	setPhase("")
+	res.Interrupted = isInterrupted()
+
+	if res.Impact = res.copyImpact(); res.Impact != nil {
+		res.Impact.print()
+	}
+	return res.save(*out)
+}
+
+// copyServer streams a copy of the database to every GET /backup request.
+// Downloads are served one at a time so each is measured in isolation.
+type copyServer struct {
+	mu     sync.Mutex
+	b      *bench
+	res    *Result
+	count  int
+	served int
+	done   chan struct{}
+}
+
+// ServeHTTP streams a copy of the database while iterating concurrently.
+func (s *copyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/backup" {
+		http.NotFound(w, r)
+		return
+	} else if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count > 0 && s.served >= s.count {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprintf(stdout, "iterate during download (%s)\n", r.RemoteAddr)
+	pr, err := s.b.measure(phaseCopy, func(pr *phaseResult) error {
+		stop, err := s.b.startIterate(phaseCopy)
+		if err != nil {
+			return err
+		}
+		cs, err := serveCopy(s.b.db, w, r.RemoteAddr)
+		it, stopErr := stop()
+		if err != nil {
+			return err
+		} else if stopErr != nil {
+			return stopErr
+		}
+		pr.Iterate = it
+		cs.print()
+		pr.Copies = []*copyStats{cs}
+		return nil
+	})
+	if err != nil {
+		log.Printf("serve: %s: %s", r.RemoteAddr, err)
+		return
+	}
+	s.res.Phases = append(s.res.Phases, pr)
+
+	if s.served++; s.count > 0 && s.served == s.count {
+		close(s.done)
+	}
+}
+
+// serveCopy writes a timed copy of the database as an HTTP response.
+func serveCopy(db *bolt.DB, w http.ResponseWriter, name string) (*copyStats, error) {
+	mw := &meteredWriter{w: w}
+	atomic.StoreInt64(&copyProgress, 0)
+	t := time.Now()
+	err := db.View(func(tx *bolt.Tx) error {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(tx.Size(), 10))
+		return tx.Copy(mw)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &copyStats{Target: name, Duration: time.Since(t), Bytes: mw.n}, nil
+}
+
+// fetchMain downloads a copy served by the serve command, optionally reading
+// it slowly to simulate a remote or overloaded backup consumer.
+func fetchMain(args []string) error {
+	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	rate := fs.Float64("rate", 0, "read the copy at no more than `MB/s` (0 for unlimited)")
+	dest := fs.String("dest", "", "write the copy to `PATH` instead of discarding it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() != 1 {
+		return errUsage
+	}
+	url := fs.Arg(0)
+
+	var w io.Writer = ioutil.Discard
+	var f *os.File
+	if *dest != "" {
+		var err error
+		if f, err = os.Create(*dest); err != nil {
+			return err
+		}
+		defer func() {
+			if f != nil {
+				f.Close()
+			}
+		}()
+		w = f
+	}
+	if *rate > 0 {
+		w = newLimitedWriter(w, *rate)
+	}
+
+	t := time.Now()
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch: %s", resp.Status)
+	}
+
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return err
+	}
+	d := time.Since(t)
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return fmt.Errorf("fetch: short copy: %d of %d bytes", n, resp.ContentLength)
+	}
+	fmt.Fprintf(stdout, "fetch: %v (%d bytes, %.1f MB/s)\n", d, n, float64(n)/1e6/d.Seconds())
+
+	if f != nil {
+		err := f.Close()
+		f = nil
+		return err
+	}
+	return nil
+}
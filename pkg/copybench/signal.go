@@ -0,0 +1,58 @@
+package copybench
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// interrupted is closed when the process receives SIGINT or SIGTERM, once
+// handleSignals has been called, or when a run is aborted through the
+// control API.
+var (
+	interrupted   = make(chan struct{})
+	interruptOnce sync.Once
+)
+
+// interruptCtx is cancelled along with interrupted, for waits that take a
+// context.
+var interruptCtx, cancelInterrupt = context.WithCancel(context.Background())
+
+// interrupt closes interrupted, if it isn't already.
+func interrupt() {
+	interruptOnce.Do(func() {
+		close(interrupted)
+		cancelInterrupt()
+	})
+}
+
+// errInterrupted is returned by work cut short by a signal.
+var errInterrupted = errors.New("interrupted")
+
+// handleSignals closes interrupted on the first SIGINT or SIGTERM, so that the
+// command can stop its work, close the database and report what it measured
+// so far. A second signal terminates the process.
+func handleSignals() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-c
+		signal.Stop(c)
+		log.Printf("%s: stopping (signal again to quit now)", s)
+		interrupt()
+	}()
+}
+
+// isInterrupted reports whether a signal was received.
+func isInterrupted() bool {
+	select {
+	case <-interrupted:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,184 @@
+package copybench
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/boltdb/bolt"
+)
+
+// snapshotKeys is the number of keys the snapshot writer rewrites in every
+// transaction, spread evenly across the dataset and so across its buckets.
+const snapshotKeys = 64
+
+// snapshotWriter rewrites the same keys with an increasing generation number
+// in every write transaction while the copy phase runs, so that copies can be
+// checked to hold a single generation: the one committed when their read
+// transaction began.
+type snapshotWriter struct {
+	b      *bench
+	cancel context.CancelFunc
+	done   chan error
+
+	// started is the generation of the transaction in progress or last
+	// committed, and committed the generation of the last commit.
+	started, committed uint64
+}
+
+// snapshotCheck describes the snapshot a copy was found to hold.
+type snapshotCheck struct {
+	Keys       int    `json:"keys"`
+	Generation uint64 `json:"generation"`
+
+	// Min and Max bound the generation the copy may hold: the last one
+	// committed before it started and the last one started before it
+	// completed.
+	Min uint64 `json:"min"`
+	Max uint64 `json:"max"`
+}
+
+// String summarizes the check on a single line.
+func (s *snapshotCheck) String() string {
+	return fmt.Sprintf("%d keys at generation %d (%d committed during the copy)", s.Keys, s.Generation, s.Max-s.Min)
+}
+
+// snapshotKey returns the index of the i-th key rewritten by the snapshot
+// writer.
+func (c *Config) snapshotKey(i int) int {
+	return i * (c.ItemCount / snapshotKeys)
+}
+
+// startSnapshotWriter writes the first generation, so that every key holds a
+// known one before the first copy begins, and keeps writing new generations
+// in the background until stopped.
+func (b *bench) startSnapshotWriter() (*snapshotWriter, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &snapshotWriter{b: b, cancel: cancel, done: make(chan error, 1)}
+	if err := w.write(); err != nil {
+		return nil, err
+	}
+	go func() {
+		for ctx.Err() == nil {
+			if err := w.write(); err != nil {
+				w.done <- err
+				return
+			}
+		}
+		w.done <- nil
+	}()
+	return w, nil
+}
+
+// write rewrites every snapshot key with the next generation in a single
+// transaction. Values keep their size, filled with the generation repeated.
+func (w *snapshotWriter) write() error {
+	cfg := w.b.cfg
+	gen := atomic.AddUint64(&w.started, 1)
+	err := w.b.db.Update(func(tx *bolt.Tx) error {
+		k := make([]byte, cfg.KeySize)
+		for i := 0; i < snapshotKeys; i++ {
+			n := cfg.snapshotKey(i)
+			cfg.encodeKey(k, n)
+			b := cfg.bucket(tx, n)
+			old := b.Get(k)
+			if len(old) < 8 {
+				return fmt.Errorf("snapshot: key %d has a %d byte value, too small for a generation", n, len(old))
+			}
+			v := make([]byte, len(old))
+			for j := 0; j+8 <= len(v); j += 8 {
+				binary.BigEndian.PutUint64(v[j:], gen)
+			}
+			if err := b.Put(k, v); err != nil {
+				return fmt.Errorf("snapshot: put: %s", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint64(&w.committed, gen)
+	return nil
+}
+
+// stop stops writing and returns the number of generations committed.
+func (w *snapshotWriter) stop() (uint64, error) {
+	w.cancel()
+	err := <-w.done
+	return atomic.LoadUint64(&w.committed), err
+}
+
+// copy copies the database with dbcopy and checks that every copy to a file
+// holds a single generation of the snapshot keys, committed while the copy
+// ran: at least the last one committed before it started and at most the
+// last one started before it completed. A copy holding several generations,
+// or a value mixing two, was not a point-in-time snapshot.
+func (w *snapshotWriter) copy() ([]*copyStats, error) {
+	lo := atomic.LoadUint64(&w.committed)
+	copies, err := dbcopy(w.b.eng, w.b.cfg)
+	if err != nil {
+		return nil, err
+	}
+	hi := atomic.LoadUint64(&w.started)
+	var checked int
+	for _, cs := range copies {
+		if cs.Target == "discard" || strings.Contains(cs.Target, "://") {
+			continue
+		}
+		if cs.Snapshot, err = checkSnapshot(cs.Target, w.b.cfg, lo, hi); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(stdout, "snapshot: %s\n", cs.Snapshot)
+		checked++
+	}
+	if checked == 0 {
+		return nil, fmt.Errorf("verify_snapshot needs a file in copy_targets")
+	}
+	return copies, nil
+}
+
+// checkSnapshot opens the copy at path and checks that its snapshot keys hold
+// a single generation between lo and hi.
+func checkSnapshot(path string, cfg *Config, lo, hi uint64) (*snapshotCheck, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %s", path, err)
+	}
+	defer db.Close()
+
+	s := &snapshotCheck{Keys: snapshotKeys, Min: lo, Max: hi}
+	err = db.View(func(tx *bolt.Tx) error {
+		k := make([]byte, cfg.KeySize)
+		first := -1
+		for i := 0; i < snapshotKeys; i++ {
+			n := cfg.snapshotKey(i)
+			cfg.encodeKey(k, n)
+			v := cfg.bucket(tx, n).Get(k)
+			if len(v) < 8 {
+				return fmt.Errorf("key %d: missing or truncated value", n)
+			}
+			gen := binary.BigEndian.Uint64(v)
+			for j := 8; j+8 <= len(v); j += 8 {
+				if g := binary.BigEndian.Uint64(v[j:]); g != gen {
+					return fmt.Errorf("key %d: torn value holding generations %d and %d", n, gen, g)
+				}
+			}
+			if first < 0 {
+				first, s.Generation = n, gen
+			} else if gen != s.Generation {
+				return fmt.Errorf("mixed versions: key %d holds generation %d, key %d generation %d", first, s.Generation, n, gen)
+			}
+		}
+		if s.Generation < lo || s.Generation > hi {
+			return fmt.Errorf("generation %d wasn't committed during the copy (%d to %d)", s.Generation, lo, hi)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %s", path, err)
+	}
+	return s, nil
+}
@@ -0,0 +1,245 @@
+package copybench
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// defaultSoakMix is the mixed workload a soak runs unless the scenario sets
+// one.
+const defaultSoakMix = "90:10"
+
+// soakMain runs mixed traffic against an existing database for hours, copying
+// it at regular intervals, and reports how the copies, the size of the
+// database and the tail latencies drift over time.
+func soakMain(args []string) error {
+	fs := flag.NewFlagSet("soak", flag.ExitOnError)
+	cfg := defaultConfig()
+	out := fs.String("o", "", "write results as JSON to `FILE`")
+	csvPath := fs.String("csv", "", "write every round as CSV to `FILE`")
+	fs.StringVar(&cfg.Mix, "mix", cfg.Mix, "run a mixed load of reads and writes at `READ:WRITE` (default "+defaultSoakMix+")")
+	fs.DurationVar(&cfg.SoakInterval.Duration, "interval", cfg.SoakInterval.Duration, "copy the database every `D`")
+	fs.DurationVar(&cfg.SoakDuration.Duration, "duration", cfg.SoakDuration.Duration, "soak for `D` (0 runs until interrupted)")
+	registerCopyFlags(fs, cfg)
+	path, err := parseFlags(fs, args, cfg)
+	if err != nil {
+		return err
+	}
+	if err := requireBolt(cfg, "soak"); err != nil {
+		return err
+	}
+	if cfg.SeparateReader {
+		// The mixed workload writes.
+		return fmt.Errorf("soak does not support separate_reader")
+	}
+	if cfg.Mix == "" {
+		cfg.Mix = defaultSoakMix
+	}
+	handleSignals()
+
+	eng, err := openEngine(path, false, cfg)
+	if err != nil {
+		return err
+	}
+	b := newBench(eng, cfg)
+	b.path = path
+	defer b.close()
+	if err := cfg.checkBuckets(b.db); err != nil {
+		return err
+	}
+
+	res := newResult("soak", path, cfg)
+	if res.Size, err = stat(eng); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "soak: mix %s, copying every %v for %v\n\n", cfg.Mix, cfg.SoakInterval, cfg.SoakDuration)
+	if res.Soak, err = b.soak(); err != nil {
+		return err
+	}
+	res.Interrupted = isInterrupted()
+	res.Soak.print()
+
+	if err := writeSoakCSV(*csvPath, res.Soak.Rounds); err != nil {
+		return err
+	}
+	return res.save(*out)
+}
+
+// soakStats holds the rounds of a soak and the drift of their measurements.
+type soakStats struct {
+	Rounds []*soakRound `json:"rounds"`
+	Drift  *soakDrift   `json:"drift,omitempty"`
+}
+
+// soakRound holds the measurements of one soak interval: the mixed traffic
+// run during it and the copy that ends it.
+type soakRound struct {
+	// Elapsed is the time since the start of the soak at the end of the
+	// round, and Copy the total duration of its copies.
+	Elapsed time.Duration `json:"elapsed"`
+	Copy    time.Duration `json:"copy"`
+	Size    int64         `json:"size"`
+
+	Reads     int           `json:"reads"`
+	Writes    int           `json:"writes"`
+	ReadP99   time.Duration `json:"read_p99"`
+	WriteP99  time.Duration `json:"write_p99"`
+	FreePages int           `json:"free_pages"`
+}
+
+// soakDrift is the least-squares trend of each measurement over the soak, in
+// percent of its value in the first round per hour.
+type soakDrift struct {
+	Copy     float64 `json:"copy_pct_per_hour"`
+	Size     float64 `json:"size_pct_per_hour"`
+	ReadP99  float64 `json:"read_p99_pct_per_hour"`
+	WriteP99 float64 `json:"write_p99_pct_per_hour"`
+}
+
+// soak runs the scenario's mixed workload until the soak duration has elapsed
+// or a signal is received, copying the database at the end of every interval
+// while the workload keeps running. The workload is restarted every round so
+// that each round's latencies are its own.
+func (b *bench) soak() (*soakStats, error) {
+	var stats soakStats
+	t := time.Now()
+	deadline := t.Add(b.cfg.SoakDuration.Duration)
+	for round := 1; ; round++ {
+		stopMix := b.startMix()
+		wait := b.cfg.SoakInterval.Duration
+		if d := time.Until(deadline); b.cfg.SoakDuration.Duration > 0 && d < wait {
+			wait = d
+		}
+		select {
+		case <-time.After(wait):
+		case <-interrupted:
+		}
+		if isInterrupted() {
+			stopMix()
+			break
+		}
+
+		copies, err := dbcopy(b.eng, b.cfg)
+		ms := stopMix()
+		if err == errInterrupted {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		r := &soakRound{Elapsed: time.Since(t), Reads: ms.Reads, Writes: ms.Writes}
+		for _, cs := range copies {
+			r.Copy += cs.Duration
+		}
+		if ms.ReadLatency != nil {
+			r.ReadP99 = ms.ReadLatency.P99
+		}
+		if ms.WriteLatency != nil {
+			r.WriteP99 = ms.WriteLatency.P99
+		}
+		if r.Size, err = b.eng.Size(); err != nil {
+			return nil, err
+		}
+		r.FreePages = b.db.Stats().FreePageN
+		stats.Rounds = append(stats.Rounds, r)
+		fmt.Fprintf(stdout, "round %d: %s\n\n", round, r)
+
+		if b.cfg.SoakDuration.Duration > 0 && !time.Now().Before(deadline) {
+			break
+		}
+	}
+	stats.Drift = drift(stats.Rounds)
+	return &stats, nil
+}
+
+// String summarizes the round on a single line.
+func (r *soakRound) String() string {
+	return fmt.Sprintf("at %v, copy: %v, size: %d bytes, %d free pages, reads: %d (p99: %v), writes: %d (p99: %v)",
+		r.Elapsed.Round(time.Second), r.Copy, r.Size, r.FreePages, r.Reads, r.ReadP99, r.Writes, r.WriteP99)
+}
+
+// drift returns the trend of the rounds' measurements, or nil with fewer than
+// two rounds.
+func drift(rounds []*soakRound) *soakDrift {
+	if len(rounds) < 2 {
+		return nil
+	}
+	hours := make([]float64, len(rounds))
+	copies, sizes, reads, writes := make([]float64, len(rounds)), make([]float64, len(rounds)), make([]float64, len(rounds)), make([]float64, len(rounds))
+	for i, r := range rounds {
+		hours[i] = r.Elapsed.Hours()
+		copies[i], sizes[i] = float64(r.Copy), float64(r.Size)
+		reads[i], writes[i] = float64(r.ReadP99), float64(r.WriteP99)
+	}
+	return &soakDrift{
+		Copy:     trend(hours, copies),
+		Size:     trend(hours, sizes),
+		ReadP99:  trend(hours, reads),
+		WriteP99: trend(hours, writes),
+	}
+}
+
+// trend returns the slope of the least-squares line through the points xs, ys
+// as a percentage of ys[0], or zero if ys[0] is.
+func trend(xs, ys []float64) float64 {
+	var mx, my float64
+	for i := range xs {
+		mx += xs[i]
+		my += ys[i]
+	}
+	mx, my = mx/float64(len(xs)), my/float64(len(ys))
+	var sxy, sxx float64
+	for i := range xs {
+		sxy += (xs[i] - mx) * (ys[i] - my)
+		sxx += (xs[i] - mx) * (xs[i] - mx)
+	}
+	if sxx == 0 || ys[0] == 0 {
+		return 0
+	}
+	return sxy / sxx / ys[0] * 100
+}
+
+// print reports the drift of the soak.
+func (s *soakStats) print() {
+	fmt.Fprintf(stdout, "soak: %d rounds\n", len(s.Rounds))
+	if d := s.Drift; d != nil {
+		fmt.Fprintf(stdout, "drift: copy %+.1f%%/h, size %+.1f%%/h, read p99 %+.1f%%/h, write p99 %+.1f%%/h\n",
+			d.Copy, d.Size, d.ReadP99, d.WriteP99)
+	}
+	fmt.Fprintln(stdout, "")
+}
+
+// writeSoakCSV writes the rounds of a soak to path, if set.
+func writeSoakCSV(path string, rounds []*soakRound) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"round", "elapsed_ns", "copy_ns", "size_bytes", "free_pages", "reads", "writes", "read_p99_ns", "write_p99_ns"})
+	for i, r := range rounds {
+		w.Write([]string{
+			strconv.Itoa(i + 1),
+			strconv.FormatInt(int64(r.Elapsed), 10),
+			strconv.FormatInt(int64(r.Copy), 10),
+			strconv.FormatInt(r.Size, 10),
+			strconv.Itoa(r.FreePages),
+			strconv.Itoa(r.Reads),
+			strconv.Itoa(r.Writes),
+			strconv.FormatInt(int64(r.ReadP99), 10),
+			strconv.FormatInt(int64(r.WriteP99), 10),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,162 @@
+package copybench
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// statsdInterval is how often buffered StatsD metrics are sent.
+const statsdInterval = time.Second
+
+// statsdPacket is the largest datagram the StatsD sink sends, which fits an
+// Ethernet frame without fragmenting.
+const statsdPacket = 1432
+
+// statsdSink sends counters and timings over UDP to a StatsD server, such as
+// the Datadog agent's DogStatsD, buffering them into datagrams sent every
+// statsdInterval. All methods are no-ops on a nil sink.
+type statsdSink struct {
+	mu         sync.Mutex
+	conn       net.Conn
+	tags       string
+	buf        bytes.Buffer
+	lastCopied int64
+	failed     bool
+
+	closing chan struct{}
+	done    chan struct{}
+}
+
+// startStatsdSink sends metrics of a run of command to the StatsD server at
+// addr. Unless plain is set, metrics are tagged with the command, engine and
+// phase in DogStatsD's format, which plain StatsD servers don't accept. It
+// returns nil if addr is empty.
+func startStatsdSink(addr string, plain bool, command string, cfg *Config) (*statsdSink, error) {
+	if addr == "" {
+		return nil, nil
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %s", err)
+	}
+	s := &statsdSink{
+		conn:       conn,
+		lastCopied: atomic.LoadInt64(&bytesCopied),
+		closing:    make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	if !plain {
+		s.tags = "command:" + command + ",engine:" + cfg.Engine
+	}
+	log.Printf("statsd: sending to %s", addr)
+	go s.run()
+	return s, nil
+}
+
+// run sends the buffered metrics every statsdInterval until the sink is
+// closed.
+func (s *statsdSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(statsdInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closing:
+			s.flush()
+			return
+		case <-ticker.C:
+			s.flush()
+		}
+	}
+}
+
+// Close sends the metrics still buffered and closes the connection.
+func (s *statsdSink) Close() {
+	if s == nil {
+		return
+	}
+	close(s.closing)
+	<-s.done
+	s.conn.Close()
+}
+
+// observe records a single iteration pass of phase that read keys.
+func (s *statsdSink) observe(phase string, d time.Duration, keys int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add("iterations", "1|c", phase)
+	s.add("iterate.keys", fmt.Sprintf("%d|c", keys), phase)
+	s.add("iterate.duration", statsdMillis(d), phase)
+}
+
+// phase records the duration of a completed phase and of each of its copies.
+func (s *statsdSink) phase(pr *phaseResult) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add("phase.duration", statsdMillis(pr.Duration), pr.Name)
+	for _, cs := range pr.Copies {
+		s.add("copy.duration", statsdMillis(cs.Duration), pr.Name)
+	}
+	s.add("phases", "1|c", pr.Name)
+}
+
+// statsdMillis formats d as a StatsD timing in milliseconds.
+func statsdMillis(d time.Duration) string {
+	return fmt.Sprintf("%.3f|ms", float64(d)/float64(time.Millisecond))
+}
+
+// add buffers the metric name, with a value such as "1|c", sending the
+// buffer first if it would overflow a datagram. The caller holds s.mu.
+func (s *statsdSink) add(name, value, phase string) {
+	line := "copybench." + name + ":" + value
+	if s.tags != "" {
+		tags := s.tags
+		if phase != "" {
+			tags += ",phase:" + phase
+		}
+		line += "|#" + tags
+	}
+	if s.buf.Len() > 0 && s.buf.Len()+1+len(line) > statsdPacket {
+		s.send()
+	}
+	if s.buf.Len() > 0 {
+		s.buf.WriteByte('\n')
+	}
+	s.buf.WriteString(line)
+}
+
+// flush adds the bytes copied since the last flush and sends the buffer.
+func (s *statsdSink) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := atomic.LoadInt64(&bytesCopied)
+	if n := copied - s.lastCopied; n > 0 {
+		s.add("copy.bytes", fmt.Sprintf("%d|c", n), "")
+	}
+	s.lastCopied = copied
+	s.send()
+}
+
+// send writes the buffer as a datagram. The first error is logged; later ones
+// are dropped as StatsD over UDP is best effort. The caller holds s.mu.
+func (s *statsdSink) send() {
+	if s.buf.Len() == 0 {
+		return
+	}
+	if _, err := s.conn.Write(s.buf.Bytes()); err != nil && !s.failed {
+		s.failed = true
+		log.Printf("statsd: %s", err)
+	}
+	s.buf.Reset()
+}
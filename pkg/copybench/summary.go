@@ -0,0 +1,129 @@
+package copybench
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// summary aggregates a single metric of a phase across repetitions.
+type summary struct {
+	Phase  string  `json:"phase"`
+	Metric string  `json:"metric"`
+	N      int     `json:"n"`
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	Stddev float64 `json:"stddev"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+}
+
+// summarize aggregates the iteration and copy metrics of every repeated
+// phase. Duration metrics are in nanoseconds.
+func (r *Result) summarize() []*summary {
+	type key struct{ phase, metric string }
+	var keys []key
+	values := make(map[key][]float64)
+	add := func(phase, metric string, v float64) {
+		k := key{phase, metric}
+		if _, ok := values[k]; !ok {
+			keys = append(keys, k)
+		}
+		values[k] = append(values[k], v)
+	}
+
+	for _, p := range r.Phases {
+		if p.Name == phaseWarmup {
+			continue
+		}
+		if p.Iterate != nil {
+			add(p.Name, "iterate_avg", float64(p.Iterate.Avg))
+			if p.Iterate.Latency != nil {
+				add(p.Name, "iterate_p99", float64(p.Iterate.Latency.P99))
+			}
+			if p.Iterate.GetLatency != nil {
+				add(p.Name, "get_p99", float64(p.Iterate.GetLatency.P99))
+			}
+			add(p.Name, "iterations", float64(p.Iterate.N))
+		}
+		if p.Mix != nil && p.Mix.WriteLatency != nil {
+			add(p.Name, "mix_write_p99", float64(p.Mix.WriteLatency.P99))
+		}
+		if p.Usage != nil {
+			add(p.Name, "major_faults", float64(p.Usage.MajorFaults))
+		}
+		if p.Mem != nil {
+			add(p.Name, "total_alloc", float64(p.Mem.TotalAlloc))
+			add(p.Name, "gc_pause", float64(p.Mem.GCPause))
+		}
+		for _, c := range p.Copies {
+			if c.Method == copyMethodWriteTo {
+				add(p.Name, "writeto_duration", float64(c.Duration))
+			} else {
+				add(p.Name, "copy_duration", float64(c.Duration))
+			}
+		}
+		if p.Compact != nil {
+			add(p.Name, "compact_duration", float64(p.Compact.Duration))
+		}
+		for _, rs := range p.Restores {
+			add(p.Name, "restore_duration", float64(rs.Duration))
+		}
+	}
+
+	var a []*summary
+	for _, k := range keys {
+		s := summarizeValues(values[k])
+		s.Phase, s.Metric = k.phase, k.metric
+		a = append(a, s)
+	}
+	return a
+}
+
+// summarizeValues computes descriptive statistics of a non-empty sample.
+func summarizeValues(values []float64) *summary {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	s := &summary{N: len(sorted), Min: sorted[0], Max: sorted[len(sorted)-1]}
+	for _, v := range sorted {
+		s.Mean += v
+	}
+	s.Mean /= float64(s.N)
+
+	if s.N%2 == 1 {
+		s.Median = sorted[s.N/2]
+	} else {
+		s.Median = (sorted[s.N/2-1] + sorted[s.N/2]) / 2
+	}
+
+	if s.N > 1 {
+		var sum float64
+		for _, v := range sorted {
+			sum += (v - s.Mean) * (v - s.Mean)
+		}
+		s.Stddev = math.Sqrt(sum / float64(s.N-1))
+	}
+	return s
+}
+
+// printSummary prints the aggregated metrics as a table.
+func printSummary(a []*summary) {
+	fmt.Fprintln(stdout, "summary")
+	w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "phase\tmetric\tn\tmean\tmedian\tstddev\tmin\tmax")
+	for _, s := range a {
+		f := func(v float64) string {
+			if s.Metric == "iterations" {
+				return fmt.Sprintf("%.1f", v)
+			}
+			return time.Duration(v).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			s.Phase, s.Metric, s.N, f(s.Mean), f(s.Median), f(s.Stddev), f(s.Min), f(s.Max))
+	}
+	w.Flush()
+	fmt.Fprintln(stdout, "")
+}
@@ -0,0 +1,258 @@
+package copybench
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// sweepConfig lists the values of each swept parameter. A sweep runs the
+// benchmark for every combination of the listed values; parameters without
+// values keep the scenario's setting.
+type sweepConfig struct {
+	ItemCount []int `toml:"item_count" json:"item_count,omitempty"`
+	BatchSize []int `toml:"batch_size" json:"batch_size,omitempty"`
+	KeySize   []int `toml:"key_size" json:"key_size,omitempty"`
+	ValueSize []int `toml:"value_size" json:"value_size,omitempty"`
+	Buckets   []int `toml:"buckets" json:"buckets,omitempty"`
+	NestDepth []int `toml:"nest_depth" json:"nest_depth,omitempty"`
+	PageSize  []int `toml:"page_size" json:"page_size,omitempty"`
+
+	Preallocate []int `toml:"preallocate" json:"preallocate,omitempty"`
+
+	FillPercent []float64 `toml:"fill_percent" json:"fill_percent,omitempty"`
+}
+
+// sweepAxis is a single swept parameter. Integer parameters are swept as
+// float64 values too.
+type sweepAxis struct {
+	name   string
+	values []float64
+	apply  func(c *Config, v float64)
+}
+
+// axes returns the parameters with at least one value, in a fixed order.
+func (s *sweepConfig) axes() []sweepAxis {
+	all := []sweepAxis{
+		{"item_count", floats(s.ItemCount), func(c *Config, v float64) { c.ItemCount = int(v) }},
+		{"batch_size", floats(s.BatchSize), func(c *Config, v float64) { c.BatchSize = int(v) }},
+		{"key_size", floats(s.KeySize), func(c *Config, v float64) { c.KeySize = int(v) }},
+		{"value_size", floats(s.ValueSize), func(c *Config, v float64) { c.ValueSize = int(v) }},
+		{"buckets", floats(s.Buckets), func(c *Config, v float64) { c.Buckets = int(v) }},
+		{"nest_depth", floats(s.NestDepth), func(c *Config, v float64) { c.NestDepth = int(v) }},
+		{"page_size", floats(s.PageSize), func(c *Config, v float64) { c.PageSize = int(v) }},
+		{"preallocate", floats(s.Preallocate), func(c *Config, v float64) { c.Preallocate = int(v) }},
+		{"fill_percent", s.FillPercent, func(c *Config, v float64) { c.FillPercent = v }},
+	}
+	var a []sweepAxis
+	for _, axis := range all {
+		if len(axis.values) > 0 {
+			a = append(a, axis)
+		}
+	}
+	return a
+}
+
+// floats converts a list of integer parameter values.
+func floats(a []int) []float64 {
+	var f []float64
+	for _, v := range a {
+		f = append(f, float64(v))
+	}
+	return f
+}
+
+// set parses a comma-separated list of values for the named parameter.
+func (s *sweepConfig) set(name, list string) error {
+	if name == "fill_percent" {
+		s.FillPercent = nil
+		for _, v := range strings.Split(list, ",") {
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return fmt.Errorf("sweep: %s: %s", name, err)
+			}
+			s.FillPercent = append(s.FillPercent, f)
+		}
+		return nil
+	}
+
+	var values []int
+	for _, v := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return fmt.Errorf("sweep: %s: %s", name, err)
+		}
+		values = append(values, n)
+	}
+
+	switch name {
+	case "item_count":
+		s.ItemCount = values
+	case "batch_size":
+		s.BatchSize = values
+	case "key_size":
+		s.KeySize = values
+	case "value_size":
+		s.ValueSize = values
+	case "buckets":
+		s.Buckets = values
+	case "nest_depth":
+		s.NestDepth = values
+	case "page_size":
+		s.PageSize = values
+	case "preallocate":
+		s.Preallocate = values
+	default:
+		return fmt.Errorf("sweep: unknown parameter: %s", name)
+	}
+	return nil
+}
+
+// sweepFlag is a repeatable -sweep NAME=V1,V2,... flag.
+type sweepFlag struct{ cfg *Config }
+
+func (f sweepFlag) String() string { return "" }
+
+func (f sweepFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return fmt.Errorf("expected NAME=V1,V2,...")
+	}
+	return f.cfg.Sweep.set(s[:i], s[i+1:])
+}
+
+// expand returns one scenario per combination of swept values along with a
+// label describing the combination.
+func (c *Config) expand() ([]*Config, []string) {
+	configs, labels := []*Config{c}, []string{""}
+	for _, axis := range c.Sweep.axes() {
+		var nextConfigs []*Config
+		var nextLabels []string
+		for i, base := range configs {
+			for _, v := range axis.values {
+				other := *base
+				axis.apply(&other, v)
+				nextConfigs = append(nextConfigs, &other)
+				nextLabels = append(nextLabels, strings.TrimSpace(fmt.Sprintf("%s %s=%g", labels[i], axis.name, v)))
+			}
+		}
+		configs, labels = nextConfigs, nextLabels
+	}
+	for _, other := range configs {
+		other.Sweep = sweepConfig{}
+	}
+	return configs, labels
+}
+
+// sweepMain seeds and benchmarks a database for every combination of swept
+// parameters and prints a comparison table.
+func sweepMain(args []string) error {
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	cfg := defaultConfig()
+	out := fs.String("o", "", "write all results as JSON to `FILE`")
+	keep := fs.Bool("keep", false, "keep the seeded databases")
+	fs.Var(sweepFlag{cfg}, "sweep", "sweep parameter values given as `NAME=V1,V2,...`")
+	dir, err := parseFlags(fs, args, cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if len(cfg.Sweep.axes()) == 0 {
+		return fmt.Errorf("sweep: no parameters to sweep (use -sweep NAME=V1,V2,...)")
+	}
+	configs, labels := cfg.expand()
+
+	var results []*Result
+	for i, c := range configs {
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("sweep: %s: %s", labels[i], err)
+		}
+		fmt.Fprintf(stdout, "sweep %d/%d: %s\n\n", i+1, len(configs), labels[i])
+
+		res, err := sweepRun(filepath.Join(dir, fmt.Sprintf("sweep-%d.db", i)), c, *keep)
+		if err != nil {
+			return fmt.Errorf("sweep: %s: %s", labels[i], err)
+		}
+		if err := res.store(); err != nil {
+			return err
+		}
+		results = append(results, res)
+	}
+
+	printSweep(labels, results)
+
+	if *out == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(*out, append(b, '\n'), 0644)
+}
+
+// sweepRun seeds a new database at path and benchmarks it.
+func sweepRun(path string, cfg *Config, keep bool) (*Result, error) {
+	os.RemoveAll(path)
+	eng, err := openEngine(path, true, cfg)
+	if err != nil {
+		return nil, err
+	}
+	b := newBench(eng, cfg)
+	b.path = path
+	defer func() {
+		b.close()
+		if !keep {
+			os.RemoveAll(path)
+		}
+	}()
+
+	res := newResult("sweep", path, cfg)
+	t := time.Now()
+	if err := eng.Seed(); err != nil {
+		return nil, err
+	}
+	res.Phases = append(res.Phases, &phaseResult{Name: "seed", Duration: time.Since(t), Rows: cfg.ItemCount})
+	if res.Size, err = stat(eng); err != nil {
+		return nil, err
+	}
+
+	if err := b.run(res); err != nil {
+		return nil, err
+	}
+	if res.Summary == nil {
+		res.Summary = res.summarize()
+	}
+	return res, nil
+}
+
+// printSweep prints the mean of each metric for every combination.
+func printSweep(labels []string, results []*Result) {
+	mean := func(r *Result, phase, metric string) string {
+		for _, s := range r.Summary {
+			if s.Phase == phase && s.Metric == metric {
+				return time.Duration(s.Mean).String()
+			}
+		}
+		return "-"
+	}
+
+	fmt.Fprintln(stdout, "sweep results")
+	w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "parameters\tsize\tseed\titerate avg\titerate during copy avg\tcopy")
+	for i, r := range results {
+		fmt.Fprintf(w, "%s\t%d\t%v\t%s\t%s\t%s\n", labels[i], r.Size, r.Phases[0].Duration,
+			mean(r, phaseIterate, "iterate_avg"), mean(r, phaseCopy, "iterate_avg"), mean(r, phaseCopy, "copy_duration"))
+	}
+	w.Flush()
+}
@@ -0,0 +1,52 @@
+package copybench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// remoteTargets maps URL schemes to functions that open an object for
+// writing in that object store.
+var remoteTargets = map[string]func(ctx context.Context, u *url.URL) (io.WriteCloser, error){
+	"s3": openS3,
+	"gs": openGCS,
+}
+
+// aborter is implemented by targets that can discard a partial copy.
+type aborter interface {
+	Abort()
+}
+
+// openTarget opens a copy destination. Paths of the form scheme://bucket/key
+// are written to the matching object store; anything else is a local file.
+func openTarget(path string) (io.WriteCloser, error) {
+	if !strings.Contains(path, "://") {
+		return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	}
+
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	open, ok := remoteTargets[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported copy target: %s", path)
+	} else if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return nil, fmt.Errorf("copy target must be %s://BUCKET/KEY: %s", u.Scheme, path)
+	}
+	return open(context.Background(), u)
+}
+
+// abortTarget discards a partially written copy if the target supports it and
+// closes it otherwise.
+func abortTarget(w io.WriteCloser) {
+	if a, ok := w.(aborter); ok {
+		a.Abort()
+		return
+	}
+	w.Close()
+}
@@ -0,0 +1,166 @@
+package copybench
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// throughputInterval is the width of the buckets of throughputSampler.
+const throughputInterval = time.Second
+
+// Counters sampled by throughputSampler: the keys read by iteration passes and
+// the bytes written by copies since the process started.
+var keysRead, bytesCopied int64
+
+// throughputBucket is the read and copy throughput over one interval of a
+// run, and the size of the freelist at its end.
+type throughputBucket struct {
+	Time  time.Time `json:"time"`
+	Phase string    `json:"phase"`
+
+	// KeysPerSec is the rate of keys read by iteration passes completed
+	// during the interval and CopyBytesPerSec that of bytes written by
+	// copies.
+	KeysPerSec      float64 `json:"keys_per_sec"`
+	CopyBytesPerSec float64 `json:"copy_bytes_per_sec"`
+
+	// Freelist is the size of the engine's freelist, if it has one. Pages
+	// freed while a copy's read transaction is open stay pending until it
+	// ends.
+	Freelist *freelistStats `json:"freelist,omitempty"`
+}
+
+// throughputSampler buckets the read and copy throughput of a run every
+// throughputInterval, so that the moment and size of dips caused by a copy
+// can be seen, along with the pages it pins. A nil throughputSampler does
+// nothing.
+type throughputSampler struct {
+	mu       sync.Mutex
+	freelist freelister
+	phase    string
+	buckets  []throughputBucket
+	t        time.Time
+	keys     int64
+	bytes    int64
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// startThroughputSampler starts bucketing throughput, recording the size of
+// the freelist of fl if it is not nil.
+func startThroughputSampler(fl freelister) *throughputSampler {
+	s := &throughputSampler{
+		freelist: fl,
+		t:        time.Now(),
+		keys:     atomic.LoadInt64(&keysRead),
+		bytes:    atomic.LoadInt64(&bytesCopied),
+		done:     make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(throughputInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case t := <-ticker.C:
+				s.sample(t)
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// setPhase labels the following buckets with phase. The bucket in progress
+// is closed early so that no bucket spans two phases.
+func (s *throughputSampler) setPhase(phase string) {
+	if s == nil {
+		return
+	}
+	s.sample(time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.phase = phase
+}
+
+// watch records the freelist of fl from now on, after the engine is reopened.
+func (s *throughputSampler) watch(fl freelister) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.freelist = fl
+}
+
+// sample closes the bucket ending at t.
+func (s *throughputSampler) sample(t time.Time) {
+	keys, bytes := atomic.LoadInt64(&keysRead), atomic.LoadInt64(&bytesCopied)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var fl *freelistStats
+	if s.freelist != nil {
+		fl = s.freelist.Freelist()
+	}
+	if d := t.Sub(s.t).Seconds(); d > 0 && s.phase != "" {
+		s.buckets = append(s.buckets, throughputBucket{
+			Time:            s.t,
+			Phase:           s.phase,
+			KeysPerSec:      float64(keys-s.keys) / d,
+			CopyBytesPerSec: float64(bytes-s.bytes) / d,
+			Freelist:        fl,
+		})
+	}
+	s.t, s.keys, s.bytes = t, keys, bytes
+}
+
+// stop stops bucketing and returns every bucket.
+func (s *throughputSampler) stop() []throughputBucket {
+	if s == nil {
+		return nil
+	}
+	close(s.done)
+	s.wg.Wait()
+	s.sample(time.Now())
+	return s.buckets
+}
+
+// writeThroughputCSV writes buckets to the CSV file at path. It is a no-op if
+// path is empty.
+func writeThroughputCSV(path string, buckets []throughputBucket) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write([]string{"timestamp", "phase", "keys_per_sec", "copy_bytes_per_sec", "free_pages", "pending_pages", "free_alloc_bytes"})
+	for _, b := range buckets {
+		// The freelist columns are left empty for engines without one.
+		free, pending, alloc := "", "", ""
+		if fl := b.Freelist; fl != nil {
+			free, pending, alloc = strconv.Itoa(fl.FreePages), strconv.Itoa(fl.PendingPages), strconv.Itoa(fl.FreeAlloc)
+		}
+		w.Write([]string{
+			b.Time.UTC().Format(time.RFC3339Nano),
+			b.Phase,
+			strconv.FormatFloat(b.KeysPerSec, 'f', 0, 64),
+			strconv.FormatFloat(b.CopyBytesPerSec, 'f', 0, 64),
+			free, pending, alloc,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,213 @@
+package copybench
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// dashboardWindow is the number of recent passes used for latency percentiles.
+const dashboardWindow = 500
+
+// dashboardLines is the number of recent output lines shown on the dashboard.
+const dashboardLines = 10
+
+// dashboard is a live terminal view of a running benchmark. While it runs it
+// captures stdout and the log so they don't scroll the screen; captured
+// stdout is printed again once the dashboard is closed. All methods are
+// no-ops on a nil dashboard.
+type dashboard struct {
+	mu       sync.Mutex
+	out      io.Writer
+	title    string
+	size     int64
+	start    time.Time
+	phase    string
+	keys     int64
+	lastKeys int64
+	lastTime time.Time
+	rate     float64
+	window   []time.Duration
+	next     int
+	lines    []string
+	stdout   bytes.Buffer
+
+	closing chan struct{}
+	closed  chan struct{}
+}
+
+// isTerminal returns true if f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// startDashboard switches the terminal to the dashboard and begins redrawing
+// it periodically. It returns nil if stdout is not a terminal.
+func startDashboard(title string, size int64) *dashboard {
+	if !isTerminal(os.Stdout) {
+		log.Print("tui: stdout is not a terminal, using plain output")
+		return nil
+	}
+
+	d := &dashboard{
+		out:      os.Stdout,
+		title:    title,
+		size:     size,
+		start:    time.Now(),
+		lastTime: time.Now(),
+		closing:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	stdout = &dashboardWriter{d: d, replay: true}
+	log.SetOutput(&dashboardWriter{d: d})
+
+	// Switch to the alternate screen and hide the cursor.
+	fmt.Fprint(d.out, "\x1b[?1049h\x1b[?25l")
+	go d.run()
+	return d
+}
+
+// run redraws the dashboard until it is closed.
+func (d *dashboard) run() {
+	defer close(d.closed)
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		d.draw()
+		select {
+		case <-ticker.C:
+		case <-d.closing:
+			return
+		}
+	}
+}
+
+// Close restores the terminal and prints the output captured while the
+// dashboard was running.
+func (d *dashboard) Close() {
+	if d == nil {
+		return
+	}
+	close(d.closing)
+	<-d.closed
+
+	fmt.Fprint(d.out, "\x1b[?25h\x1b[?1049l")
+	stdout = os.Stdout
+	log.SetOutput(os.Stderr)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.out.Write(d.stdout.Bytes())
+}
+
+// setPhase changes the phase shown on the dashboard.
+func (d *dashboard) setPhase(phase string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.phase = phase
+	d.window, d.next = d.window[:0], 0
+}
+
+// observe records a single iteration pass.
+func (d *dashboard) observe(dur time.Duration, keys int) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.keys += int64(keys)
+	if len(d.window) < dashboardWindow {
+		d.window = append(d.window, dur)
+	} else {
+		d.window[d.next] = dur
+		d.next = (d.next + 1) % dashboardWindow
+	}
+}
+
+// draw renders a single frame of the dashboard.
+func (d *dashboard) draw() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if elapsed := now.Sub(d.lastTime).Seconds(); elapsed > 0 {
+		d.rate = float64(d.keys-d.lastKeys) / elapsed
+	}
+	d.lastKeys, d.lastTime = d.keys, now
+
+	var buf bytes.Buffer
+	buf.WriteString("\x1b[H")
+	line := func(format string, a ...interface{}) {
+		fmt.Fprintf(&buf, format, a...)
+		buf.WriteString("\x1b[K\n")
+	}
+
+	line("copy-bench %s    elapsed %v", d.title, now.Sub(d.start).Truncate(100*time.Millisecond))
+	line("")
+	line("phase:     %s", d.phase)
+	line("keys/sec:  %.0f", d.rate)
+	if len(d.window) > 0 {
+		sorted := make([]time.Duration, len(d.window))
+		copy(sorted, d.window)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		pct := func(p float64) time.Duration { return sorted[int(p*float64(len(sorted)-1))] }
+		line("latency:   p50 %v  p90 %v  p99 %v  max %v  (last %d passes)",
+			pct(0.5), pct(0.9), pct(0.99), sorted[len(sorted)-1], len(sorted))
+	} else {
+		line("latency:   -")
+	}
+	if d.phase == phaseCopy && d.size > 0 {
+		n := atomic.LoadInt64(&copyProgress)
+		frac := float64(n) / float64(d.size)
+		if frac > 1 {
+			frac = 1
+		}
+		bar := strings.Repeat("#", int(frac*40)) + strings.Repeat(".", 40-int(frac*40))
+		line("copy:      [%s] %5.1f%%  (%d / %d bytes)", bar, frac*100, n, d.size)
+	} else {
+		line("copy:      -")
+	}
+	line("")
+	line("recent output:")
+	for _, l := range d.lines {
+		line("  %s", l)
+	}
+	buf.WriteString("\x1b[J")
+	d.out.Write(buf.Bytes())
+}
+
+// dashboardWriter captures output written while the dashboard is running.
+type dashboardWriter struct {
+	d      *dashboard
+	replay bool // keep the output to print when the dashboard closes
+}
+
+// Write adds p to the dashboard's recent output lines.
+func (w *dashboardWriter) Write(p []byte) (int, error) {
+	w.d.mu.Lock()
+	defer w.d.mu.Unlock()
+	if w.replay {
+		w.d.stdout.Write(p)
+	}
+	for _, l := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if l = strings.TrimSpace(l); l == "" {
+			continue
+		}
+		w.d.lines = append(w.d.lines, l)
+	}
+	if n := len(w.d.lines); n > dashboardLines {
+		w.d.lines = w.d.lines[n-dashboardLines:]
+	}
+	return len(p), nil
+}
@@ -0,0 +1,133 @@
+package copybench
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sync/atomic"
+)
+
+// Value size distributions accepted by value_distribution.
+const (
+	valueFixed     = "fixed"     // every value is value_size bytes
+	valueUniform   = "uniform"   // uniform in [value_size_min, value_size_max]
+	valueLogNormal = "lognormal" // log-normal with median value_size
+	valueBimodal   = "bimodal"   // value_size, or value_size_max for value_large_pct of values
+)
+
+// valueSize returns the size of the next value written, using r.
+func (c *Config) valueSize(r *rand.Rand) int {
+	switch c.ValueDistribution {
+	case valueUniform:
+		return c.ValueSizeMin + r.Intn(c.ValueSizeMax-c.ValueSizeMin+1)
+	case valueLogNormal:
+		n := int(math.Exp(math.Log(float64(c.ValueSize)) + c.ValueSizeSigma*r.NormFloat64()))
+		if n < c.ValueSizeMin {
+			n = c.ValueSizeMin
+		} else if c.ValueSizeMax > 0 && n > c.ValueSizeMax {
+			n = c.ValueSizeMax
+		}
+		return n
+	case valueBimodal:
+		if r.Float64() < c.ValueLargePct {
+			return c.ValueSizeMax
+		}
+		return c.ValueSize
+	default:
+		return c.ValueSize
+	}
+}
+
+// fillValue writes the seeded content of the value of key k to v. Values are
+// left zeroed unless checksum_values is set, in which case v is filled with
+// the FNV-64a hash of k, repeated.
+func (c *Config) fillValue(k, v []byte) {
+	if !c.ChecksumValues {
+		return
+	}
+	var sum [8]byte
+	binary.BigEndian.PutUint64(sum[:], keyChecksum(k))
+	for i := 0; i < len(v); i += len(sum) {
+		copy(v[i:], sum[:])
+	}
+}
+
+// rewriteValue writes new content for the value of key k to v: random bytes
+// from r, or with checksum_values the same content it was seeded with, so
+// that rewritten values still pass their checksum.
+func (c *Config) rewriteValue(k, v []byte, r *rand.Rand) {
+	if c.ChecksumValues {
+		c.fillValue(k, v)
+		return
+	}
+	r.Read(v)
+}
+
+// checkValue reports whether v is a valid value for key k. Every value is
+// valid unless checksum_values is set; otherwise values that fail their
+// checksum are counted in corruptValues.
+func (c *Config) checkValue(k, v []byte) bool {
+	if !c.ChecksumValues {
+		return true
+	}
+	want := make([]byte, len(v))
+	c.fillValue(k, want)
+	if bytes.Equal(v, want) {
+		return true
+	}
+	atomic.AddInt64(&corruptValues, 1)
+	return false
+}
+
+// corruptValues counts the values read that failed their checksum.
+var corruptValues int64
+
+// keyChecksum returns the FNV-64a hash of k.
+func keyChecksum(k []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(k)
+	return h.Sum64()
+}
+
+// validValueSize reports whether n is a value size the scenario can produce.
+func (c *Config) validValueSize(n int) bool {
+	switch c.ValueDistribution {
+	case valueUniform:
+		return n >= c.ValueSizeMin && n <= c.ValueSizeMax
+	case valueLogNormal:
+		return n >= c.ValueSizeMin && (c.ValueSizeMax == 0 || n <= c.ValueSizeMax)
+	case valueBimodal:
+		return n == c.ValueSize || n == c.ValueSizeMax
+	default:
+		return n == c.ValueSize
+	}
+}
+
+// validateValues returns an error if the value size distribution is invalid.
+func (c *Config) validateValues() error {
+	switch c.ValueDistribution {
+	case valueFixed:
+	case valueUniform:
+		if c.ValueSizeMin < 0 || c.ValueSizeMax < c.ValueSizeMin {
+			return fmt.Errorf("uniform values need 0 <= value_size_min <= value_size_max")
+		}
+	case valueLogNormal:
+		if c.ValueSize <= 0 || c.ValueSizeSigma <= 0 {
+			return fmt.Errorf("lognormal values need a positive value_size and value_size_sigma")
+		} else if c.ValueSizeMin < 0 || (c.ValueSizeMax > 0 && c.ValueSizeMax < c.ValueSizeMin) {
+			return fmt.Errorf("lognormal values need 0 <= value_size_min <= value_size_max")
+		}
+	case valueBimodal:
+		if c.ValueSizeMax <= c.ValueSize {
+			return fmt.Errorf("bimodal values need value_size_max larger than value_size")
+		} else if c.ValueLargePct < 0 || c.ValueLargePct > 1 {
+			return fmt.Errorf("value_large_pct must be in [0, 1]")
+		}
+	default:
+		return fmt.Errorf("unknown value distribution: %s", c.ValueDistribution)
+	}
+	return nil
+}
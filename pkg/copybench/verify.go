@@ -0,0 +1,92 @@
+package copybench
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// verifyMain checks the consistency of the database and its dataset.
+func verifyMain(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	cfg := defaultConfig()
+	path, err := parseFlags(fs, args, cfg)
+	if err != nil {
+		return err
+	}
+	if err := requireBolt(cfg, "verify"); err != nil {
+		return err
+	}
+
+	db, err := open(path, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := verify(db, cfg); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "ok")
+	return nil
+}
+
+// verify runs bolt's consistency check and ensures the buckets hold exactly
+// the sequential keys and values written by seed, checking the values'
+// checksums if they have them.
+func verify(db *bolt.DB, cfg *Config) error {
+	return db.View(func(tx *bolt.Tx) error {
+		// Drain the channel so the checker goroutine can finish.
+		var checkErr error
+		for err := range tx.Check() {
+			if checkErr == nil {
+				checkErr = err
+			}
+		}
+		if checkErr != nil {
+			return fmt.Errorf("check: %s", checkErr)
+		}
+
+		buckets, err := cfg.buckets(tx)
+		if err != nil {
+			return err
+		}
+
+		// Key i is held by bucket i%len(buckets), or by its leaf with index
+		// (i/len(buckets))%leaves if nested, in order.
+		var count int
+		leaves := cfg.leaves()
+		for i, top := range buckets {
+			for l := 0; l < leaves; l++ {
+				b := top
+				if cfg.NestDepth > 0 {
+					if b = cfg.leaf(top, l); b == nil {
+						return fmt.Errorf("nested bucket %d not found in %s", l, cfg.bucketKey(i))
+					}
+				}
+
+				want := i + l*len(buckets)
+				c := b.Cursor()
+				for k, v := c.First(); k != nil; k, v = c.Next() {
+					if len(k) != cfg.KeySize {
+						return fmt.Errorf("invalid key size at %d: %d != %d", want, len(k), cfg.KeySize)
+					} else if n := cfg.decodeKey(k); n != want {
+						return fmt.Errorf("unexpected key: %d != %d", n, want)
+					} else if !cfg.validValueSize(len(v)) {
+						return fmt.Errorf("invalid value size for key %d: %d (%s)", want, len(v), cfg.ValueDistribution)
+					} else if !cfg.checkValue(k, v) {
+						return fmt.Errorf("corrupt value for key %d", want)
+					}
+					want += len(buckets) * leaves
+					count++
+				}
+			}
+		}
+
+		if count != cfg.ItemCount {
+			return fmt.Errorf("invalid item count: %d != %d", count, cfg.ItemCount)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,223 @@
+package copybench
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// webInterval is how often the web dashboard takes a sample.
+const webInterval = time.Second
+
+// webPoints is the number of recent samples the web dashboard keeps.
+const webPoints = 600
+
+// webDashboard serves a page with live charts of the running bench: pass
+// latency, keys read per second and the progress of the copy in progress.
+// All methods are no-ops on a nil dashboard.
+type webDashboard struct {
+	mu       sync.Mutex
+	title    string
+	size     int64
+	start    time.Time
+	phase    string
+	passes   []time.Duration
+	lastKeys int64
+	points   []webPoint
+
+	closing chan struct{}
+}
+
+// webPoint is a sample of the web dashboard. Times are in seconds since the
+// start of the run and latencies in milliseconds, ready to be plotted.
+type webPoint struct {
+	Elapsed    float64 `json:"t"`
+	Phase      string  `json:"phase"`
+	KeysPerSec float64 `json:"keys_per_sec"`
+	P50        float64 `json:"p50,omitempty"`
+	P99        float64 `json:"p99,omitempty"`
+	CopyPct    float64 `json:"copy_pct"`
+}
+
+// startWebDashboard listens on addr, serves the dashboard in the background
+// and starts sampling. It returns nil if addr is empty.
+func startWebDashboard(addr, title string, size int64) (*webDashboard, error) {
+	if addr == "" {
+		return nil, nil
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("web: %s", err)
+	}
+	d := &webDashboard{title: title, size: size, start: time.Now(), lastKeys: atomic.LoadInt64(&keysRead), closing: make(chan struct{})}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", d.serveIndex)
+	mux.HandleFunc("/data", d.serveData)
+	log.Printf("web: dashboard on http://%s/", lis.Addr())
+	go func() {
+		if err := http.Serve(lis, mux); err != nil {
+			log.Printf("web: %s", err)
+		}
+	}()
+	go d.run()
+	return d, nil
+}
+
+// run takes a sample every webInterval until the dashboard is closed.
+func (d *webDashboard) run() {
+	ticker := time.NewTicker(webInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.closing:
+			return
+		case <-ticker.C:
+			d.sample()
+		}
+	}
+}
+
+// Close stops sampling. The page keeps serving the samples taken.
+func (d *webDashboard) Close() {
+	if d == nil {
+		return
+	}
+	close(d.closing)
+}
+
+// setPhase labels the following samples with phase.
+func (d *webDashboard) setPhase(phase string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.phase = phase
+}
+
+// observe records a single iteration pass.
+func (d *webDashboard) observe(dur time.Duration) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.passes = append(d.passes, dur)
+}
+
+// sample adds a point covering the passes since the last one.
+func (d *webDashboard) sample() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	keys := atomic.LoadInt64(&keysRead)
+	p := webPoint{
+		Elapsed:    time.Since(d.start).Seconds(),
+		Phase:      d.phase,
+		KeysPerSec: float64(keys-d.lastKeys) / webInterval.Seconds(),
+	}
+	d.lastKeys = keys
+	if n := len(d.passes); n > 0 {
+		sort.Slice(d.passes, func(i, j int) bool { return d.passes[i] < d.passes[j] })
+		ms := func(q float64) float64 { return d.passes[int(q*float64(n-1))].Seconds() * 1000 }
+		p.P50, p.P99 = ms(0.5), ms(0.99)
+		d.passes = d.passes[:0]
+	}
+	if d.size > 0 {
+		p.CopyPct = 100 * float64(atomic.LoadInt64(&copyProgress)) / float64(d.size)
+	}
+	if len(d.points) == webPoints {
+		d.points = append(d.points[:0], d.points[1:]...)
+	}
+	d.points = append(d.points, p)
+}
+
+// serveData replies with the dashboard's samples as JSON.
+func (d *webDashboard) serveData(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	b, err := json.Marshal(map[string]interface{}{"title": d.title, "phase": d.phase, "points": d.points})
+	d.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// serveIndex serves the dashboard page, which polls /data.
+func (d *webDashboard) serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, webPage)
+}
+
+// webPage draws the charts as SVG polylines with no external scripts, so the
+// dashboard works offline.
+const webPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>copy-bench</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+svg { border: 1px solid #ddd; background: #fff; }
+.bar { width: 760px; height: 20px; border: 1px solid #ddd; }
+.bar div { height: 100%; background: #2ca02c; width: 0; }
+</style>
+</head>
+<body>
+<h1 id="title">copy-bench</h1>
+<p>Phase: <b id="phase">-</b></p>
+<h2>Pass latency (ms)</h2>
+<svg id="latency" width="760" height="240"></svg>
+<h2>Keys read per second</h2>
+<svg id="keys" width="760" height="240"></svg>
+<h2>Progress of the current or last copy</h2>
+<div class="bar"><div id="copy"></div></div>
+<p id="copypct"></p>
+<script>
+var colors = ["#1f77b4", "#d62728"];
+function draw(id, points, fields) {
+	var svg = document.getElementById(id), w = 760, h = 240, pad = 40;
+	var t0 = points.length ? points[0].t : 0, t1 = points.length ? points[points.length - 1].t : 1;
+	var max = 0;
+	points.forEach(function(p) { fields.forEach(function(f) { max = Math.max(max, p[f] || 0); }); });
+	max = max || 1;
+	var x = function(t) { return pad + (t - t0) / Math.max(t1 - t0, 1) * (w - 2 * pad); };
+	var y = function(v) { return h - pad - v / max * (h - 2 * pad); };
+	var out = '<text x="' + pad + '" y="20" font-size="12">max ' + max.toFixed(2) + '</text>';
+	fields.forEach(function(f, i) {
+		var pts = points.filter(function(p) { return p[f] !== undefined; })
+			.map(function(p) { return x(p.t).toFixed(1) + "," + y(p[f]).toFixed(1); }).join(" ");
+		out += '<polyline fill="none" stroke="' + colors[i] + '" stroke-width="1.5" points="' + pts + '"/>';
+		out += '<text x="' + (w - pad - 60) + '" y="' + (20 + 14 * i) + '" font-size="12" fill="' + colors[i] + '">' + f + '</text>';
+	});
+	svg.innerHTML = out;
+}
+function refresh() {
+	fetch("data").then(function(r) { return r.json(); }).then(function(d) {
+		var points = d.points || [];
+		document.getElementById("title").textContent = d.title;
+		document.getElementById("phase").textContent = d.phase || "-";
+		draw("latency", points, ["p50", "p99"]);
+		draw("keys", points, ["keys_per_sec"]);
+		var pct = points.length ? points[points.length - 1].copy_pct : 0;
+		document.getElementById("copy").style.width = Math.min(pct, 100) + "%";
+		document.getElementById("copypct").textContent = pct > 0 ? pct.toFixed(1) + "%" : "no copy yet";
+	});
+}
+refresh();
+setInterval(refresh, 1000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,457 @@
+package copybench
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Roles a worker plays in a coordinated benchmark.
+const (
+	roleReader = "reader" // run the phase's workload on a read-only handle
+	roleWriter = "writer" // run the scenario's mix, or only writes without one
+	roleBackup = "backup" // copy the database from a source worker
+)
+
+// validRole reports whether name is a worker role.
+func validRole(name string) bool {
+	return name == roleReader || name == roleWriter || name == roleBackup
+}
+
+// Messages of the worker API. They are encoded as JSON by jsonCodec, so the
+// API needs no generated code, except for snapshot chunks, which are sent
+// as raw bytes.
+type loadRequest struct {
+	Config *Config `json:"config"`
+	Role   string  `json:"role"`
+
+	// Source is the address of the worker a backup copies from.
+	Source string `json:"source,omitempty"`
+}
+
+type loadReply struct {
+	Size int64        `json:"size"`
+	Env  *environment `json:"env"`
+}
+
+type startRequest struct {
+	Phase string `json:"phase"`
+}
+
+type startReply struct{}
+
+type stopRequest struct{}
+
+type metricsRequest struct {
+	Interval time.Duration `json:"interval"`
+}
+
+type snapshotRequest struct{}
+
+type chunk struct {
+	Data []byte
+}
+
+// workerMetric is a sample of a worker's cumulative progress, streamed by
+// the Metrics method.
+type workerMetric struct {
+	Time   time.Time `json:"time"`
+	Keys   int64     `json:"keys"`
+	Writes int64     `json:"writes"`
+	Bytes  int64     `json:"bytes"`
+}
+
+// workerStats holds what a worker measured during a phase, returned by the
+// Stop method.
+type workerStats struct {
+	Addr    string        `json:"addr"`
+	Role    string        `json:"role"`
+	Env     *environment  `json:"env,omitempty"`
+	Iterate *iterateStats `json:"iterate,omitempty"`
+	Mix     *mixStats     `json:"mix,omitempty"`
+	Copies  []*copyStats  `json:"copies,omitempty"`
+}
+
+// jsonCodec encodes the worker API's messages.
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	if c, ok := v.(*chunk); ok {
+		// The caller's buffer is reused once SendMsg returns.
+		return append([]byte(nil), c.Data...), nil
+	}
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	if c, ok := v.(*chunk); ok {
+		c.Data = append(c.Data[:0], data...)
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// workerService describes the worker API. Load sets the scenario and role,
+// Start starts the role for a phase, Stop stops it and returns its stats,
+// Metrics streams progress until cancelled, and Snapshot streams a copy of
+// the worker's database.
+var workerService = grpc.ServiceDesc{
+	ServiceName: "copybench.Worker",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Load", Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+			var req loadRequest
+			if err := dec(&req); err != nil {
+				return nil, err
+			}
+			return srv.(*worker).load(&req)
+		}},
+		{MethodName: "Start", Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+			var req startRequest
+			if err := dec(&req); err != nil {
+				return nil, err
+			}
+			return srv.(*worker).start(&req)
+		}},
+		{MethodName: "Stop", Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+			var req stopRequest
+			if err := dec(&req); err != nil {
+				return nil, err
+			}
+			return srv.(*worker).stop()
+		}},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Metrics", ServerStreams: true, Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			var req metricsRequest
+			if err := stream.RecvMsg(&req); err != nil {
+				return err
+			}
+			return srv.(*worker).metrics(&req, stream)
+		}},
+		{StreamName: "Snapshot", ServerStreams: true, Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			var req snapshotRequest
+			if err := stream.RecvMsg(&req); err != nil {
+				return err
+			}
+			return srv.(*worker).snapshot(stream)
+		}},
+	},
+}
+
+// Full names of the worker API's methods.
+const (
+	methodLoad     = "/copybench.Worker/Load"
+	methodStart    = "/copybench.Worker/Start"
+	methodStop     = "/copybench.Worker/Stop"
+	methodMetrics  = "/copybench.Worker/Metrics"
+	methodSnapshot = "/copybench.Worker/Snapshot"
+)
+
+// dialWorker connects to the worker API at addr.
+func dialWorker(addr string) (*grpc.ClientConn, error) {
+	return grpc.NewClient(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(jsonCodec{})))
+}
+
+// openStream starts a server-streaming call of method on conn with req.
+func openStream(ctx context.Context, conn *grpc.ClientConn, method string, req interface{}) (grpc.ClientStream, error) {
+	desc := &grpc.StreamDesc{ServerStreams: true}
+	stream, err := conn.NewStream(ctx, desc, method)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return nil, err
+	}
+	return stream, stream.CloseSend()
+}
+
+// workerMain serves the worker API, playing whichever role a coordinator
+// loads. PATH is the database of readers and writers, and the file backups
+// copy to.
+func workerMain(args []string) error {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:7070", "serve the worker API on `ADDR`")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	lis, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	w := &worker{path: fs.Arg(0), addr: lis.Addr().String()}
+	defer w.close()
+	srv := grpc.NewServer(grpc.ForceServerCodec(jsonCodec{}))
+	srv.RegisterService(&workerService, w)
+	log.Printf("worker: serving on %s", w.addr)
+	return srv.Serve(lis)
+}
+
+// worker implements the worker API.
+type worker struct {
+	path string
+	addr string
+
+	// mu is held to read while a snapshot streams, so that several backups
+	// can copy at once, but the database isn't closed under them.
+	mu     sync.RWMutex
+	cfg    *Config
+	role   string
+	eng    engine
+	b      *bench
+	source *grpc.ClientConn
+
+	// halt is set while a phase runs, and stops it. stopping is set while
+	// halt runs, without holding mu, so that the phase's copies can still
+	// snapshot the worker.
+	halt     func() (*workerStats, error)
+	stopping bool
+}
+
+// close releases the database and source connection of the loaded role.
+func (w *worker) close() {
+	if w.eng != nil {
+		w.b.close()
+		w.eng, w.b = nil, nil
+	}
+	if w.source != nil {
+		w.source.Close()
+		w.source = nil
+	}
+}
+
+// load prepares the worker to play req's role in req's scenario. Readers
+// open the database read-only, as with separate_reader, so that several can
+// share it, while a writer needs the file lock to itself.
+func (w *worker) load(req *loadRequest) (*loadReply, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.halt != nil {
+		return nil, fmt.Errorf("a phase is running")
+	} else if !validRole(req.Role) {
+		return nil, fmt.Errorf("unknown role: %s", req.Role)
+	} else if req.Config == nil {
+		return nil, fmt.Errorf("no scenario")
+	}
+	w.close()
+
+	cfg := req.Config
+	cfg.SeparateReader, cfg.ReaderProcess = req.Role == roleReader, false
+	if req.Role != roleWriter {
+		// The scenario's writes are the writer's, and would fail the
+		// validation of a read-only reader.
+		cfg.Mix, cfg.DeleteRate, cfg.UpdateRate = "", 0, 0
+	} else if cfg.Mix == "" {
+		cfg.Mix = "0:1"
+	}
+	if err := cfg.prepare(); err != nil {
+		return nil, err
+	} else if err := requireBolt(cfg, "worker"); err != nil {
+		return nil, err
+	}
+	w.cfg, w.role = cfg, req.Role
+
+	if req.Role == roleBackup {
+		if req.Source == "" {
+			return nil, fmt.Errorf("a backup needs a source")
+		}
+		conn, err := dialWorker(req.Source)
+		if err != nil {
+			return nil, err
+		}
+		w.source = conn
+		return &loadReply{Env: captureEnvironment(w.path)}, nil
+	}
+
+	eng, err := openEngine(w.path, false, cfg)
+	if err != nil {
+		return nil, err
+	}
+	w.eng, w.b = eng, newBench(eng, cfg)
+	w.b.path = w.path
+	if err := cfg.checkBuckets(w.b.db); err != nil {
+		w.close()
+		return nil, err
+	}
+	size, err := eng.Size()
+	if err != nil {
+		w.close()
+		return nil, err
+	}
+	log.Printf("worker: loaded %s (%d bytes)", req.Role, size)
+	return &loadReply{Size: size, Env: captureEnvironment(w.path)}, nil
+}
+
+// start starts the loaded role for the named phase.
+func (w *worker) start(req *startRequest) (*startReply, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.role == "" {
+		return nil, fmt.Errorf("no scenario loaded")
+	} else if w.halt != nil {
+		return nil, fmt.Errorf("a phase is running")
+	}
+	stats := &workerStats{Addr: w.addr, Role: w.role}
+
+	switch w.role {
+	case roleReader:
+		stop, err := w.b.startIterate(req.Phase)
+		if err != nil {
+			return nil, err
+		}
+		w.halt = func() (*workerStats, error) {
+			it, err := stop()
+			stats.Iterate = it
+			return stats, err
+		}
+
+	case roleWriter:
+		stop := w.b.startMix()
+		w.halt = func() (*workerStats, error) {
+			stats.Mix = stop()
+			return stats, nil
+		}
+
+	case roleBackup:
+		done := make(chan error, 1)
+		go func() {
+			for i := 0; i < w.cfg.CopyCount; i++ {
+				cs, err := w.backup()
+				if err != nil {
+					done <- err
+					return
+				}
+				cs.print()
+				stats.Copies = append(stats.Copies, cs)
+			}
+			done <- nil
+		}()
+		w.halt = func() (*workerStats, error) {
+			return stats, <-done
+		}
+	}
+	log.Printf("worker: started %s during %s", w.role, req.Phase)
+	return &startReply{}, nil
+}
+
+// stop stops the running phase and returns its stats. A backup's copies are
+// left to finish.
+func (w *worker) stop() (*workerStats, error) {
+	w.mu.Lock()
+	halt := w.halt
+	if halt == nil {
+		w.mu.Unlock()
+		return nil, fmt.Errorf("no phase running")
+	} else if w.stopping {
+		w.mu.Unlock()
+		return nil, fmt.Errorf("the phase is already stopping")
+	}
+	w.stopping = true
+	w.mu.Unlock()
+
+	stats, err := halt()
+	w.mu.Lock()
+	w.halt, w.stopping = nil, false
+	w.mu.Unlock()
+	return stats, err
+}
+
+// metrics streams the worker's cumulative keys read, writes and bytes copied
+// every interval until the caller cancels the stream.
+func (w *worker) metrics(req *metricsRequest, stream grpc.ServerStream) error {
+	interval := req.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case t := <-ticker.C:
+			m := &workerMetric{
+				Time:   t,
+				Keys:   atomic.LoadInt64(&keysRead),
+				Writes: atomic.LoadInt64(&mixWrites),
+				Bytes:  atomic.LoadInt64(&bytesCopied),
+			}
+			if err := stream.SendMsg(m); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// snapshot streams a consistent copy of the worker's database.
+func (w *worker) snapshot(stream grpc.ServerStream) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.eng == nil {
+		return fmt.Errorf("no database open")
+	}
+	_, err := w.eng.Snapshot(&chunkWriter{stream: stream})
+	return err
+}
+
+// chunkWriter sends everything written to it as snapshot chunks.
+type chunkWriter struct {
+	stream grpc.ServerStream
+}
+
+func (cw *chunkWriter) Write(p []byte) (int, error) {
+	if err := cw.stream.SendMsg(&chunk{Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// backup copies the source worker's database to the worker's path.
+func (w *worker) backup() (*copyStats, error) {
+	f, err := os.Create(w.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	mw := &meteredWriter{w: f}
+	atomic.StoreInt64(&copyProgress, 0)
+
+	t := time.Now()
+	stream, err := openStream(context.Background(), w.source, methodSnapshot, &snapshotRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("backup: %s", err)
+	}
+	var c chunk
+	for {
+		if err := stream.RecvMsg(&c); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("backup: %s", err)
+		}
+		if _, err := mw.Write(c.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+	return &copyStats{Target: w.path, Duration: time.Since(t), Bytes: mw.n}, f.Close()
+}
@@ -0,0 +1,254 @@
+package copybench
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/boltdb/bolt"
+)
+
+// Workload is an access pattern run by the readers of the bench phases. Every
+// reader gets its own Workload for each phase, which is set up before the
+// reader's first pass and torn down after its last.
+type Workload interface {
+	// Setup prepares the workload to read from env.
+	Setup(env *WorkloadEnv) error
+
+	// Step makes a single pass and returns the number of keys it read.
+	// Errors are logged and the reader carries on with the next pass.
+	Step() (int, error)
+
+	// Teardown releases anything acquired by Setup.
+	Teardown() error
+}
+
+// WorkloadEnv is what a workload runs against.
+type WorkloadEnv struct {
+	// Config is the scenario.
+	Config *Config
+
+	// DB is the bolt database the reader reads, or nil with other engines,
+	// which only run the iterate workload.
+	DB *bolt.DB
+
+	// Reader numbers the reader, from zero.
+	Reader int
+
+	// Rand is the reader's random number stream, seeded from the scenario's
+	// seed.
+	Rand *rand.Rand
+
+	eng   engine
+	keys  keyChooser
+	hists *iterateHists
+	ycsb  map[string]*ycsb
+}
+
+// keyTimer returns a function recording the time taken to reach each key of a
+// pass starting now, or nil if key latencies aren't recorded.
+func (env *WorkloadEnv) keyTimer() func() {
+	if env.hists.key == nil {
+		return nil
+	}
+	last := time.Now()
+	return func() {
+		now := time.Now()
+		recordLatency(env.hists.key, now.Sub(last))
+		last = now
+	}
+}
+
+// workloads maps the names of the reader workloads to their constructors.
+var workloads = map[string]func() Workload{
+	workloadIterate: func() Workload { return &scanWorkload{} },
+	workloadReverse: func() Workload { return &scanWorkload{reverse: true} },
+	workloadGet:     func() Workload { return &getWorkload{} },
+	workloadPrefix:  func() Workload { return &prefixWorkload{} },
+	workloadRange:   func() Workload { return &rangeWorkload{} },
+}
+
+// RegisterWorkload makes a workload selectable under name with -workload and
+// the workload and phase_workloads keys. It is meant to be called from init
+// and panics if name is already taken.
+func RegisterWorkload(name string, fn func() Workload) {
+	if _, ok := workloads[name]; ok {
+		panic(fmt.Sprintf("workload %s registered twice", name))
+	}
+	workloads[name] = fn
+}
+
+// workloadNames returns the names of the registered workloads, sorted.
+func workloadNames() string {
+	var names []string
+	for name := range workloads {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// scanWorkload is the iterate workload, or the reverse workload if reverse is
+// set. Iterate goes through the engine, so that it runs on every engine.
+type scanWorkload struct {
+	env     *WorkloadEnv
+	reverse bool
+	bound   []byte
+}
+
+func (w *scanWorkload) Setup(env *WorkloadEnv) error {
+	w.env = env
+	if w.reverse {
+		w.bound = env.Config.iterateBound(workloadReverse)
+	} else {
+		w.bound = env.Config.iterateBound(workloadIterate)
+	}
+	return nil
+}
+
+func (w *scanWorkload) Step() (int, error) {
+	onKey := w.env.keyTimer()
+	if !w.reverse {
+		return w.env.eng.Scan(w.bound, onKey)
+	}
+	var count int
+	err := w.env.DB.View(func(tx *bolt.Tx) error {
+		count = scan(tx, w.env.Config, w.bound, true, onKey)
+		return nil
+	})
+	return count, err
+}
+
+func (w *scanWorkload) Teardown() error { return nil }
+
+// getWorkload is the get workload.
+type getWorkload struct{ env *WorkloadEnv }
+
+func (w *getWorkload) Setup(env *WorkloadEnv) error { w.env = env; return nil }
+
+func (w *getWorkload) Step() (int, error) {
+	var count int
+	err := w.env.DB.View(func(tx *bolt.Tx) error {
+		count = get(tx, w.env.Config, w.env.keys, w.env.Rand, w.env.hists.get)
+		return nil
+	})
+	return count, err
+}
+
+func (w *getWorkload) Teardown() error { return nil }
+
+// prefixWorkload is the prefix workload.
+type prefixWorkload struct{ env *WorkloadEnv }
+
+func (w *prefixWorkload) Setup(env *WorkloadEnv) error { w.env = env; return nil }
+
+func (w *prefixWorkload) Step() (int, error) {
+	var count int
+	err := w.env.DB.View(func(tx *bolt.Tx) error {
+		count = prefixScan(tx, w.env.Config, w.env.keys, w.env.Rand, w.env.hists.seek)
+		return nil
+	})
+	return count, err
+}
+
+func (w *prefixWorkload) Teardown() error { return nil }
+
+// rangeWorkload is the range workload.
+type rangeWorkload struct{ env *WorkloadEnv }
+
+func (w *rangeWorkload) Setup(env *WorkloadEnv) error { w.env = env; return nil }
+
+func (w *rangeWorkload) Step() (int, error) {
+	var count int
+	err := w.env.DB.View(func(tx *bolt.Tx) error {
+		count = rangeScan(tx, w.env.Config, w.env.keys, w.env.Rand, w.env.hists.seek)
+		return nil
+	})
+	return count, err
+}
+
+func (w *rangeWorkload) Teardown() error { return nil }
+
+// scan reads every key below bound in each of the dataset's buckets with a
+// cursor, descending into nested buckets, and returns the number of keys read.
+// If reverse is set, it reads every key at or above bound from the last key
+// backwards instead. If fn is set, it is called after each key is read.
+func scan(tx *bolt.Tx, cfg *Config, bound []byte, reverse bool, fn func()) int {
+	var count int
+	for i := 0; i < cfg.Buckets; i++ {
+		count += scanBucket(cfg, tx.Bucket(cfg.bucketKey(i)), bound, reverse, fn)
+	}
+	return count
+}
+
+// scanBucket reads the keys of b and its nested buckets on the scanned side of
+// bound, checking their values.
+func scanBucket(cfg *Config, b *bolt.Bucket, bound []byte, reverse bool, fn func()) int {
+	var count int
+	c := b.Cursor()
+	first, next := c.First, c.Next
+	if reverse {
+		first, next = c.Last, c.Prev
+	}
+	for k, v := first(); k != nil; k, v = next() {
+		if v == nil {
+			count += scanBucket(cfg, b.Bucket(k), bound, reverse, fn)
+			continue
+		}
+		if cmp := bytes.Compare(k, bound); (!reverse && cmp >= 0) || (reverse && cmp < 0) {
+			break
+		}
+		cfg.checkValue(k, v)
+		count++
+		if fn != nil {
+			fn()
+		}
+	}
+	return count
+}
+
+// get looks up cfg.GetCount keys picked by keys using r and records the
+// latency of each lookup in hist. It returns the number of keys found.
+func get(tx *bolt.Tx, cfg *Config, keys keyChooser, r *rand.Rand, hist *hdrhistogram.Histogram) int {
+	var count int
+	k := make([]byte, cfg.KeySize)
+	for i := 0; i < cfg.GetCount; i++ {
+		n := keys.next(r)
+		cfg.encodeKey(k, n)
+		b := cfg.bucket(tx, n)
+		t := time.Now()
+		v := b.Get(k)
+		recordLatency(hist, time.Since(t))
+		if v != nil {
+			cfg.checkValue(k, v)
+			count++
+		}
+	}
+	return count
+}
+
+// rangeScan performs cfg.GetCount scans of cfg.RangeLength keys, each starting
+// at a key picked by keys using r. The time taken to seek to the start of each
+// scan is recorded in seekHist. It returns the number of keys read.
+func rangeScan(tx *bolt.Tx, cfg *Config, keys keyChooser, r *rand.Rand, seekHist *hdrhistogram.Histogram) int {
+	var count int
+	k := make([]byte, cfg.KeySize)
+	for i := 0; i < cfg.GetCount; i++ {
+		n := keys.next(r)
+		cfg.encodeKey(k, n)
+		c := cfg.bucket(tx, n).Cursor()
+
+		t := time.Now()
+		key, _ := c.Seek(k)
+		recordLatency(seekHist, time.Since(t))
+		for j := 0; key != nil && j < cfg.RangeLength; j++ {
+			count++
+			key, _ = c.Next()
+		}
+	}
+	return count
+}
@@ -0,0 +1,170 @@
+package copybench
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Key orders accepted by delete_order.
+const (
+	orderRandom     = "random"     // keys picked by the key distribution
+	orderSequential = "sequential" // keys in ascending order, continuing across phases
+)
+
+// writerTxRate is the most write transactions per second a background writer
+// commits. Higher key rates are reached by writing several keys per
+// transaction.
+const writerTxRate = 100
+
+// writeStats summarizes a background writer run alongside a phase.
+type writeStats struct {
+	Keys    int             `json:"keys"`
+	Txs     int             `json:"txs"`
+	Latency *latencySummary `json:"latency,omitempty"`
+
+	// CorrectedLatency holds percentiles of transaction latency measured
+	// from the time each transaction was scheduled to start rather than
+	// when it did, correcting for coordinated omission: a transaction held
+	// up behind a stalled one counts the time it spent waiting.
+	CorrectedLatency *latencySummary `json:"corrected_latency,omitempty"`
+
+	// FreePages and PendingPages are the sizes of the freelist at the end of
+	// the phase.
+	FreePages    int `json:"free_pages"`
+	PendingPages int `json:"pending_pages"`
+}
+
+// String summarizes the writer on a single line.
+func (s *writeStats) String() string {
+	str := fmt.Sprintf("%d keys in %d txs", s.Keys, s.Txs)
+	if s.Latency != nil {
+		str += fmt.Sprintf(", tx p99: %v", s.Latency.P99)
+	}
+	if s.CorrectedLatency != nil {
+		str += fmt.Sprintf(" (corrected: %v)", s.CorrectedLatency.P99)
+	}
+	return str + fmt.Sprintf(", freelist: %d free, %d pending pages", s.FreePages, s.PendingPages)
+}
+
+// writeFunc applies a write to the key with index n in tx.
+type writeFunc func(tx *bolt.Tx, n int) error
+
+// startWriter calls fn for keysPerSec keys per second, picked by next, in a
+// separate goroutine. The returned function stops the writer and returns its
+// stats.
+func (b *bench) startWriter(keysPerSec float64, next func() int, fn writeFunc) func() *writeStats {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan *writeStats)
+	go func() { done <- b.write(ctx, keysPerSec, next, fn) }()
+	return func() *writeStats {
+		cancel()
+		return <-done
+	}
+}
+
+// write applies fn to batches of keys, one batch per transaction, until ctx
+// is canceled. Transactions are scheduled at fixed intervals, and those that
+// fall behind schedule, such as during a stall, are started back to back
+// until the writer catches up, as an open-loop client's would be.
+func (b *bench) write(ctx context.Context, keysPerSec float64, next func() int, fn writeFunc) *writeStats {
+	batch := int(keysPerSec/writerTxRate) + 1
+	interval := time.Duration(float64(batch) / keysPerSec * float64(time.Second))
+
+	var stats writeStats
+	hist, corrected := newLatencyHistogram(), newLatencyHistogram()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	scheduled := time.Now()
+loop:
+	for {
+		// Wait for the transaction's scheduled start.
+		timer.Reset(time.Until(scheduled))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			break loop
+		}
+		if isPaused() {
+			// Don't make up for the writes a pause skipped.
+			waitIfPaused()
+			scheduled = time.Now()
+		}
+		intended := scheduled
+		scheduled = scheduled.Add(interval)
+
+		t := time.Now()
+		err := b.db.Update(func(tx *bolt.Tx) error {
+			for i := 0; i < batch; i++ {
+				if err := fn(tx, next()); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("  write: %s", err)
+			continue
+		}
+		recordLatency(hist, time.Since(t))
+		recordLatency(corrected, time.Since(intended))
+		stats.Keys += batch
+		stats.Txs++
+	}
+
+	s := b.db.Stats()
+	stats.Latency = summarizeHistogram(hist)
+	stats.CorrectedLatency = summarizeHistogram(corrected)
+	stats.FreePages, stats.PendingPages = s.FreePageN, s.PendingPageN
+	return &stats
+}
+
+// startDeletes starts deleting keys at the scenario's delete rate.
+func (b *bench) startDeletes() func() *writeStats {
+	next := b.nextDelete
+	if b.cfg.DeleteOrder == orderRandom {
+		r := newRand(b.cfg, streamDelete)
+		next = func() int { return b.keys.next(r) }
+	}
+	return b.startWriter(b.cfg.DeleteRate, next, func(tx *bolt.Tx, n int) error {
+		k := make([]byte, b.cfg.KeySize)
+		b.cfg.encodeKey(k, n)
+		if err := b.cfg.bucket(tx, n).Delete(k); err != nil {
+			return fmt.Errorf("delete: %s", err)
+		}
+		return nil
+	})
+}
+
+// startUpdates starts rewriting keys at the scenario's update rate. Each key
+// picked from the key distribution is given a new random value of the same
+// size as its current one.
+func (b *bench) startUpdates() func() *writeStats {
+	r := newRand(b.cfg, streamUpdate)
+	next := func() int { return b.keys.next(r) }
+	return b.startWriter(b.cfg.UpdateRate, next, func(tx *bolt.Tx, n int) error {
+		k := make([]byte, b.cfg.KeySize)
+		b.cfg.encodeKey(k, n)
+		bkt := b.cfg.bucket(tx, n)
+		old := bkt.Get(k)
+		if old == nil {
+			return nil
+		}
+		v := make([]byte, len(old))
+		b.cfg.rewriteValue(k, v, r)
+		if err := bkt.Put(k, v); err != nil {
+			return fmt.Errorf("put: %s", err)
+		}
+		return nil
+	})
+}
+
+// nextDelete returns the next key deleted in sequential order.
+func (b *bench) nextDelete() int {
+	n := b.deleted % b.cfg.ItemCount
+	b.deleted++
+	return n
+}
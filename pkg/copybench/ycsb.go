@@ -0,0 +1,248 @@
+package copybench
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+	"github.com/boltdb/bolt"
+)
+
+// YCSB operation types.
+const (
+	opRead   = "read"
+	opUpdate = "update"
+	opInsert = "insert"
+	opScan   = "scan"
+	opRMW    = "rmw" // read-modify-write
+)
+
+// ycsbMaxScanLength is the largest number of records read by a scan, as in
+// YCSB's default maxscanlength.
+const ycsbMaxScanLength = 100
+
+// ycsbPreset is the operation mix of one of the core YCSB workloads.
+type ycsbPreset struct {
+	read, update, insert, scan, rmw float64
+
+	// latest picks recently inserted keys more often than old ones instead
+	// of using a fixed Zipfian popularity.
+	latest bool
+}
+
+// ycsbWorkloads maps workload names to the core YCSB workloads.
+var ycsbWorkloads = map[string]ycsbPreset{
+	"ycsb-a": {read: 0.5, update: 0.5},                 // update heavy
+	"ycsb-b": {read: 0.95, update: 0.05},               // read mostly
+	"ycsb-c": {read: 1},                                // read only
+	"ycsb-d": {read: 0.95, insert: 0.05, latest: true}, // read latest
+	"ycsb-e": {scan: 0.95, insert: 0.05},               // short ranges
+	"ycsb-f": {read: 0.5, rmw: 0.5},                    // read-modify-write
+}
+
+func init() {
+	for name := range ycsbWorkloads {
+		name := name
+		RegisterWorkload(name, func() Workload { return &ycsbWorkload{name: name} })
+	}
+}
+
+// ycsbWorkload runs a YCSB preset as a reader workload. A pass is get_count
+// operations, sharing the preset's runner with the other readers.
+type ycsbWorkload struct {
+	name string
+	env  *WorkloadEnv
+	y    *ycsb
+}
+
+func (w *ycsbWorkload) Setup(env *WorkloadEnv) error {
+	w.env, w.y = env, env.ycsb[w.name]
+	if w.y == nil {
+		return fmt.Errorf("no runner for %s", w.name)
+	}
+	return nil
+}
+
+func (w *ycsbWorkload) Step() (int, error) {
+	return w.y.run(w.env.DB, w.env.Config.GetCount, w.env.Rand, w.env.hists.ops), nil
+}
+
+func (w *ycsbWorkload) Teardown() error { return nil }
+
+// isYCSB reports whether name is a YCSB workload.
+func isYCSB(name string) bool {
+	_, ok := ycsbWorkloads[name]
+	return ok
+}
+
+// ycsb runs a YCSB preset against the bench's database. Every operation runs
+// in its own transaction. It is safe for concurrent use.
+type ycsb struct {
+	preset ycsbPreset
+	cfg    *Config
+	keys   *zipfian
+
+	// n is the number of keys in the database, including those inserted.
+	n int64
+}
+
+// newYCSB returns a runner for the named preset.
+func newYCSB(name string, cfg *Config) *ycsb {
+	return &ycsb{
+		preset: ycsbWorkloads[name],
+		cfg:    cfg,
+		keys:   newZipfian(cfg.ItemCount, cfg.ZipfSkew),
+		n:      int64(cfg.ItemCount),
+	}
+}
+
+// newHistograms returns a latency histogram for every operation type.
+func (y *ycsb) newHistograms() map[string]*hdrhistogram.Histogram {
+	return map[string]*hdrhistogram.Histogram{
+		opRead:   newLatencyHistogram(),
+		opUpdate: newLatencyHistogram(),
+		opInsert: newLatencyHistogram(),
+		opScan:   newLatencyHistogram(),
+		opRMW:    newLatencyHistogram(),
+	}
+}
+
+// run performs n operations using random numbers from r, recording the
+// latency of each in the histogram for its type. It returns the number of
+// records read or written.
+func (y *ycsb) run(db *bolt.DB, n int, r *rand.Rand, hists map[string]*hdrhistogram.Histogram) int {
+	var count int
+	for i := 0; i < n; i++ {
+		op := y.choose(r)
+		t := time.Now()
+		c, err := y.do(db, op, r)
+		if err != nil {
+			log.Printf("  %s: %s", op, err)
+			continue
+		}
+		recordLatency(hists[op], time.Since(t))
+		count += c
+	}
+	return count
+}
+
+// choose picks the type of the next operation.
+func (y *ycsb) choose(r *rand.Rand) string {
+	p := y.preset
+	u := r.Float64()
+	switch {
+	case u < p.read:
+		return opRead
+	case u < p.read+p.update:
+		return opUpdate
+	case u < p.read+p.update+p.insert:
+		return opInsert
+	case u < p.read+p.update+p.insert+p.scan:
+		return opScan
+	default:
+		return opRMW
+	}
+}
+
+// next returns the index of an existing key to operate on.
+func (y *ycsb) next(r *rand.Rand) int {
+	i := y.keys.next(r)
+	if y.preset.latest {
+		// Count back from the most recently inserted key.
+		n := int(atomic.LoadInt64(&y.n))
+		if i >= n {
+			i = n - 1
+		}
+		return n - 1 - i
+	}
+	return i
+}
+
+// do performs a single operation and returns the number of records it read
+// or wrote.
+func (y *ycsb) do(db *bolt.DB, op string, r *rand.Rand) (int, error) {
+	switch op {
+	case opRead:
+		n := y.next(r)
+		return 1, db.View(func(tx *bolt.Tx) error {
+			y.cfg.bucket(tx, n).Get(y.key(n))
+			return nil
+		})
+
+	case opScan:
+		n := y.next(r)
+		length := 1 + r.Intn(ycsbMaxScanLength)
+		var count int
+		err := db.View(func(tx *bolt.Tx) error {
+			c := y.cfg.bucket(tx, n).Cursor()
+			for k, _ := c.Seek(y.key(n)); k != nil && count < length; k, _ = c.Next() {
+				count++
+			}
+			return nil
+		})
+		return count, err
+
+	case opInsert:
+		return 1, y.put(db, int(atomic.AddInt64(&y.n, 1)-1), r, false)
+
+	case opUpdate:
+		return 1, y.put(db, y.next(r), r, false)
+
+	case opRMW:
+		return 1, y.put(db, y.next(r), r, true)
+	}
+	return 0, fmt.Errorf("unknown operation: %s", op)
+}
+
+// key returns the key with index n.
+func (y *ycsb) key(n int) []byte {
+	k := make([]byte, y.cfg.KeySize)
+	y.cfg.encodeKey(k, n)
+	return k
+}
+
+// put writes a random value from r to the key with index n, reading its
+// current value first if read is set.
+func (y *ycsb) put(db *bolt.DB, n int, r *rand.Rand, read bool) error {
+	k := y.key(n)
+	v := make([]byte, y.cfg.valueSize(r))
+	y.cfg.rewriteValue(k, v, r)
+	return db.Update(func(tx *bolt.Tx) error {
+		b := y.cfg.bucket(tx, n)
+		if read {
+			b.Get(k)
+		}
+		if err := b.Put(k, v); err != nil {
+			return fmt.Errorf("put: %s", err)
+		}
+		return nil
+	})
+}
+
+// summarizeOps summarizes the histograms of the operation types that ran.
+func summarizeOps(hists map[string]*hdrhistogram.Histogram) map[string]*latencySummary {
+	if hists == nil {
+		return nil
+	}
+	ops := make(map[string]*latencySummary)
+	for op, h := range hists {
+		if s := summarizeHistogram(h); s != nil {
+			ops[op] = s
+		}
+	}
+	return ops
+}
+
+// sortedOps returns the operation types in ops in alphabetical order.
+func sortedOps(ops map[string]*latencySummary) []string {
+	var names []string
+	for op := range ops {
+		names = append(names, op)
+	}
+	sort.Strings(names)
+	return names
+}